@@ -0,0 +1,397 @@
+package atomic
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// load and store instructions by access size. loads into 32 bit registers zero extend to 64 bits.
+var loadInstructions = map[int]string{1: "ldrb", 2: "ldrh", 4: "ldr.w", 8: "ldr"}
+var signedLoadInstructions = map[int]string{1: "ldrsb", 2: "ldrsh", 4: "ldrsw", 8: "ldr"}
+var storeInstructions = map[int]string{1: "strb", 2: "strh", 4: "str.w", 8: "str"}
+
+// the same by access size, with an unscaled signed 9 bit offset, for offsets which aren't a multiple of the size
+var unscaledLoadInstructions = map[int]string{1: "ldurb", 2: "ldurh", 4: "ldur.w", 8: "ldur"}
+var unscaledSignedLoadInstructions = map[int]string{1: "ldursb", 2: "ldursh", 4: "ldursw", 8: "ldur"}
+var unscaledStoreInstructions = map[int]string{1: "sturb", 2: "sturh", 4: "stur.w", 8: "stur"}
+
+// loads a primative from base register + offset into the 64 bit register rt, sign or zero extending it
+// according to the primative. floats are loaded into floating point registers. an offset no load encodes is
+// added to the base in rt, or in a register of its own for floats
+func (f *frame) emitLoad(p *profile, as *asm, pr primative, base int, offset int, rt register) {
+	if !encodableOffset(offset, pr.size) {
+		address := rt
+		if pr.float {
+			address, _ = f.registerForValue(p, "address")
+			defer f.releaseValue("address")
+		}
+		base, offset = f.emitAddress(p, as, pr, base, offset, address)
+	}
+	as.emit(f.load(p, pr, base, offset, rt))
+}
+
+// stores the low bytes of register rt to base register + offset, truncating to the size of the primative.
+// an offset no store encodes is added to the base in a register of its own
+func (f *frame) emitStore(p *profile, as *asm, pr primative, base int, offset int, rt register) {
+	if !encodableOffset(offset, pr.size) {
+		address, _ := f.registerForValue(p, "address")
+		defer f.releaseValue("address")
+		base, offset = f.emitAddress(p, as, pr, base, offset, address)
+	}
+	as.emit(f.store(p, pr, base, offset, rt))
+}
+
+func (f *frame) load(p *profile, pr primative, base int, offset int, rt register) uint32 {
+	if pr.float {
+		return f.offsetAccess(p, pr, "ldr", "ldur", base, offset, rt)
+	}
+	name, ok := loadInstructions[pr.size]
+	unscaled := unscaledLoadInstructions[pr.size]
+	if pr.signed {
+		name, ok = signedLoadInstructions[pr.size]
+		unscaled = unscaledSignedLoadInstructions[pr.size]
+	}
+	if !ok {
+		f.errorf(codeInstruction, "No load for %d byte %s", pr.size, pr.name)
+		return 0
+	}
+	return f.offsetAccess(p, pr, name, unscaled, base, offset, rt)
+}
+
+func (f *frame) store(p *profile, pr primative, base int, offset int, rt register) uint32 {
+	if pr.float {
+		return f.offsetAccess(p, pr, "str", "stur", base, offset, rt)
+	}
+	name, ok := storeInstructions[pr.size]
+	if !ok {
+		f.errorf(codeInstruction, "No store for %d byte %s", pr.size, pr.name)
+		return 0
+	}
+	return f.offsetAccess(p, pr, name, unscaledStoreInstructions[pr.size], base, offset, rt)
+}
+
+// encodes a load or store at base register + offset, scaled by the size of the access, or unscaled for small
+// offsets which aren't a multiple of it, as fields of packed structs may be
+func (f *frame) offsetAccess(p *profile, pr primative, scaled string, unscaled string, base int, offset int, rt register) uint32 {
+	form := p.find
+	if pr.float {
+		form = p.findFloat
+	}
+	if offset >= 0 && offset%pr.size == 0 && offset/pr.size <= 0xfff {
+		return form(scaled, "int").set("int", offset/pr.size, base, rt.index)
+	}
+	if offset >= -256 && offset < 256 {
+		return form(unscaled, "int").set("int", offset, base, rt.index)
+	}
+	f.errorf(codeOffset, "Offset %d can not be encoded for a %d byte access", offset, pr.size)
+	return 0
+}
+
+// returns true if a load or store of the size encodes the offset. fields which failed to lay out have no size
+func encodableOffset(offset int, size int) bool {
+	if size <= 0 {
+		return false
+	}
+	return (offset >= 0 && offset%size == 0 && offset/size <= 0xfff) || (offset >= -256 && offset < 256)
+}
+
+// adds the part of an offset a load or store of the primative can't encode to the base in rt, returning the base
+// and offset to access
+func (f *frame) emitAddress(p *profile, as *asm, pr primative, base int, offset int, rt register) (int, int) {
+	if offset < 0 || offset>>24 != 0 {
+		f.errorf(codeOffset, "Offset %d is too large to address", offset)
+		return base, 0
+	}
+	if offset > 0xfff {
+		as.emit(p.find("add.lsl", "dni").set("dni", rt.index, base, offset>>12))
+		base, offset = rt.index, offset&0xfff
+	}
+	if !encodableOffset(offset, pr.size) {
+		as.emit(p.find("add", "dni").set("dni", rt.index, base, offset))
+		base, offset = rt.index, 0
+	}
+	return base, offset
+}
+
+// adds an offset to the base in rt, as the address of a field held by value
+func (f *frame) emitOffsetAddress(p *profile, as *asm, base int, offset int, rt register) {
+	if offset > 0xfff && offset>>24 == 0 {
+		as.emit(p.find("add.lsl", "dni").set("dni", rt.index, base, offset>>12))
+		base, offset = rt.index, offset&0xfff
+		if offset == 0 {
+			return
+		}
+	}
+	as.emit(p.find("add", "dni").set("dni", rt.index, base, f.addressOffset(offset)))
+}
+
+// loads the pointers leading to a nested field, adding the indexes of arrays along the way, returning the register
+// holding the field's base
+func (f *frame) emitDerefs(p *profile, as *asm, fp fieldPath, base int, rt register) int {
+	for i, deref := range fp.derefs {
+		base = f.emitIndexes(p, as, fp, i, base, rt)
+		f.emitBounds(p, as, fp, i+1, base)
+		f.emitLoad(p, as, p.layout(pointerPrimative), base, deref, rt)
+		base = rt.index
+	}
+	return f.emitIndexes(p, as, fp, len(fp.derefs), base, rt)
+}
+
+// adds the indexes read once the given number of pointers have been loaded to the base, scaled by the size of
+// their elements. sizes which aren't a power of two are multiplied
+func (f *frame) emitIndexes(p *profile, as *asm, fp fieldPath, derefs int, base int, rt register) int {
+	for _, ix := range fp.indexes {
+		if ix.derefs != derefs || ix.access || ix.input == "" {
+			continue
+		}
+		idx, ok := f.emitIndex(p, as, ix)
+		if !ok {
+			continue
+		}
+		if ix.size&(ix.size-1) == 0 {
+			as.emit(p.find("add", "dmns").set("dmns", rt.index, idx.index, base, bits.TrailingZeros(uint(ix.size))))
+		} else {
+			size, _ := f.registerForValue(p, "element size")
+			for _, ins := range moveImmediate(p, size, uint64(ix.size)) {
+				as.emit(ins)
+			}
+			as.emit(p.find("madd", "dmna").set("dmna", rt.index, size.index, idx.index, base))
+			f.releaseValue("element size")
+		}
+		f.releaseValue(ix.value())
+		base = rt.index
+	}
+	return base
+}
+
+// checks the indexes of buffers added once the given number of pointers have been loaded against their lengths,
+// read from the base before the pointer to their elements is loaded. an index which was checked stays in its
+// register to be added. indexes out of bounds take the bounds exit
+func (f *frame) emitBounds(p *profile, as *asm, fp fieldPath, derefs int, base int) {
+	for _, ix := range fp.indexes {
+		if ix.derefs != derefs || ix.buffer == "" || f.ref.unchecked || f.proven(ix) {
+			continue
+		}
+		if ix.counter.size == 0 {
+			continue // the length of the buffer failed to resolve, which was reported
+		}
+		zr := p.findStackRegister().index
+		count, _ := f.registerForValue(p, "bound")
+		f.emitLoad(p, as, ix.counter, base, ix.count, count)
+		cond := condLE // a constant index is outside a length which isn't greater
+		if ix.input == "" && ix.constant <= 0xfff {
+			as.emit(p.find("subs", "dni").set("dni", zr, count.index, int(ix.constant)))
+		} else if ix.input == "" {
+			idx, _ := f.registerForValue(p, "bound index")
+			for _, ins := range moveImmediate(p, idx, uint64(ix.constant)) {
+				as.emit(ins)
+			}
+			as.emit(p.find("subs", "dmns").set("dmns", zr, idx.index, count.index, 0))
+			f.releaseValue("bound index")
+		} else if idx, ok := f.emitIndex(p, as, ix); ok {
+			// negative indexes compare as unsigned values beyond any length
+			as.emit(p.find("subs", "dmns").set("dmns", zr, count.index, idx.index, 0))
+			cond = condHS
+		}
+		f.releaseValue("bound")
+		f.emitBoundsCheck(p, as, cond, "Index "+ix.index()+" of "+ix.buffer)
+		f.prove(ix)
+	}
+}
+
+// the index of an array as written, a field of an input or a constant
+func (ix arrayIndex) index() string {
+	if ix.input == "" {
+		return strconv.FormatInt(ix.constant, 10)
+	}
+	return ix.input + "." + ix.field.path
+}
+
+// returns true if an earlier check by the node being emitted proved an index within its buffer, as the same index
+// or a larger constant index was
+func (f *frame) proven(ix arrayIndex) bool {
+	if f.provenFor != f.node {
+		return false
+	}
+	if ix.input == "" {
+		length, ok := f.provenLengths[ix.buffer]
+		return ok && ix.constant < length
+	}
+	_, ok := f.provenLengths[ix.buffer+"["+ix.index()+"]"]
+	return ok
+}
+
+// records an index checked within its buffer, unless the node being emitted populates the input of the buffer or
+// of the index, which may change its length
+func (f *frame) prove(ix arrayIndex) {
+	if f.provenFor != f.node {
+		f.provenFor = f.node
+		f.provenLengths = map[string]int64{}
+	}
+	if f.populating != "" && (strings.HasPrefix(ix.buffer, f.populating+".") || ix.input == f.populating) {
+		return
+	}
+	if ix.input != "" {
+		f.provenLengths[ix.buffer+"["+ix.index()+"]"] = 0
+	} else if ix.constant >= f.provenLengths[ix.buffer] {
+		f.provenLengths[ix.buffer] = ix.constant + 1
+	}
+}
+
+// loads an index into a register of its own, reloading its input into the same register if it's spilled.
+// an index already loaded to check it against the length of its buffer is used from its register
+func (f *frame) emitIndex(p *profile, as *asm, ix arrayIndex) (register, bool) {
+	if r, ok := f.valueRegister(ix.value()); ok {
+		return r, true
+	}
+	r, _ := f.registerForValue(p, ix.value())
+	if r.name == "" {
+		return r, false
+	}
+	base, ok := f.valueRegister(ix.input)
+	if !ok && contains(f.declaredInputs(), ix.input) {
+		base, ok = f.reloadValue(p, as, ix.input, r)
+	}
+	if !ok {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", ix.input)
+		f.releaseValue(ix.value())
+		return r, false
+	}
+	b := f.emitDerefs(p, as, ix.field, base.index, r)
+	f.emitFieldLoad(p, as, ix.field, b, r)
+	return r, true
+}
+
+// the name of the value holding an index, distinct from those of any indexes it's read through
+func (ix arrayIndex) value() string {
+	return "index " + ix.input + "." + ix.field.path
+}
+
+// returns the index of an array of primatives which the field is an element of
+func (fp fieldPath) access() (arrayIndex, bool) {
+	for _, ix := range fp.indexes {
+		if ix.access {
+			return ix, true
+		}
+	}
+	return arrayIndex{}, false
+}
+
+// returns true if reaching a field from its base loads pointers or adds indexes, which needs a register
+func (fp fieldPath) computed() bool {
+	for _, ix := range fp.indexes {
+		if !ix.access {
+			return true
+		}
+	}
+	return len(fp.derefs) > 0
+}
+
+// loads a field from the base its pointers and indexes lead to. an element of an array of primatives is loaded
+// from the base plus its index, shifted by the size of the access, with the offset of the array added to the index.
+// a field in the other byte order is loaded without extending its sign, until its bytes are reversed
+func (f *frame) emitFieldLoad(p *profile, as *asm, fp fieldPath, base int, rt register) {
+	ix, ok := fp.access()
+	pr := fp.prim
+	if fp.swapped() {
+		pr.signed = false
+	}
+	switch {
+	case !ok && fp.prim.bits > 0:
+		f.emitBitsLoad(p, as, fp, base, rt)
+	case !ok:
+		f.emitLoad(p, as, pr, base, fp.offset, rt)
+	default:
+		idx, indexed, ok := f.emitElementIndex(p, as, fp, ix, base)
+		if !ok {
+			return
+		}
+		if indexed {
+			as.emit(f.indexed(p, pr, base, idx, rt, true))
+		} else {
+			f.emitLoad(p, as, pr, idx.index, fp.offset, rt)
+		}
+		f.releaseValue(ix.value())
+	}
+	if fp.swapped() {
+		f.emitOrdered(p, as, fp.prim, rt)
+	}
+}
+
+// stores a field to the base its pointers and indexes lead to, as emitFieldLoad loads it. a field in the other
+// byte order is stored from a copy of the register with its bytes reversed
+func (f *frame) emitFieldStore(p *profile, as *asm, fp fieldPath, base int, rt register) {
+	if fp.swapped() {
+		r, _ := f.registerForValue(p, "ordered")
+		defer f.releaseValue("ordered")
+		as.emit(p.find(reverseInstructions[fp.prim.size], "dn").set("dn", r.index, rt.index))
+		rt = r
+	}
+	ix, ok := fp.access()
+	if !ok && fp.prim.bits > 0 {
+		f.emitBitsStore(p, as, fp, base, rt)
+		return
+	}
+	if !ok {
+		f.emitStore(p, as, fp.prim, base, fp.offset, rt)
+		return
+	}
+	idx, indexed, ok := f.emitElementIndex(p, as, fp, ix, base)
+	if !ok {
+		return
+	}
+	if indexed {
+		as.emit(f.indexed(p, fp.prim, base, idx, rt, false))
+	} else {
+		f.emitStore(p, as, fp.prim, idx.index, fp.offset, rt)
+	}
+	f.releaseValue(ix.value())
+}
+
+// loads the index of an element, adding the offset of its array in elements, to access it at the base plus the
+// index. the offset of an array which isn't a whole number of elements, as in a packed struct, or is too many for
+// the add to encode, isn't added. the index is added to the base instead, returning false to access the element
+// at the offset of its array from there
+func (f *frame) emitElementIndex(p *profile, as *asm, fp fieldPath, ix arrayIndex, base int) (register, bool, bool) {
+	idx, ok := f.emitIndex(p, as, ix)
+	switch {
+	case !ok:
+		return idx, false, false
+	case fp.offset == 0:
+		return idx, true, true
+	case fp.offset%fp.prim.size == 0 && fp.offset/fp.prim.size <= 0xfff:
+		as.emit(p.find("add", "dni").set("dni", idx.index, idx.index, fp.offset/fp.prim.size))
+		return idx, true, true
+	}
+	as.emit(p.find("add", "dmns").set("dmns", idx.index, idx.index, base, bits.TrailingZeros(uint(fp.prim.size))))
+	return idx, false, true
+}
+
+// a load or store of a primative at base register + index register, shifted by the size of the primative
+func (f *frame) indexed(p *profile, pr primative, base int, idx register, rt register, load bool) uint32 {
+	shifted := 0
+	if pr.size > 1 {
+		shifted = 1
+	}
+	if pr.float {
+		name := "str"
+		if load {
+			name = "ldr"
+		}
+		return p.findFloat(name, "mnst").set("mnst", idx.index, base, shifted, rt.index)
+	}
+	instructions := storeInstructions
+	switch {
+	case load && pr.signed:
+		instructions = signedLoadInstructions
+	case load:
+		instructions = loadInstructions
+	}
+	name, ok := instructions[pr.size]
+	if !ok {
+		f.errorf(codeInstruction, "No indexed access for %d byte %s", pr.size, pr.name)
+		return 0
+	}
+	return p.find(name, "mnst").set("mnst", idx.index, base, shifted, rt.index)
+}
@@ -0,0 +1,232 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// loads and stores are chosen by the size of the field, extending signed sources to wider targets
+func TestFieldAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   map[string][]string // instructions of functions
+	}{
+		{
+			name: "fields of each primative",
+			source: `package: t
+type: src { b byte h short i int l long o bool d double }
+type: dst { b byte h short i int l long o bool d double }
+function: f {
+    > src
+    > dst
+    + dst
+}`,
+			want: map[string][]string{"f": {
+				"f:",
+				"ldrb i=0 n=0 t=8", "strb i=0 n=1 t=8",
+				"ldrsh i=1 n=0 t=8", "strh i=1 n=1 t=8",
+				"ldrsw i=1 n=0 t=8", "str.w i=1 n=1 t=8",
+				"ldr i=1 n=0 t=8", "str i=1 n=1 t=8",
+				"ldrb i=16 n=0 t=8", "strb i=16 n=1 t=8",
+				"ldr i=3 n=0 t=16", "str i=3 n=1 t=16", // doubles through d16
+				"exit_f:", "ret n=30", "padding", "padding", "padding",
+			}},
+		},
+		{
+			name: "widened fields",
+			source: `package: t
+type: src { b byte h short i int }
+type: wide { b int h long i long }
+function: g {
+    > src
+    > wide
+    + wide
+}`,
+			want: map[string][]string{"g": {
+				"g:",
+				"ldrb i=0 n=0 t=8", "str.w i=0 n=1 t=8", // bytes are unsigned, zero extended
+				"ldrsh i=1 n=0 t=8", "str i=1 n=1 t=8",
+				"ldrsw i=1 n=0 t=8", "str i=2 n=1 t=8",
+				"exit_g:", "ret n=30", "padding",
+			}},
+		},
+		{
+			name: "unaligned fields of a packed struct",
+			source: `package: t
+type: hdr packed { b byte l long i int s short d double }
+type: src { l long i int s short d double }
+function: f {
+    > src
+    > hdr
+    + hdr { b <- 1 }
+}`,
+			want: map[string][]string{"f": {
+				"f:",
+				"movz d=9 h=0 i=1", "strb i=0 n=1 t=9",
+				"ldr i=0 n=0 t=8", "stur i=1 n=1 t=8",
+				"ldrsw i=2 n=0 t=8", "stur.w i=9 n=1 t=8",
+				"ldrsh i=6 n=0 t=8", "sturh i=13 n=1 t=8",
+				"ldr i=2 n=0 t=16", "stur i=15 n=1 t=16",
+				"exit_f:", "ret n=30", "padding",
+			}},
+		},
+		{
+			name: "fields beyond a large array",
+			source: `package: t
+type: big { a [5000]long n long m int }
+type: src { n long m int }
+function: f {
+    > src
+    > big
+    + big
+}
+function: g {
+    > big
+    > src
+    + src
+}`,
+			// n at 40000 is 9 << 12 above the base plus 392 longs, m at 40008 is 786 ints above it
+			want: map[string][]string{
+				"f": {
+					"f:",
+					"ldr i=0 n=0 t=8", "add.lsl d=9 i=9 n=1", "str i=392 n=9 t=8",
+					"ldrsw i=2 n=0 t=8", "add.lsl d=9 i=9 n=1", "str.w i=786 n=9 t=8",
+					"exit_f:", "ret n=30", "padding",
+				},
+				"g": {
+					"g:",
+					"add.lsl d=8 i=9 n=0", "ldr i=392 n=8 t=8", "str i=0 n=1 t=8",
+					"add.lsl d=8 i=9 n=0", "ldrsw i=786 n=8 t=8", "str.w i=2 n=1 t=8",
+					"exit_g:", "ret n=30", "padding",
+				},
+			},
+		},
+		{
+			name: "elements of an array at an unaligned offset",
+			source: `package: t
+type: hdr packed { b byte c [3]int }
+type: src { i int k int }
+function: f {
+    > src
+    > hdr
+    + hdr { b <- 1 c[src.k] <- src.i }
+}`,
+			want: map[string][]string{"f": {
+				"f:",
+				"movz d=9 h=0 i=1", "strb i=0 n=1 t=9",
+				"ldrsw i=0 n=0 t=8", "ldrsw i=1 n=0 t=9",
+				"add d=9 m=9 n=1 s=2", "stur.w i=1 n=9 t=8", // the element's address, then c at 1 above it
+				"exit_f:", "ret n=30", "padding",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing := compileListing(t, tt.source)
+			for function, want := range tt.want {
+				if got := functionInstructions(listing, function); !reflect.DeepEqual(got, want) {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodableOffset(t *testing.T) {
+	tests := []struct {
+		offset int
+		size   int
+		want   bool
+	}{
+		{0, 8, true},
+		{32760, 8, true},  // the largest scaled offset of a long
+		{32768, 8, false}, // beyond it
+		{16380, 4, true},
+		{4095, 1, true},
+		{4096, 1, false},
+		{9, 8, true},    // unscaled
+		{255, 8, true},  // the largest unscaled offset
+		{257, 8, false}, // unaligned beyond it
+		{-256, 4, true},
+		{-257, 4, false},
+		{0, 0, false}, // a field which failed to lay out
+		{8, -1, false},
+	}
+	for _, tt := range tests {
+		if got := encodableOffset(tt.offset, tt.size); got != tt.want {
+			t.Errorf("encodableOffset(%d, %d) = %v, want %v", tt.offset, tt.size, got, tt.want)
+		}
+	}
+}
+
+// elements of arrays load and store at constant offsets, or at register offsets shifted by the element size.
+// elements of structs are addressed first, then their fields are offsets from the element
+func TestArrayElements(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: seat { row short col byte }
+type: src { i int k int r short }
+type: o { a [4]int b [3]seat l [2]long d [2]double }
+function: f {
+    > src
+    > o
+    + o { a[2] <- src.i a[src.k] <- 7 b[1].row <- src.r b[src.k].col <- 1 l[src.k] <- src.k d[1] <- 2.0 }
+}
+function: g {
+    > o
+    > src
+    + src { i <- o.a[src.k] k <- o.a[3] r <- 0 }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=8", "str.w i=2 n=1 t=8",
+			"movz d=9 h=0 i=7", "ldrsw i=1 n=0 t=10", "str.w m=10 n=1 s=1 t=9",
+			"ldrsh i=4 n=0 t=8", "strh i=10 n=1 t=8", // b at 16, row of the element at 20
+			"ldrsw i=1 n=0 t=10", "add d=9 m=10 n=1 s=2", "movz d=10 h=0 i=1", "strb i=18 n=9 t=10",
+			"ldrsw i=1 n=0 t=8", "ldrsw i=1 n=0 t=9", "add d=9 i=4 n=9", "str m=9 n=1 s=1 t=8", // l at 32, 4 longs
+			"fmov d=17 i=0", "str i=7 n=1 t=17",
+			"exit_f:", "ret n=30", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=1 n=1 t=9", "ldrsw m=9 n=0 s=1 t=8", "str.w i=0 n=1 t=8",
+			"ldrsw i=3 n=0 t=8", "str.w i=1 n=1 t=8",
+			"movz d=9 h=0 i=0", "strh i=4 n=1 t=9",
+			"exit_g:", "ret n=30",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+	got := diagnosticStrings(compileErrors(compileSource(t, `package: t
+type: seat { row short col byte }
+type: src { i int k int }
+type: o { a [4]int b [3]seat }
+function: f {
+    > src
+    > o
+    + o { a[4] <- 1 b[src.k] <- src.k }
+    + o { b[-1].row <- 1 }
+}
+`)))
+	want := []string{
+		"A208 8:11 Index 4 is outside o.a, which has 4 elements",
+		"A204 8:21 Can not populate o.b[src.k] seat, map the fields of the element",
+		"A100 9:13 Expected index but found punctuation '-'",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
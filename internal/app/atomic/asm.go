@@ -2,6 +2,7 @@ package atomic
 
 import (
 	"crypto/sha256"
+	"fmt"
 	"io"
 )
 
@@ -38,6 +39,17 @@ func (a *asm) emit(i uint32) {
 	a.instructions = append(a.instructions, i)
 }
 
+// inserts instructions before the instruction at index, moving symbols which follow it.
+// branches within the instructions after index remain valid as they are relative
+func (a *asm) insert(index int, ins ...uint32) {
+	a.instructions = append(a.instructions[:index], append(ins, a.instructions[index:]...)...)
+	for i := range a.symbols {
+		if a.symbols[i].offset > index*4 {
+			a.symbols[i].offset += len(ins) * 4
+		}
+	}
+}
+
 func (a *asm) align() {
 	for len(a.instructions)&0x3 != 0 {
 		a.emit(0)
@@ -85,3 +97,19 @@ func (a *asm) symbolCounts() (int, int) {
 	}
 	return len(a.symbols) - exported, exported
 }
+
+// writes symbols and instructions as text, naming instructions by reverse matching against the profile
+func (a *asm) writeListing(w io.Writer, p *profile) {
+	si := 0
+	for i, v := range a.instructions {
+		off := i * 4
+		for ; si < len(a.symbols) && a.symbols[si].offset <= off; si++ {
+			fmt.Fprintf(w, "%s:\n", a.symbols[si].value)
+		}
+		if v == 0 {
+			fmt.Fprintf(w, "%6x: %08x  padding\n", off, v)
+			continue
+		}
+		fmt.Fprintf(w, "%6x: %08x  %s\n", off, v, p.describe(v))
+	}
+}
@@ -1,6 +1,7 @@
 package atomic
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"runtime"
@@ -12,6 +13,8 @@ type options struct {
 	targetos    string
 	outputdir   string
 	verbose     bool
+	headers     bool
+	unchecked   bool
 	concurrency int
 	profile     string
 }
@@ -21,6 +24,8 @@ func Atomic() {
 
 	a := args{}
 	a.BoolArg('v', "verbose", "verbose output.", &o.verbose)
+	a.BoolArg('H', "headers", "write C headers for the types of each source file.", &o.headers)
+	a.BoolArg('u', "unchecked", "omit bounds checks, for trusted code.", &o.unchecked)
 	a.StringArg('d', "outputdir", ".", false, "output directory.", nil, &o.outputdir)
 	a.StringArg('t', "targetos", runtime.GOOS, false, "target OS.", []string{"darwin", "linux"}, &o.targetos)
 	a.StringArg('p', "profile", "profile/arm64.profile", false, "cpu profile file.", nil, &o.profile)
@@ -33,46 +38,100 @@ func Atomic() {
 		}
 	}
 
-	profile := loadProfile(o, o.profile)
-	compileFiles(profile, tail, o)
+	d := &diagnostics{}
+	profile := loadProfile(o, o.profile, d)
+	if !d.hasErrors() {
+		units := compileUnits(readSources(tail, d), &profile, o.concurrency, o.unchecked, d)
+
+		if !d.hasErrors() {
+			for _, u := range units {
+				writeObjectFile(objectFileName(o.outputdir, u.filename), u.object, d)
+				if o.headers {
+					writeObjectFile(headerFileName(o.outputdir, u.filename), u.header, d)
+				}
+			}
+		}
+
+		if o.verbose {
+			for _, u := range units {
+				u.ast.printNode(os.Stdout, 0)
+			}
+			for _, u := range units {
+				for _, a := range u.asms {
+					fmt.Printf("ASM %x %s\n", a.getHash(), a.symbols[0].value)
+				}
+			}
+			for _, u := range units {
+				fmt.Printf("AST %x %s\n", u.ast.getHash(), u.filename)
+			}
+		}
+	}
+	if d.report(os.Stdout) {
+		os.Exit(1)
+	}
 }
 
-func compileFiles(profile profile, files []string, o options) {
-	units := make([]unit, 0, len(files))
-	unitChannel := make(chan unit, len(files))
+func readSources(files []string, d *diagnostics) []source {
+	sources := make([]source, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			d.errorf(codeIO, span{}, "Failed to open file: %s %v", file, err)
+			continue
+		}
+		sources = append(sources, source{
+			filename: file,
+			data:     data,
+		})
+	}
+	return sources
+}
 
-	for fi, file := range files {
-		go parseFile(o, file, unitChannel)
+// parses, resolves and compiles the sources to objects in memory. nothing is written to the filesystem.
+func compileUnits(sources []source, profile *profile, concurrency int, unchecked bool, d *diagnostics) []unit {
+	units := make([]unit, 0, len(sources))
+	unitChannel := make(chan unit, len(sources))
 
-		for fi-len(units) > o.concurrency {
+	for si, s := range sources {
+		go parseUnit(s, d, unitChannel)
+
+		for si-len(units) > concurrency {
 			units = append(units, <-unitChannel)
 		}
 	}
-	for len(units) < len(files) {
+	for len(units) < len(sources) {
 		units = append(units, <-unitChannel)
 	}
+	// sort reordered results by file name, so duplicate definitions are reported consistently
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].filename < units[j].filename
+	})
 
 	// create reference structure from all files
 	r := reference{
-		structs:   map[string]*structNode{},
-		functions: map[string]*functionNode{},
+		structs:      map[string]*structNode{},
+		enums:        map[string]*enumNode{},
+		functions:    map[string]*functionNode{},
+		declarations: map[string]*ast{},
+		unchecked:    unchecked,
 	}
 	for _, u := range units {
-		r.populate(&u.ast)
+		r.populate(&u.ast, d)
 	}
+	r.layout(profile, d)
 
 	// compile each file
-	objectChannel := make(chan string, len(units))
-	for _, u := range units {
+	for ui, _ := range units {
+		u := &units[ui]
 		// collect functions for each file
 		functions := collectFunctions(&u.ast)
 		asms := make([]asm, 0, len(functions))
-		asmChannel := make(chan asm, len(asms))
+		asmChannel := make(chan asm, len(functions))
 
 		for fi, fa := range functions {
-			go compileFunction(fa, &profile, &r, asmChannel)
+			go compileFunction(fa, profile, &r, d, asmChannel)
 
-			for fi-len(asms) > o.concurrency {
+			for fi-len(asms) > concurrency {
 				asms = append(asms, <-asmChannel)
 			}
 		}
@@ -83,65 +142,97 @@ func compileFiles(profile profile, files []string, o options) {
 		sort.Slice(asms, func(i, j int) bool {
 			return asms[i].symbols[0].value < asms[j].symbols[0].value
 		})
+		u.asms = asms
+	}
 
-		if o.verbose {
-			for _, a := range asms {
-				fmt.Printf("ASM %x %s\n", a.getHash(), a.symbols[0].value)
-			}
-		}
+	if d.hasErrors() {
+		// diagnostics have been collected, but objects would be incomplete
+		return units
+	}
 
-		go writeObject(asms, objectFileName(o.outputdir, u.filename), o.targetos, objectChannel)
+	objectChannel := make(chan int, len(units))
+	for ui, _ := range units {
+		go func(u *unit) {
+			u.object = buildObject(u.asms, profile.targetos, d)
+			var h bytes.Buffer
+			writeHeader(&h, &r, u)
+			u.header = h.Bytes()
+			objectChannel <- 0
+		}(&units[ui])
 	}
 	for range units {
 		<-objectChannel
 	}
-
-	if o.verbose {
-		// sort reordered results by file name
-		sort.Slice(units, func(i, j int) bool {
-			return units[i].filename < units[j].filename
-		})
-
-		for _, u := range units {
-			fmt.Printf("AST %x %s\n", u.ast.getHash(), u.filename)
-		}
-	}
+	return units
 }
 
-func writeObject(asms []asm, filename string, targetos string, objectChannel chan string) {
+func buildObject(asms []asm, targetos string, d *diagnostics) []byte {
+	var b bytes.Buffer
 	switch targetos {
 	case "darwin":
-		writeObjectFileMach(filename, asms)
+		writeObjectMach(&b, asms)
 	case "linux":
-		writeObjectFileElf(filename, asms)
+		writeObjectElf(&b, asms)
 	default:
-		shenanigans("Object format not supported for %s", targetos)
+		d.errorf(codeIO, span{}, "Object format not supported for %s", targetos)
 	}
-
-	objectChannel <- filename
+	return b.Bytes()
 }
 
-func compileFunction(fa ast, profile *profile, r *reference, asmChannel chan asm) {
-	asm := asm{
-		instructions: make([]uint32, 0, 128),
-		symbols:      make([]symbol, 0, 16),
-		underscore:   profile.targetos == "darwin",
+func writeObjectFile(filename string, object []byte, d *diagnostics) {
+	err := os.WriteFile(filename, object, 0644)
+	if err != nil {
+		d.errorf(codeIO, span{}, "Failed to write file: %s %v", filename, err)
 	}
+}
 
-	dc := fa.emit(newFrame(r), profile, &asm)
-	if dc != nil {
-		dc()
+func compileFunction(fa ast, profile *profile, r *reference, d *diagnostics, asmChannel chan asm) {
+	// inputs spilled part way through a function may have been used from their registers earlier in an
+	// enclosing loop, so the function is emitted again with them spilled on entry, until no more are spilled.
+	// likewise loops found too large to unroll are emitted again holding a counter
+	var spilled, counted []string
+	for {
+		asm := asm{
+			instructions: make([]uint32, 0, 128),
+			symbols:      make([]symbol, 0, 16),
+			underscore:   profile.targetos == "darwin",
+		}
+		fd := &diagnostics{}
+		f := newFrame(r, fd)
+		// the profile is shared by concurrent functions, each reports failed lookups through its own frame
+		p := *profile
+		p.frame = f
+		f.plan(&p, &fa, spilled)
+		f.stack.counted = append([]string(nil), counted...)
+		dc := fa.emit(f, &p, &asm)
+		if dc != nil {
+			dc()
+		}
+		if (len(f.stack.late) > 0 || len(f.stack.counted) > len(counted)) && !fd.hasErrors() {
+			spilled = append(spilled, f.stack.late...)
+			counted = f.stack.counted
+			continue
+		}
+		asm.align()
+		d.addAll(fd)
+		asmChannel <- asm
+		return
 	}
-	asm.align()
-
-	asmChannel <- asm
 }
 
 func objectFileName(dir string, source string) string {
+	return fmt.Sprintf("%s/%s.o", dir, unitName(source))
+}
+
+func headerFileName(dir string, source string) string {
+	return fmt.Sprintf("%s/%s.h", dir, unitName(source))
+}
+
+// the source file name without directories and extensions
+func unitName(source string) string {
 	source = strings.TrimSuffix(source, ".atomic")
-	dirs := strings.Split(source, "/")                // remove dirs
-	source = strings.Split(dirs[len(dirs)-1], ".")[0] // remove extensions
-	return fmt.Sprintf("%s/%s.o", dir, source)
+	dirs := strings.Split(source, "/")              // remove dirs
+	return strings.Split(dirs[len(dirs)-1], ".")[0] // remove extensions
 }
 
 func shenanigans(format string, a ...interface{}) {
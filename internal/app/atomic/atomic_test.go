@@ -0,0 +1,185 @@
+package atomic
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// loads the arm64 profile for linux
+func testProfile(t *testing.T) *Profile {
+	t.Helper()
+	return testProfileFor(t, "linux")
+}
+
+// loads the arm64 profile for the target os
+func testProfileFor(t *testing.T, targetos string) *Profile {
+	t.Helper()
+	file, err := os.Open("../../../profile/arm64.profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	p, diags := LoadProfile(file, "arm64.profile", targetos)
+	if len(diags) > 0 {
+		t.Fatalf("loading profile: %v", diags)
+	}
+	return p
+}
+
+// compiles a source in memory with the arm64 profile for linux
+func compileSource(t *testing.T, source string) Result {
+	t.Helper()
+	return Compile([]Source{{Filename: "test.atomic", Data: []byte(source)}}, Options{Profile: testProfile(t), Concurrency: 1})
+}
+
+// returns the errors of a compilation
+func compileErrors(r Result) []Diagnostic {
+	var errors []Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Severity == severityError.String() {
+			errors = append(errors, d)
+		}
+	}
+	return errors
+}
+
+// returns diagnostics as code line:col message, errors and warnings alike
+func diagnosticStrings(ds []Diagnostic) []string {
+	var diags []string
+	for _, d := range ds {
+		diags = append(diags, fmt.Sprintf("%s %d:%d %s", d.Code, d.Line, d.Column, d.Message))
+	}
+	return diags
+}
+
+// returns the diagnostics of a compilation as code line:col message
+func compileDiagnostics(t *testing.T, source string) []string {
+	t.Helper()
+	return diagnosticStrings(compileSource(t, source).Diagnostics)
+}
+
+// compiles a source which must compile without errors, returning its listing
+func compileListing(t *testing.T, source string) string {
+	t.Helper()
+	r := compileSource(t, source)
+	if errors := compileErrors(r); len(errors) > 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+	return r.Files[0].Listing
+}
+
+// returns the number of instructions of a listing with the name
+func countInstructions(listing string, name string) int {
+	return strings.Count(listing, "  "+name+" ")
+}
+
+// returns the listing of a function, with the exit and slip tails of the function
+func functionListing(listing string, name string) string {
+	var sb strings.Builder
+	in := false
+	for _, line := range strings.SplitAfter(listing, "\n") {
+		if symbol := strings.TrimSuffix(strings.TrimSpace(line), ":"); strings.HasSuffix(line, ":\n") {
+			in = symbol == name || strings.HasSuffix(symbol, "_"+name)
+		}
+		if in {
+			sb.WriteString(line)
+		}
+	}
+	return sb.String()
+}
+
+// returns the instructions of a function as their names and operands eg. str.w i=1 n=0 t=9, and its labels
+// eg. exit_f:, without their addresses and encodings
+func functionInstructions(listing string, name string) []string {
+	var instructions []string
+	for _, line := range strings.Split(functionListing(listing, name), "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.Index(line, "  "); i >= 0 {
+			line = line[i+2:]
+		}
+		if line != "" {
+			instructions = append(instructions, line)
+		}
+	}
+	return instructions
+}
+
+// the stack pointer on entry to functions run by runInstructions
+const entrySP = 0x10000
+
+// runs the listed instructions of a function, whose inputs are at the addresses of the parameter registers
+// followed by the caller's argument area at the stack pointer. other registers hold their own number above
+// 0x7700 on entry. returns the registers on return
+func runInstructions(t *testing.T, instructions []string, inputs []int64, memory map[int64]int64) [32]int64 {
+	t.Helper()
+	var x [32]int64
+	for r := range x {
+		x[r] = int64(0x7700 + r)
+	}
+	x[31] = entrySP
+	for i, address := range inputs {
+		if i < 8 {
+			x[i] = address
+		} else {
+			memory[entrySP+int64(i-8)*8] = address
+		}
+	}
+	for _, ins := range instructions {
+		fields := strings.Fields(ins)
+		op := map[string]int64{}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			v, _ := strconv.ParseInt(kv[1], 10, 64)
+			op[kv[0]] = v
+		}
+		// 31 is the stack pointer as a base or immediate operand, otherwise the zero register
+		reg := func(name string) int64 {
+			if _, imm := op["i"]; op[name] == 31 && !imm {
+				return 0
+			}
+			return x[op[name]]
+		}
+		pair := op["i"] << 57 >> 57 * 8 // signed, scaled offset of a pair
+		switch fields[0] {
+		case "ldr":
+			x[op["t"]] = memory[reg("n")+op["i"]*8]
+		case "str":
+			memory[reg("n")+op["i"]*8] = x[op["t"]]
+		case "ldp":
+			x[op["t"]], x[op["u"]] = memory[reg("n")+pair], memory[reg("n")+pair+8]
+		case "stp":
+			memory[reg("n")+pair], memory[reg("n")+pair+8] = x[op["t"]], x[op["u"]]
+		case "stp.pre":
+			x[op["n"]] += pair
+			memory[x[op["n"]]], memory[x[op["n"]]+8] = x[op["t"]], x[op["u"]]
+		case "ldp.post":
+			x[op["t"]], x[op["u"]] = memory[x[op["n"]]], memory[x[op["n"]]+8]
+			x[op["n"]] += pair
+		case "add":
+			if _, imm := op["i"]; imm {
+				x[op["d"]] = reg("n") + op["i"]
+			} else {
+				x[op["d"]] = reg("n") + reg("m")<<op["s"]
+			}
+		case "sub":
+			if _, imm := op["i"]; imm {
+				x[op["d"]] = reg("n") - op["i"]
+			} else {
+				x[op["d"]] = reg("n") - reg("m")<<op["s"]
+			}
+		case "madd":
+			x[op["d"]] = reg("a") + reg("n")*reg("m")
+		case "ret":
+			return x
+		default:
+			if !strings.HasSuffix(fields[0], ":") {
+				t.Fatalf("can't run %s", ins)
+			}
+		}
+	}
+	t.Fatalf("no ret")
+	return x
+}
@@ -0,0 +1,105 @@
+package atomic
+
+import (
+	"strconv"
+	"strings"
+)
+
+// the integer primatives of each size, the words bit fields are declared as and accessed through
+var bitsWords = map[int]string{
+	1: "byte",
+	2: "short",
+	4: "int",
+	8: "long",
+}
+
+// returns the primative of a bit field eg. bits:3, or sbits:3 which is signed. its size is that of the smallest
+// word holding its bits, until it's laid out
+func bitsPrimative(p *profile, typ string, width int) primative {
+	word, _ := p.primative(bitsWords[bitsWord(width)])
+	return primative{
+		name:    typ,
+		size:    word.size,
+		align:   word.align,
+		integer: true,
+		signed:  typ == "sbits",
+		bits:    width,
+	}
+}
+
+// parses a bit field type named by a cast eg. bits:3(pass.count)
+func parseBitsType(typ string) (string, int, bool) {
+	split := strings.SplitN(typ, ":", 2)
+	if len(split) < 2 || (split[0] != "bits" && split[0] != "sbits") {
+		return "", 0, false
+	}
+	width, err := strconv.Atoi(split[1])
+	return split[0], width, err == nil && width >= 1 && width <= 64
+}
+
+// returns the size of the smallest word holding the bits
+func bitsWord(width int) int {
+	size := 1
+	for size*8 < width {
+		size *= 2
+	}
+	return size
+}
+
+// returns the width of a primative in bits
+func (pr primative) width() int {
+	if pr.bits > 0 {
+		return pr.bits
+	}
+	return pr.size * 8
+}
+
+// places a bit field at the bit following the last field, unless in an unpacked struct it would cross a word of its
+// declared size, when it starts the next one as C does. it's accessed as the smallest aligned word holding its bits,
+// returning the bit following it, or false if no word holds it
+func layoutBits(p *profile, f *field, pr primative, end int, packed bool) (int, bool) {
+	declared := bitsWord(pr.bits) * 8
+	start := end
+	if !packed && start%declared+pr.bits > declared {
+		start = alignUp(start, declared)
+	}
+	for size := 1; size <= 8; size *= 2 {
+		offset := start / 8 &^ (size - 1)
+		if (offset+size)*8 >= start+pr.bits {
+			word, _ := p.primative(bitsWords[size])
+			pr.size, pr.align = word.size, word.align
+			f.prim, f.size, f.offset, f.bit = pr, size, offset, start-offset*8
+			return start + pr.bits, true
+		}
+	}
+	return end, false
+}
+
+// returns the word holding a bit field, loaded and stored whole
+func (fp fieldPath) word() primative {
+	return primative{
+		name:    bitsWords[fp.prim.size],
+		size:    fp.prim.size,
+		align:   fp.prim.align,
+		integer: true,
+	}
+}
+
+// loads the word holding a bit field, extracting its bits and extending them by its sign
+func (f *frame) emitBitsLoad(p *profile, as *asm, fp fieldPath, base int, rt register) {
+	f.emitLoad(p, as, fp.word(), base, fp.offset, rt)
+	extract := "ubfm"
+	if fp.prim.signed {
+		extract = "sbfm"
+	}
+	as.emit(p.find(extract, "dnrs").set("dnrs", rt.index, rt.index, fp.bit, fp.bit+fp.prim.bits-1))
+}
+
+// inserts the low bits of rt into the word holding a bit field, leaving the bits of its other fields
+func (f *frame) emitBitsStore(p *profile, as *asm, fp fieldPath, base int, rt register) {
+	word, _ := f.registerForValue(p, "word")
+	f.emitLoad(p, as, fp.word(), base, fp.offset, word)
+	as.emit(p.find("bfm", "dnrs").set("dnrs", word.index, rt.index, (64-fp.bit)%64, fp.prim.bits-1))
+	f.emitStore(p, as, fp.word(), base, fp.offset, word)
+	f.releaseValue("word")
+}
@@ -0,0 +1,110 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// bit fields are extracted from their words with ubfm or sbfm, and inserted with bfm keeping the other bits
+func TestBitFields(t *testing.T) {
+	source := `package: t
+type: flags { kind bits:3 delta sbits:5 wide bits:12 }
+type: hdr packed { a bool b bool n byte c bool }
+type: pass { count int kind short delta int ok bool }
+function: f {
+    > flags
+    > pass
+    + pass { kind <- flags.kind delta <- flags.delta }
+}
+function: g {
+    > pass
+    > flags
+    + flags { kind <- bits:3(pass.count) delta <- 3 wide <- 7 }
+}
+function: h {
+    > hdr
+    > pass
+    + pass { ok <- hdr.b }
+}
+function: k {
+    > pass
+    > hdr
+    + hdr { a <- pass.ok n <- 1 b <- pass.ok c <- pass.ok }
+}
+`
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrb i=0 n=0 t=8", "ubfm d=8 n=8 r=0 s=2", "strh i=2 n=1 t=8", // bits 0 to 2
+			"ldrb i=0 n=0 t=8", "sbfm d=8 n=8 r=3 s=7", "str.w i=2 n=1 t=8", // bits 3 to 7, sign extended
+			"exit_f:", "ret n=30", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=0 n=0 t=8", "ldrb i=0 n=1 t=9", "bfm d=9 n=8 r=0 s=2", "strb i=0 n=1 t=9",
+			"movz d=9 h=0 i=3", "ldrb i=0 n=1 t=10", "bfm d=10 n=9 r=61 s=4", "strb i=0 n=1 t=10",
+			"movz d=9 h=0 i=7", "ldrh i=1 n=1 t=10", "bfm d=10 n=9 r=0 s=11", "strh i=1 n=1 t=10", // the next short
+			"exit_g:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"h", []string{
+			"h:",
+			"ldrb i=0 n=0 t=8", "ubfm d=8 n=8 r=1 s=1", "strb i=12 n=1 t=8",
+			"exit_h:", "ret n=30",
+		}},
+		{"k", []string{
+			"k:",
+			"ldrb i=12 n=0 t=8", "ldrb i=0 n=1 t=9", "bfm d=9 n=8 r=0 s=0", "strb i=0 n=1 t=9",
+			"ldrb i=12 n=0 t=8", "ldrb i=0 n=1 t=9", "bfm d=9 n=8 r=63 s=0", "strb i=0 n=1 t=9",
+			"movz d=9 h=0 i=1", "strb i=1 n=1 t=9",
+			"ldrb i=12 n=0 t=8", "ldrb i=2 n=1 t=9", "bfm d=9 n=8 r=0 s=0", "strb i=2 n=1 t=9", // the byte after n
+			"exit_k:", "ret n=30", "padding",
+		}},
+	}
+	listing := compileListing(t, source)
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitFieldErrors(t *testing.T) {
+	source := `package: t
+type: a { x bits:0 y bits:65 }
+type: b { x be bits:3 y [2]bits:3 }
+type: c packed { x bits:4 y bits:62 }
+type: d packed { x byte y bits:12 }
+type: e { n bits:8 legs buffer [n]e }
+type: pass { count int }
+type: flags { kind bits:3 }
+function: f {
+    > pass
+    > flags
+    + flags { kind <- pass.count }
+}
+function: g {
+    > pass
+    > flags
+    + flags { kind <- 9 }
+}
+`
+	want := []string{
+		"A100 2:18 Width of a bit field must be 1 to 64 bits: 0",
+		"A100 2:27 Width of a bit field must be 1 to 64 bits: 65",
+		"A204 3:11 Byte order can only be declared for integer fields, not bit field x",
+		"A200 3:23 Bit field y can not be a pointer, array, stream or buffer",
+		"A302 4:27 Bit field c.y can not be accessed through a single aligned word",
+		"A302 5:1 Bit field d.y can not be accessed without reaching past the end of d",
+		"A204 6:20 Length n of buffer e.legs is not an integer field of e",
+		"A204 12:15 Populating flags.kind bits:3 from pass.count int narrows, which requires an explicit cast",
+		"A204 17:15 Literal 9 does not fit flags.kind bits:3",
+	}
+	if got := diagnosticStrings(compileErrors(compileSource(t, source))); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
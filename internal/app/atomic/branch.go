@@ -0,0 +1,24 @@
+package atomic
+
+// condition codes of conditional branches and selects
+const (
+	condEQ = 0x0 // equal
+	condNE = 0x1 // not equal
+	condHS = 0x2 // unsigned higher or same
+	condLO = 0x3 // unsigned lower
+	condMI = 0x4 // negative
+	condPL = 0x5 // positive or zero
+	condVS = 0x6 // overflow
+	condVC = 0x7 // no overflow
+	condHI = 0x8 // unsigned higher
+	condLS = 0x9 // unsigned lower or same
+	condGE = 0xa // signed greater than or equal
+	condLT = 0xb // signed less than
+	condGT = 0xc // signed greater than
+	condLE = 0xd // signed less than or equal
+)
+
+// the instruction offset from the next instruction to be emitted to the target, as branches encode them
+func (a *asm) branchOffset(target int) int {
+	return target - len(a.instructions)
+}
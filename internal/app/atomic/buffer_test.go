@@ -0,0 +1,180 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+const bufferSource = `package: t
+type: leg { from short to short }
+type: booking { n int legs buffer [n]leg }
+type: at { leg int }
+type: pass { from short to short }
+function: f {
+    > booking
+    > pass
+    exit: short
+    bounds: short
+    + pass { from <- booking.legs[1].from to <- booking.legs[0].to }
+}
+function: g {
+    > booking
+    > at
+    > pass
+    exit: short
+    bounds: short
+    + pass { from <- booking.legs[at.leg].from to <- booking.legs[at.leg].to }
+}
+function: h {
+    > booking
+    > leg
+    exit: short
+    bounds: short
+    loop: 2 {
+        read: booking.legs -> leg
+    }
+}
+function: k {
+    > booking
+    > leg
+    exit: short
+    bounds: short
+    read: booking.legs -> leg
+}
+`
+
+// indexes and reads of buffers are checked against their length, taking the bounds exit, once per populate or loop
+func TestBuffers(t *testing.T) {
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=9", "subs d=31 i=1 n=9", "b.c c=12 i=3", // index 1 proves index 0
+			"add d=16 i=0 n=2", "b i=8",
+			"ldr i=1 n=0 t=8", "ldrsh i=2 n=8 t=8", "strh i=0 n=1 t=8",
+			"ldr i=1 n=0 t=8", "ldrsh i=1 n=8 t=8", "strh i=1 n=1 t=8",
+			"exit_f:", "ret n=30",
+			"slip_f:", "br n=16", "padding", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=0 n=0 t=9", "ldrsw i=0 n=1 t=10", "subs d=31 m=9 n=10 s=0", "b.c c=3 i=3", // unsigned, below the length
+			"add d=16 i=0 n=3", "b i=11",
+			"ldr i=1 n=0 t=8", "add d=8 m=10 n=8 s=2", "ldrsh i=0 n=8 t=8", "strh i=0 n=2 t=8",
+			"ldr i=1 n=0 t=8", "ldrsw i=0 n=1 t=9", "add d=8 m=9 n=8 s=2", "ldrsh i=1 n=8 t=8", "strh i=1 n=2 t=8",
+			"exit_g:", "ret n=30",
+			"slip_g:", "br n=16", "padding", "padding", "padding",
+		}},
+		{"h", []string{
+			"h:",
+			"add d=8 i=0 n=0", "ldrsw i=0 n=8 t=10", "ldr i=1 n=8 t=9",
+			"subs d=31 i=2 n=10", "b.c c=10 i=3", "add d=16 i=0 n=2", "b i=12", // both iterations
+			"ldrsw i=0 n=9 t=11", "str.w i=0 n=1 t=11", "add d=9 i=4 n=9", "sub d=10 i=1 n=10",
+			"ldrsw i=0 n=9 t=11", "str.w i=0 n=1 t=11", "add d=9 i=4 n=9", "sub d=10 i=1 n=10",
+			"str i=1 n=8 t=9", "str.w i=0 n=8 t=10",
+			"exit_h:", "ret n=30",
+			"slip_h:", "br n=16", "padding",
+		}},
+		{"k", []string{
+			"k:",
+			"add d=8 i=0 n=0", "ldrsw i=0 n=8 t=10", "ldr i=1 n=8 t=9",
+			"subs d=31 i=0 n=10", "b.c c=12 i=3", "add d=16 i=0 n=2", "b i=8",
+			"ldrsw i=0 n=9 t=11", "str.w i=0 n=1 t=11", "add d=9 i=4 n=9", "sub d=10 i=1 n=10",
+			"str i=1 n=8 t=9", "str.w i=0 n=8 t=10",
+			"exit_k:", "ret n=30",
+			"slip_k:", "br n=16", "padding",
+		}},
+	}
+	listing := compileListing(t, bufferSource)
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// compiling unchecked omits the checks
+func TestUncheckedBuffers(t *testing.T) {
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldr i=1 n=0 t=8", "ldrsh i=2 n=8 t=8", "strh i=0 n=1 t=8",
+			"ldr i=1 n=0 t=8", "ldrsh i=1 n=8 t=8", "strh i=1 n=1 t=8",
+			"exit_f:", "ret n=30", "padding",
+		}},
+		{"k", []string{
+			"k:",
+			"add d=8 i=0 n=0", "ldrsw i=0 n=8 t=10", "ldr i=1 n=8 t=9",
+			"ldrsw i=0 n=9 t=11", "str.w i=0 n=1 t=11", "add d=9 i=4 n=9", "sub d=10 i=1 n=10",
+			"str i=1 n=8 t=9", "str.w i=0 n=8 t=10",
+			"exit_k:", "ret n=30", "padding", "padding",
+		}},
+	}
+	r := Compile([]Source{{Filename: "test.atomic", Data: []byte(bufferSource)}},
+		Options{Profile: testProfile(t), Concurrency: 1, Unchecked: true})
+	if errors := compileErrors(r); len(errors) > 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(r.Files[0].Listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBufferErrors(t *testing.T) {
+	source := `package: t
+type: leg { from short to short }
+type: booking { n int f bool legs buffer [n]leg flags buffer [f]leg }
+type: pass { from short }
+function: f {
+    > booking
+    > pass
+    + pass { from <- booking.legs[1].from }
+    + pass { from <- booking.legs.from }
+}
+`
+	want := []string{
+		"A204 3:49 Length f of buffer booking.flags is not an integer field of booking",
+		"A208 8:5 Index 1 of booking.legs is bounds checked, declare the exit taken when it's out of bounds with bounds: <exit>",
+		"A204 9:14 Buffer booking.legs must be indexed to reach legs.from",
+	}
+	if got := diagnosticStrings(compileErrors(compileSource(t, source))); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// a buffer whose length isn't a field is reported once, its indexes and reads aren't checked against it
+func TestUnresolvedBufferLength(t *testing.T) {
+	source := `package: t
+type: leg { from short to short }
+type: booking { n int legs buffer [count]leg }
+type: pass { from short }
+function: f {
+    > booking
+    > pass
+    exit: short
+    bounds: short
+    + pass { from <- booking.legs[1].from }
+    + pass { from <- booking.legs[booking.n].from }
+}
+function: g {
+    > booking
+    > leg
+    read: booking.legs -> leg
+}
+`
+	want := []string{"A204 3:23 Length count of buffer booking.legs is not an integer field of booking"}
+	if got := diagnosticStrings(compileSource(t, source).Diagnostics); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,325 @@
+package atomic
+
+import "strings"
+
+// calls a function through a function pointer field of an input eg. call: ops.issue(passenger, booking.flight).
+// handlers for the exits of the function may follow in braces, exits without handlers return after the call
+type callNode struct {
+	input    string   // the input holding the function pointer
+	path     string   // field path of the function pointer within the input
+	args     []string // inputs, or structs within them, passed in the parameter registers
+	handlers []string // exits handled
+}
+
+// an argument resolved to the input it is taken from, and the struct within it
+type argument struct {
+	input string
+	field fieldPath // the struct field, unless the whole input is passed
+	whole bool
+}
+
+func (n *callNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	n.handlers = n.handlers[:0]
+	for _, s := range a.sub {
+		if h, ok := s.node.(*handlerNode); ok {
+			if contains(n.handlers, h.exit) {
+				d.errorf(codeDuplicate, s.span, "Exit %s is already handled", h.exit)
+			}
+			n.handlers = append(n.handlers, h.exit)
+		}
+	}
+	return func(f *frame, p *profile, as *asm) func() {
+		parent := f.call
+		site, ok := f.resolveCall(p, as, n)
+		if !ok {
+			// the handlers are still emitted, there is no call site for them to branch from
+			f.call = nil
+			return func() {
+				f.call = parent
+			}
+		}
+		if len(a.sub) == 0 {
+			site.patch(f, p, as)
+			return nil
+		}
+		// the handlers are emitted next, each restoring the saved registers before its statements
+		f.call = site
+		return func() {
+			site.patch(f, p, as)
+			f.call = parent
+		}
+	}
+}
+
+// resolves the function and arguments of a call, emitting it if they are valid
+func (f *frame) resolveCall(p *profile, as *asm, n *callNode) (*callSite, bool) {
+	fn, callee, ok := f.resolveFunctionPointer(n)
+	if !ok {
+		return nil, false
+	}
+	args, ok := f.resolveArguments(p, n, callee)
+	for _, h := range n.handlers {
+		if !contains(callee.exits, h) {
+			f.errorf(codeUnresolved, "Function %s has no exit %s", callee.name, h)
+			ok = false
+		}
+	}
+	if len(p.spillRegisters()) < 2 {
+		f.errorf(codeRegister, "No spill registers to call %s.%s", n.input, n.path)
+		ok = false
+	}
+	if !ok {
+		return nil, false
+	}
+	return f.emitCall(p, as, n, fn, args, callee), true
+}
+
+// returns the inputs a call reads, for computing their live ranges before emission
+func (n *callNode) uses() []string {
+	uses := append([]string{n.input}, indexInputs(n.path)...)
+	for _, arg := range n.args {
+		split := strings.SplitN(arg, ".", 2)
+		uses = append(uses, split[0])
+		if len(split) == 2 {
+			uses = append(uses, indexInputs(split[1])...)
+		}
+	}
+	return uses
+}
+
+func (f *frame) resolveFunctionPointer(n *callNode) (fieldPath, *functionNode, bool) {
+	s, ok := f.ref.structs[n.input]
+	if !ok {
+		f.errorf(codeUnresolved, "Unable to resolve struct %s", n.input)
+		return fieldPath{}, nil, false
+	}
+	if !f.hasValue(n.input) {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", n.input)
+		return fieldPath{}, nil, false
+	}
+	fn, ok := f.ref.lookup(s, n.path, f.diags, f.span)
+	if !ok {
+		return fieldPath{}, nil, false
+	}
+	callee, ok := f.ref.functions[fn.typ]
+	if _, isStruct := f.ref.structs[fn.typ]; !ok || isStruct || fn.nested {
+		f.errorf(codeType, "Field %s.%s %s is not a function pointer", n.input, n.path, typeName(fn))
+		return fieldPath{}, nil, false
+	}
+	return fn, callee, true
+}
+
+// resolves the arguments of a call, checking they are the structs the callee declares as its inputs, in order
+func (f *frame) resolveArguments(p *profile, n *callNode, callee *functionNode) ([]argument, bool) {
+	if len(n.args) != len(callee.inputs) {
+		f.errorf(codeType, "Function %s takes %d inputs (%s) but %d are passed",
+			callee.name, len(callee.inputs), strings.Join(callee.inputs, ", "), len(n.args))
+		return nil, false
+	}
+	args := make([]argument, 0, len(n.args))
+	valid := true
+	for i, text := range n.args {
+		split := strings.SplitN(text, ".", 2)
+		arg := argument{
+			input: split[0],
+			whole: len(split) == 1,
+		}
+		s, ok := f.ref.structs[arg.input]
+		if !ok || !f.hasValue(arg.input) {
+			f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", arg.input)
+			valid = false
+			continue
+		}
+		typ := arg.input
+		if !arg.whole {
+			arg.field, ok = f.ref.lookup(s, split[1], f.diags, f.span)
+			if !ok {
+				valid = false
+				continue
+			}
+			typ = arg.field.typ
+			if _, isStruct := f.ref.structs[typ]; !isStruct {
+				typ = typeName(arg.field)
+			}
+		}
+		if typ != callee.inputs[i] {
+			if !arg.whole {
+				text += " " + typ
+			}
+			f.errorf(codeType, "Argument %d of %s is %s but %s is expected", i+1, callee.name, text, callee.inputs[i])
+			valid = false
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args, valid
+}
+
+// saves the scratch registers holding values live after the call, which the callee may clobber, then
+// passes the address of each argument in its parameter register and branches to the function pointer.
+// arguments held in parameter registers already overwritten are reloaded from where they were saved.
+// arguments and exits beyond the parameter registers are stored to the bottom of the frame first, where the
+// callee finds them above its own frame
+func (f *frame) emitCall(p *profile, as *asm, n *callNode, fn fieldPath, args []argument,
+	callee *functionNode) *callSite {
+
+	sp := p.findStackRegister()
+	pr := p.layout(pointerPrimative)
+	params := p.paramRegisters()
+	if passed := len(args) + len(callee.exits); passed < len(params) {
+		params = params[:passed]
+	}
+	spills := p.spillRegisters()
+
+	// arguments held in parameter registers written by earlier arguments
+	clobbered := map[string]bool{}
+	for i, arg := range args {
+		if r, ok := f.valueRegister(arg.input); ok && i < len(params) && isRegisterOf(r, params[:i]) {
+			clobbered[r.name] = true
+		}
+	}
+	site := f.saveScratch(p, as, clobbered, false)
+
+	target := spills[1]
+	base, _ := f.loadValue(p, as, n.input, 1)
+	b := f.emitDerefs(p, as, fn, base.index, target)
+	f.emitFieldLoad(p, as, fn, b, target)
+
+	if len(args)+len(callee.exits) > len(params) {
+		// before the parameter registers are written, so none need reloading
+		stacked, _ := f.registerForValue(p, "argument")
+		for i := len(params); i < len(args)+len(callee.exits); i++ {
+			if i < len(args) {
+				f.emitArgument(p, as, args[i], stacked, site, nil)
+			} else {
+				f.emitExitAddress(p, as, site, callee.exits[i-len(args)], stacked)
+			}
+			f.emitStore(p, as, pr, sp.index, (i-len(params))*pr.size, stacked)
+		}
+		f.releaseValue("argument")
+	}
+	for i, arg := range args {
+		if i < len(params) {
+			f.emitArgument(p, as, arg, params[i], site, params[:i])
+		}
+	}
+
+	// exit addresses are encoded once the handlers have been emitted
+	for i, exit := range callee.exits {
+		if len(args)+i < len(params) {
+			f.emitExitAddress(p, as, site, exit, params[len(args)+i])
+		}
+	}
+
+	as.emit(p.findReg("blr", target.index))
+	site.returned = len(as.instructions)
+	site.restore(f, p, as)
+	return site
+}
+
+// passes the address of an argument in rt, or the pointer held by a pointer field. an argument held in a
+// parameter register already written is reloaded from where it was saved
+func (f *frame) emitArgument(p *profile, as *asm, arg argument, rt register, site *callSite, written []register) {
+	sp := p.findStackRegister()
+	pr := p.layout(pointerPrimative)
+	spills := p.spillRegisters()
+	base, _ := f.loadValue(p, as, arg.input, 0)
+	if isRegisterOf(base, written) {
+		for si, r := range site.saved {
+			if r.name == base.name {
+				f.emitLoad(p, as, pr, sp.index, f.stack.offset(site.slots[si], pr.size), spills[0])
+			}
+		}
+		base = spills[0]
+	}
+	switch {
+	case arg.whole:
+		if base.index != rt.index {
+			as.emit(p.find("add", "dni").set("dni", rt.index, base.index, 0))
+		}
+	case arg.field.nested:
+		b := f.emitDerefs(p, as, arg.field, base.index, rt)
+		f.emitOffsetAddress(p, as, b, arg.field.offset, rt)
+	default:
+		b := f.emitDerefs(p, as, arg.field, base.index, rt)
+		f.emitFieldLoad(p, as, arg.field, b, rt)
+	}
+}
+
+// passes the address of the handler of an exit in rt, encoded once the handlers have been emitted
+func (f *frame) emitExitAddress(p *profile, as *asm, site *callSite, exit string, rt register) {
+	site.exits = append(site.exits, exitAddress{
+		exit:     exit,
+		index:    len(as.instructions),
+		register: rt,
+	})
+	as.emit(0)
+}
+
+// returns the most arguments and exits a call of the function passes on the stack, beyond the parameter
+// registers, for the area at the bottom of its frame they're stored to
+func (r *reference) stackArguments(p *profile, a *ast) int {
+	most := 0
+	if n, ok := a.node.(*callNode); ok {
+		if s, ok := r.structs[n.input]; ok {
+			fn, ok := r.lookup(s, n.path, &diagnostics{}, a.span)
+			if callee, isFunction := r.functions[fn.typ]; ok && isFunction {
+				most = len(n.args) + len(callee.exits) - len(p.paramRegisters())
+			}
+		}
+	}
+	for i := range a.sub {
+		if passed := r.stackArguments(p, &a.sub[i]); passed > most {
+			most = passed
+		}
+	}
+	if most < 0 {
+		return 0
+	}
+	return most
+}
+
+// saves the scratch registers holding values which the callee may clobber, those used after the call, or by the
+// node making it if all is set, and the clobbered registers to be reloaded from where they were saved
+func (f *frame) saveScratch(p *profile, as *asm, clobbered map[string]bool, all bool) *callSite {
+	site := &callSite{
+		handlers: map[string]int{},
+	}
+	sp := p.findStackRegister()
+	pr := p.layout(pointerPrimative)
+	released := f.live.releases[f.node]
+	for _, r := range p.registers {
+		name, ok := f.allocatedValue(r)
+		if !ok || !r.scratch {
+			continue // callee saved registers are preserved by the callee
+		}
+		after := all || !contains(released, name)
+		if after || clobbered[r.name] {
+			site.saved = append(site.saved, r)
+			site.live = append(site.live, after)
+		}
+	}
+	site.slots = f.stack.saveSlots(len(site.saved))
+	for i, r := range site.saved {
+		f.emitStore(p, as, savedPrimative(p, r), sp.index, f.stack.offset(site.slots[i], pr.size), r)
+	}
+	return site
+}
+
+func isRegisterOf(r register, rs []register) bool {
+	for _, o := range rs {
+		if o.name == r.name {
+			return true
+		}
+	}
+	return false
+}
+
+// the offset of a struct held within another, added to the address of the outer struct
+func (f *frame) addressOffset(offset int) int {
+	if offset > 0xfff {
+		f.errorf(codeOffset, "Offset %d is too large to address", offset)
+		return 0
+	}
+	return offset
+}
@@ -0,0 +1,139 @@
+package atomic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCallArgumentsOnTheStack(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("package: t\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&sb, "type: t%d { v long }\n", i)
+	}
+	sb.WriteString("type: ops { wide *wide }\ntype: out { v long }\nfunction: wide {\n")
+	var args []string
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&sb, "    > t%d\n", i)
+		args = append(args, fmt.Sprintf("t%d", i))
+	}
+	sb.WriteString("    exit: odd\n    exit: even\n    + t1 { v <- t10.v }\n    slip: even\n}\n")
+	sb.WriteString("function: caller {\n    > ops\n")
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&sb, "    > t%d\n", i)
+	}
+	fmt.Fprintf(&sb, "    > out\n    call: ops.wide(%s) {\n", strings.Join(args, ", "))
+	sb.WriteString("        odd: { + out { v <- t9.v } }\n        even: { + out { v <- t10.v } }\n    }\n")
+	sb.WriteString("    + out { v <- t1.v }\n}\n")
+
+	listing := compileListing(t, sb.String())
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"caller", []string{
+			"caller:",
+			"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=48 n=31",
+			"str i=4 n=31 t=1", // t1 is saved across the call above the outgoing arguments
+			"ldr i=0 n=0 t=17",
+			// t9 and t10 from the caller's own arguments above its frame, then the addresses of both handlers
+			"ldr i=9 n=31 t=16", "add d=8 i=0 n=16", "str i=0 n=31 t=8",
+			"ldr i=10 n=31 t=16", "add d=8 i=0 n=16", "str i=1 n=31 t=8",
+			"adr d=8 i=16 l=0", "str i=2 n=31 t=8",
+			"adr d=8 i=20 l=0", "str i=3 n=31 t=8",
+			"add d=0 i=0 n=1", "add d=1 i=0 n=2", "add d=2 i=0 n=3", "add d=3 i=0 n=4",
+			"add d=4 i=0 n=5", "add d=5 i=0 n=6", "add d=6 i=0 n=7",
+			"ldr i=8 n=31 t=16", "add d=7 i=0 n=16",
+			"blr n=17",
+			"ldr i=4 n=31 t=1", "b i=12",
+			// odd, populating out from t9
+			"ldr i=4 n=31 t=1", "ldr i=11 n=31 t=16", "ldr i=9 n=31 t=17", "ldr i=0 n=17 t=8", "str i=0 n=16 t=8",
+			"b i=6",
+			// even, populating out from t10
+			"ldr i=4 n=31 t=1", "ldr i=11 n=31 t=16", "ldr i=10 n=31 t=17", "ldr i=0 n=17 t=8", "str i=0 n=16 t=8",
+			"ldr i=11 n=31 t=16", "ldr i=0 n=1 t=8", "str i=0 n=16 t=8",
+			"exit_caller:",
+			"add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30",
+		}},
+		// the callee reads t10 and the even exit from above its frame
+		{"wide", []string{
+			"wide:",
+			"ldr i=1 n=31 t=17", "ldr i=0 n=17 t=8", "str i=0 n=0 t=8",
+			"ldr i=3 n=31 t=16", "b i=2",
+			"exit_wide:", "ret n=30",
+			"slip_wide:", "br n=16", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// calls pass inputs, and structs held by or reached from them, in the parameter registers
+func TestCallThroughInputs(t *testing.T) {
+	listing := compileListing(t, callSource+`function: f {
+    > ops
+    > booking
+    > o
+    call: ops.issue(o, booking.flight)
+    call: ops.issue(o, booking.seat)
+}
+`)
+	want := []string{
+		"f:",
+		"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=32 n=31",
+		"str i=0 n=31 t=0", "str i=1 n=31 t=1", "str i=2 n=31 t=2",
+		"ldr i=0 n=0 t=17", "add d=0 i=0 n=2", "ldr i=0 n=1 t=1", "blr n=17", // the pointer booking.flight
+		"ldr i=0 n=31 t=0", "ldr i=1 n=31 t=1", "ldr i=2 n=31 t=2",
+		"ldr i=0 n=0 t=17", "add d=0 i=0 n=2", "add d=1 i=8 n=1", "blr n=17", // the address of booking.seat
+		"exit_f:",
+		"add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30",
+	}
+	if got := functionInstructions(listing, "f"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	got := compileDiagnostics(t, callSource+`function: h {
+    > ops
+    > booking
+    > o
+    call: ops.issue(o)
+    call: ops.issue(booking, o)
+    call: ops.o(o)
+    call: ops.nope(o)
+    call: ops.issue(o, booking.nope)
+}
+`)
+	want := []string{
+		"A204 15:5 Function issue takes 2 inputs (o, flight) but 1 are passed",
+		"A204 16:5 Argument 1 of issue is booking but o is expected",
+		"A204 16:5 Argument 2 of issue is o but flight is expected",
+		"A204 17:5 Field ops.o flight is not a function pointer",
+		"A202 18:5 Type ops has no field nope",
+		"A202 19:5 Type booking has no field nope",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// a function issue, called through ops.issue, with the structs passed to it
+const callSource = `package: t
+type: flight { n int }
+type: booking { flight *flight seat flight }
+type: ops { issue *issue o flight }
+type: o { r int }
+function: issue {
+    > o
+    > flight
+    + o { r <- flight.n }
+}
+`
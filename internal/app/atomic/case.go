@@ -0,0 +1,234 @@
+package atomic
+
+import "sort"
+
+// the most entries a case table may have, from the lowest value to the highest. wider cases compare the value
+// with each arm in turn
+const maxCaseTable = 1024
+
+// dispatches on an integer field eg. case: booking.seatClass { 0: { ... } 1, 2: { ... } default: { ... } }.
+// the value indexes a table of branches to the arms, values outside the table or without an arm take the
+// default arm, or continue after the case when there is none
+type caseNode struct {
+	input  string // the input holding the value
+	path   string // field path of the value within the input
+	min    int    // the lowest value of the arms
+	max    int
+	values []int // of the arms, in order
+}
+
+// an arm of a case, taken for any of its values
+type caseArmNode struct {
+	values    []int
+	otherwise bool // the default arm
+}
+
+func (n *caseNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	seen := map[int]bool{}
+	otherwise := false
+	n.min, n.max, n.values = 0, -1, nil
+	for _, s := range a.sub {
+		arm := s.node.(*caseArmNode)
+		if arm.otherwise {
+			if otherwise {
+				d.errorf(codeDuplicate, s.span, "Case already has a default")
+			}
+			otherwise = true
+		}
+		for _, v := range arm.values {
+			if seen[v] {
+				d.errorf(codeDuplicate, s.span, "Case value %d is already handled", v)
+			}
+			if len(seen) == 0 || v < n.min {
+				n.min = v
+			}
+			if len(seen) == 0 || v > n.max {
+				n.max = v
+			}
+			seen[v] = true
+			n.values = append(n.values, v)
+		}
+	}
+	sort.Ints(n.values)
+	return func(f *frame, p *profile, as *asm) func() {
+		parent := f.dispatch
+		site, ok := f.emitDispatch(p, as, n)
+		f.dispatch = site
+		if !ok {
+			f.dispatch = nil // the arms are still emitted, there is no table for them
+		}
+		return func() {
+			if ok {
+				site.patch(p, as)
+			}
+			f.dispatch = parent
+		}
+	}
+}
+
+func (n *caseArmNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		site := f.dispatch
+		if site == nil {
+			return nil
+		}
+		if site.started {
+			// the previous arm continues after the case
+			site.branches = append(site.branches, len(as.instructions))
+			as.emit(0)
+		}
+		site.started = true
+		for _, v := range n.values {
+			site.arms[v] = len(as.instructions)
+		}
+		if n.otherwise {
+			site.otherwise = len(as.instructions)
+		}
+		return nil
+	}
+}
+
+// a case being emitted, whose table is encoded once its arms have been
+type caseSite struct {
+	min       int
+	table     int          // index of the table of branches
+	entries   int          // from the lowest value to the highest
+	outside   int          // index of the branch taken by values outside the table
+	arms      map[int]int  // values to the index of their arm
+	otherwise int          // index of the default arm, or -1
+	branches  []int        // indexes of branches to the end of the case
+	started   bool         // an arm has been emitted, the table branches to the first
+	chain     []caseBranch // compares branching to the arms of a switch in turn, rather than a table
+	// the variant a switch is on, whose arms hold the address of their member
+	variant *structNode
+	input   string
+	field   fieldPath
+}
+
+// a conditional branch to the arm of a value, taken when the value compared before it is equal
+type caseBranch struct {
+	value int
+	index int
+}
+
+// loads the value into a spill register and branches through the table, or to the default for values outside it.
+// values spanning more than a table compare with each arm in turn
+func (f *frame) emitDispatch(p *profile, as *asm, n *caseNode) (*caseSite, bool) {
+	s, ok := f.ref.structs[n.input]
+	if !ok || !f.hasValue(n.input) {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", n.input)
+		return nil, false
+	}
+	fp, ok := f.ref.lookup(s, n.path, f.diags, f.span)
+	if !ok {
+		return nil, false
+	}
+	if !fp.prim.integer || fp.typ != "" {
+		f.errorf(codeType, "Case on %s.%s %s requires an integer", n.input, n.path, typeName(fp))
+		return nil, false
+	}
+	spills := p.spillRegisters()
+	if len(spills) < 2 {
+		f.errorf(codeRegister, "No spill registers for case on %s.%s", n.input, n.path)
+		return nil, false
+	}
+	site := &caseSite{
+		min:       n.min,
+		entries:   n.max - n.min + 1,
+		arms:      map[int]int{},
+		otherwise: -1,
+	}
+	value, table := spills[0], spills[1]
+	zr := p.findStackRegister().index // the zero register, discarding the result of a compare, shares its encoding
+
+	base, _ := f.loadValue(p, as, n.input, 0)
+	b := f.emitDerefs(p, as, fp, base.index, value)
+	f.emitFieldLoad(p, as, fp, b, value)
+	if site.entries <= 0 {
+		// no values, only a default
+		site.outside = len(as.instructions)
+		as.emit(0)
+		return site, true
+	}
+	if site.entries > maxCaseTable {
+		site.entries = 0
+		f.emitChain(p, as, site, value, table, n.values)
+		return site, true
+	}
+	// the lowest value is subtracted as an immediate, or through a literal in the table register
+	switch {
+	case n.min > 0 && n.min <= 0xfff:
+		as.emit(p.find("sub", "dni").set("dni", value.index, value.index, n.min))
+	case n.min < 0 && -n.min <= 0xfff:
+		as.emit(p.find("add", "dni").set("dni", value.index, value.index, -n.min))
+	case n.min != 0:
+		for _, ins := range moveImmediate(p, table, uint64(n.min)) {
+			as.emit(ins)
+		}
+		as.emit(p.find("sub", "dmns").set("dmns", value.index, table.index, value.index, 0))
+	}
+	// values below the lowest wrap to large unsigned values, so one unsigned compare bounds the table
+	as.emit(p.find("subs", "dni").set("dni", zr, value.index, site.entries-1))
+	site.outside = len(as.instructions)
+	as.emit(0)
+	as.emit(adr(p, table, len(as.instructions), len(as.instructions)+3))
+	as.emit(p.find("add", "dmns").set("dmns", table.index, value.index, table.index, 2))
+	as.emit(p.findReg("br", table.index))
+	site.table = len(as.instructions)
+	for i := 0; i < site.entries; i++ {
+		as.emit(0)
+	}
+	return site, true
+}
+
+// compares the value with each of the values in turn, branching to their arms when equal, then to the default.
+// values which aren't immediates are moved into the scratch register
+func (f *frame) emitChain(p *profile, as *asm, site *caseSite, value register, scratch register, values []int) {
+	zr := p.findStackRegister().index
+	for _, v := range values {
+		if v >= 0 && v <= 0xfff {
+			as.emit(p.find("subs", "dni").set("dni", zr, value.index, v))
+		} else {
+			for _, ins := range moveImmediate(p, scratch, uint64(v)) {
+				as.emit(ins)
+			}
+			as.emit(p.find("subs", "dmns").set("dmns", zr, scratch.index, value.index, 0))
+		}
+		site.chain = append(site.chain, caseBranch{value: v, index: len(as.instructions)})
+		as.emit(0)
+	}
+	site.outside = len(as.instructions)
+	as.emit(0)
+}
+
+// encodes the table, the bounds check and the branches from each arm to the end of the case
+func (c *caseSite) patch(p *profile, as *asm) {
+	end := len(as.instructions)
+	otherwise := c.otherwise
+	if otherwise < 0 {
+		otherwise = end
+	}
+	if c.entries <= 0 {
+		as.instructions[c.outside] = p.find("b", "i").set("i", otherwise-c.outside)
+	} else {
+		as.instructions[c.outside] = p.find("b.c", "ci").set("ci", condHI, otherwise-c.outside)
+	}
+	for i := 0; i < c.entries; i++ {
+		target, ok := c.arms[c.min+i]
+		if !ok {
+			target = otherwise
+		}
+		index := c.table + i
+		as.instructions[index] = p.find("b", "i").set("i", target-index)
+	}
+	for _, b := range c.chain {
+		target, ok := c.arms[b.value]
+		if !ok {
+			target = otherwise
+		}
+		as.instructions[b.index] = p.find("b.c", "ci").set("ci", condEQ, target-b.index)
+	}
+	for _, b := range c.branches {
+		as.instructions[b] = p.find("b", "i").set("i", end-b)
+	}
+}
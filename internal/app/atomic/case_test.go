@@ -0,0 +1,94 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// values close together branch through a table of branches to their arms, indexed by the value less the lowest,
+// and values spread further apart are compared in turn. values without an arm take the default, or continue
+func TestCaseValues(t *testing.T) {
+	tests := []struct {
+		name string
+		arms string
+		want []string // instructions of f
+	}{
+		{"small values", "1: { + o { r <- 1 } } 3: { + o { r <- 2 } }", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=16", "sub d=16 i=1 n=16", "subs d=31 i=2 n=16", "b.c c=8 i=12", // above 3 continues
+			"adr d=17 i=3 l=0", "add d=17 m=16 n=17 s=2", "br n=17",
+			"b i=3", "b i=7", "b i=4", // 1, 2 continues, 3
+			"movz d=9 h=0 i=1", "str.w i=1 n=0 t=9", "b i=3",
+			"movz d=9 h=0 i=2", "str.w i=1 n=0 t=9",
+			"exit_f:", "ret n=30",
+		}},
+		{"large values", "5000: { + o { r <- 1 } } 5001: { + o { r <- 2 } }", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=16", "movz d=17 h=0 i=5000", "sub d=16 m=17 n=16 s=0", "subs d=31 i=1 n=16", "b.c c=8 i=11",
+			"adr d=17 i=3 l=0", "add d=17 m=16 n=17 s=2", "br n=17",
+			"b i=2", "b i=4",
+			"movz d=9 h=0 i=1", "str.w i=1 n=0 t=9", "b i=3",
+			"movz d=9 h=0 i=2", "str.w i=1 n=0 t=9",
+			"exit_f:", "ret n=30",
+		}},
+		{"negative values", "-5000: { + o { r <- 1 } } -4998: { + o { r <- 2 } }", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=16", "movn d=17 h=0 i=4999", "sub d=16 m=17 n=16 s=0", "subs d=31 i=2 n=16", "b.c c=8 i=12",
+			"adr d=17 i=3 l=0", "add d=17 m=16 n=17 s=2", "br n=17",
+			"b i=3", "b i=7", "b i=4",
+			"movz d=9 h=0 i=1", "str.w i=1 n=0 t=9", "b i=3",
+			"movz d=9 h=0 i=2", "str.w i=1 n=0 t=9",
+			"exit_f:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"values spanning more than a table", "-7000: { + o { r <- 1 } } 5: { + o { r <- 2 } } 5000: { + o { r <- 3 } }", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=16",
+			"movn d=17 h=0 i=6999", "subs d=31 m=17 n=16 s=0", "b.c c=0 i=7",
+			"subs d=31 i=5 n=16", "b.c c=0 i=8",
+			"movz d=17 h=0 i=5000", "subs d=31 m=17 n=16 s=0", "b.c c=0 i=8",
+			"b i=9",
+			"movz d=9 h=0 i=1", "str.w i=1 n=0 t=9", "b i=6",
+			"movz d=9 h=0 i=2", "str.w i=1 n=0 t=9", "b i=3",
+			"movz d=9 h=0 i=3", "str.w i=1 n=0 t=9",
+			"exit_f:", "ret n=30", "padding",
+		}},
+		{"several values of an arm and a default", "0, 2: { + o { r <- 1 } } default: { + o { r <- 2 } }", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=16", "subs d=31 i=2 n=16", "b.c c=8 i=10", // above 2 takes the default
+			"adr d=17 i=3 l=0", "add d=17 m=16 n=17 s=2", "br n=17",
+			"b i=3", "b i=5", "b i=1", // 0, 1 the default, 2
+			"movz d=9 h=0 i=1", "str.w i=1 n=0 t=9", "b i=3",
+			"movz d=9 h=0 i=2", "str.w i=1 n=0 t=9",
+			"exit_f:", "ret n=30", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing := compileListing(t, "package: t\ntype: o { c int r int }\nfunction: f {\n    > o\n    case: o.c { "+tt.arms+" }\n}\n")
+			if got := functionInstructions(listing, "f"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaseErrors(t *testing.T) {
+	got := compileDiagnostics(t, `package: t
+type: o { c int r int d double }
+function: g {
+    > o
+    case: o.c { 1: { + o { c <- 0 r <- 1 d <- 0 } } 1: { } default: { } default: { } }
+    case: o.d { 1: { } }
+    case: o.x { 1: { } }
+}
+`)
+	want := []string{
+		"A201 5:53 Case value 1 is already handled",
+		"A201 5:73 Case already has a default",
+		"A204 6:5 Case on o.d double requires an integer",
+		"A202 7:5 Type o has no field x",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
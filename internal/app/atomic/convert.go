@@ -0,0 +1,118 @@
+package atomic
+
+import "strconv"
+
+// how a source field is converted to the type of the target field it populates
+type conversion int
+
+const (
+	conversionNone       conversion = iota // the types are incompatible
+	conversionCopy                         // loads extend and stores truncate, so no further instructions are needed
+	conversionIntToFloat                   // scvtf
+	conversionFloatToInt                   // fcvtzs, rounding toward zero
+)
+
+// returns the conversion from a source field to a target field, and whether it narrows, losing range or precision.
+// integers widen to integers with more bits of value, and to doubles up to 32 bits as a double holds them exactly.
+// enums hold their own members, so any other value narrows to them
+func conversionOf(from fieldPath, to fieldPath) (conversion, bool) {
+	fp, tp := from.prim, to.prim
+	switch {
+	case from.nested || to.nested: // structs and arrays held by value
+		return conversionNone, false
+	case to.enum != "" && from.enum != to.enum && (fp.integer || fp.float):
+		c, _ := conversionOf(from, fieldPath{prim: tp})
+		return c, true
+	case fp.integer && tp.integer:
+		return conversionCopy, valueBits(tp) < valueBits(fp) || (fp.signed && !tp.signed)
+	case fp.integer && tp.float:
+		return conversionIntToFloat, fp.width() > 32
+	case fp.float && tp.integer:
+		return conversionFloatToInt, true
+	case fp.float && tp.float:
+		return conversionCopy, tp.size < fp.size
+	case fp.name != tp.name:
+		return conversionNone, false
+	case from.typ != to.typ: // pointers to different structs
+		return conversionNone, false
+	}
+	return conversionCopy, false
+}
+
+// checks a source field may populate a target field, reporting incompatible conversions, and narrowing
+// conversions unless they are explicitly cast
+func (f *frame) checkConversion(at span, from populateSource, target string, to fieldPath, cast bool) (conversion, bool) {
+	c, narrowing := conversionOf(from.field, to)
+	if c == conversionNone {
+		f.diags.errorf(codeType, at, "Can not populate %s.%s %s from %s.%s %s",
+			target, to.path, typeName(to), from.name, from.field.path, typeName(from.field))
+		return c, false
+	}
+	if narrowing && !cast && to.enum != "" && from.field.enum != to.enum {
+		f.diags.errorf(codeType, at, "Populating %s.%s %s from %s.%s %s may not be a member, which requires an explicit cast",
+			target, to.path, typeName(to), from.name, from.field.path, typeName(from.field))
+		return c, false
+	}
+	if narrowing && !cast {
+		f.diags.errorf(codeType, at, "Populating %s.%s %s from %s.%s %s narrows, which requires an explicit cast",
+			target, to.path, typeName(to), from.name, from.field.path, typeName(from.field))
+		return c, false
+	}
+	return c, true
+}
+
+// returns the bits of an integer holding its magnitude, excluding any sign
+func valueBits(pr primative) int {
+	if pr.signed {
+		return pr.width() - 1
+	}
+	return pr.width()
+}
+
+func typeName(fp fieldPath) string {
+	switch {
+	case fp.stream && fp.capacity > 0:
+		return "stream [" + strconv.Itoa(fp.capacity) + "]" + fp.element
+	case fp.buffer:
+		return "buffer " + fp.element
+	case fp.stream:
+		return "stream " + fp.element
+	case fp.length > 0:
+		return "[" + strconv.Itoa(fp.length) + "]" + fp.element
+	case fp.enum != "":
+		return fp.enum
+	case fp.nested:
+		return fp.typ
+	case fp.typ != "":
+		return "*" + fp.typ
+	case fp.prim.bits > 0 && !fp.prim.boolean:
+		return fp.prim.name + ":" + strconv.Itoa(fp.prim.bits)
+	}
+	return fp.prim.name
+}
+
+// copies a source field to a target field, converting between representations through the tmp registers
+func (f *frame) emitConversion(p *profile, as *asm, c conversion, from fieldPath, fromBase int, to fieldPath, toBase int,
+	tmp register, ftmp register) {
+
+	switch c {
+	case conversionIntToFloat:
+		f.emitFieldLoad(p, as, from, fromBase, tmp)
+		as.emit(p.findFloat("scvtf", "dn").set("dn", ftmp.index, tmp.index))
+		f.emitFieldStore(p, as, to, toBase, ftmp)
+	case conversionFloatToInt:
+		f.emitFieldLoad(p, as, from, fromBase, ftmp)
+		as.emit(p.findFloat("fcvtzs", "dn").set("dn", tmp.index, ftmp.index))
+		f.emitFieldStore(p, as, to, toBase, tmp)
+	default:
+		r := tmp
+		if from.prim.float {
+			r = ftmp
+		}
+		if from.swapped() && to.swapped() && from.order == to.order && from.prim.size == to.prim.size {
+			from.order, to.order = "", "" // the bytes are already in the order of the target
+		}
+		f.emitFieldLoad(p, as, from, fromBase, r)
+		f.emitFieldStore(p, as, to, toBase, r)
+	}
+}
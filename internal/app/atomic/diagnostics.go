@@ -0,0 +1,144 @@
+package atomic
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+type severity int
+
+const (
+	severityError severity = iota
+	severityWarning
+)
+
+var severityNames = map[severity]string{
+	severityError:   "error",
+	severityWarning: "warning",
+}
+
+func (s severity) String() string {
+	return severityNames[s]
+}
+
+// diagnostic codes, grouped by compiler phase
+const (
+	codeSyntax      = "A100" // parsing
+	codeUnknownType = "A200" // resolution
+	codeDuplicate   = "A201"
+	codeUnresolved  = "A202"
+	codeRecursive   = "A203"
+	codeType        = "A204"
+	codeAmbiguous   = "A205"
+	codeUnpopulated = "A206"
+	codeBounds      = "A208"
+	codeRegister    = "A300" // code generation
+	codeInstruction = "A301"
+	codeOffset      = "A302"
+	codeProfile     = "A400" // profile loading
+	codeIO          = "A500" // reading and writing files
+)
+
+type diagnostic struct {
+	severity severity
+	code     string
+	span     span
+	message  string
+}
+
+func (d diagnostic) String() string {
+	if d.span.start.filename == "" {
+		return fmt.Sprintf("%s %s: %s", d.severity, d.code, d.message)
+	}
+	return fmt.Sprintf("%s: %s %s: %s", d.span, d.severity, d.code, d.message)
+}
+
+// collects errors and warnings from all compiler phases, safe for use by concurrent goroutines
+type diagnostics struct {
+	mutex sync.Mutex
+	list  []diagnostic
+}
+
+func (d *diagnostics) add(sev severity, code string, s span, format string, a ...interface{}) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.list = append(d.list, diagnostic{
+		severity: sev,
+		code:     code,
+		span:     s,
+		message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (d *diagnostics) errorf(code string, s span, format string, a ...interface{}) {
+	d.add(severityError, code, s, format, a...)
+}
+
+func (d *diagnostics) warnf(code string, s span, format string, a ...interface{}) {
+	d.add(severityWarning, code, s, format, a...)
+}
+
+// adds the diagnostics collected by another, eg. for a function once it is compiled
+func (d *diagnostics) addAll(o *diagnostics) {
+	list := o.sorted()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.list = append(d.list, list...)
+}
+
+func (d *diagnostics) count(sev severity) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	n := 0
+	for _, dg := range d.list {
+		if dg.severity == sev {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *diagnostics) hasErrors() bool {
+	return d.count(severityError) > 0
+}
+
+// returns the diagnostics ordered by file and position, so reports are stable regardless of goroutine scheduling
+func (d *diagnostics) sorted() []diagnostic {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	list := make([]diagnostic, len(d.list))
+	copy(list, d.list)
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].span.start, list[j].span.start
+		if a.filename != b.filename {
+			return a.filename < b.filename
+		}
+		if a.line != b.line {
+			return a.line < b.line
+		}
+		return a.col < b.col
+	})
+	return list
+}
+
+// writes all diagnostics and a summary, returning true if there were any errors
+func (d *diagnostics) report(w io.Writer) bool {
+	list := d.sorted()
+	if len(list) == 0 {
+		return false
+	}
+	errors := d.count(severityError)
+	warnings := len(list) - errors
+
+	fmt.Fprintln(w)
+	if errors > 0 {
+		fmt.Fprintln(w, "Atomic Shenanigans:")
+	}
+	for _, dg := range list {
+		fmt.Fprintln(w, dg)
+	}
+	fmt.Fprintf(w, "\n%d error(s), %d warning(s)\n\n", errors, warnings)
+	return errors > 0
+}
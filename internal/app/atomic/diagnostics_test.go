@@ -0,0 +1,109 @@
+package atomic
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// parsing and resolution continue past errors, reporting each with its code and position
+func TestDiagnosticsRecovered(t *testing.T) {
+	source := `package: t
+type: a { x nothing y int }
+type: a { z int }
+type: b { c int ) d int }
+function: f {
+    > a
+    > q
+    + a { y <- 1 }
+    wobble
+}
+function: g {
+    > b
+    + b { c <- 1 }
+}
+`
+	want := []string{
+		"A200 2:11 Unknown type nothing",
+		"A201 3:1 Duplicate struct definition: a",
+		"A100 4:17 Field name must start with a letter: )",
+		"A202 7:5 Unable to resolve struct q",
+		"A100 9:5 Unknown function token: wobble",
+	}
+	if got := compileDiagnostics(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// parsing recovers at constants and enums declared after an error, so their uses still resolve
+func TestRecoveryAtDeclarations(t *testing.T) {
+	source := `package: t
+wobble 1 2
+const: limit 5
+wobble
+enum: colour byte { red green }
+type: o { r int k colour }
+function: f {
+    > o
+    + o { r <- limit k <- colour.red }
+}
+`
+	want := []string{
+		"A100 2:1 Unknown base token: wobble",
+		"A100 4:1 Unknown base token: wobble",
+	}
+	if got := compileDiagnostics(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// diagnostics added concurrently are reported in source order, followed by a summary
+func TestDiagnosticsReport(t *testing.T) {
+	at := func(filename string, line int, col int) span {
+		p := position{filename: filename, line: line, col: col}
+		return span{start: p, end: p}
+	}
+	d := &diagnostics{}
+	var wg sync.WaitGroup
+	for _, add := range []func(){
+		func() { d.warnf(codeUnpopulated, at("b.atomic", 2, 4), "Field %s is not populated", "o.r") },
+		func() { d.errorf(codeType, at("a.atomic", 9, 1), "Operator %s requires integers", "%") },
+		func() { d.errorf(codeSyntax, at("a.atomic", 3, 7), "Unknown base token: %s", "wobble") },
+		func() { d.errorf(codeSyntax, at("a.atomic", 3, 2), "Expected '%s' but found %s", "{", "end of file") },
+	} {
+		wg.Add(1)
+		go func(add func()) {
+			defer wg.Done()
+			add()
+		}(add)
+	}
+	wg.Wait()
+
+	var out bytes.Buffer
+	if !d.report(&out) {
+		t.Error("report returned no errors")
+	}
+	want := `
+Atomic Shenanigans:
+a.atomic:3:2: error A100: Expected '{' but found end of file
+a.atomic:3:7: error A100: Unknown base token: wobble
+a.atomic:9:1: error A204: Operator % requires integers
+b.atomic:2:4: warning A206: Field o.r is not populated
+
+3 error(s), 1 warning(s)
+
+`
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+
+	warnings := &diagnostics{}
+	warnings.warnf(codeUnpopulated, at("a.atomic", 1, 1), "Field o.r is not populated")
+	if warnings.report(&bytes.Buffer{}) {
+		t.Error("report of warnings returned errors")
+	}
+	if (&diagnostics{}).report(&out) {
+		t.Error("report of no diagnostics returned errors")
+	}
+}
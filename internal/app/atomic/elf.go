@@ -3,8 +3,7 @@ package atomic
 import (
 	"bufio"
 	"bytes"
-	"log"
-	"os"
+	"io"
 )
 
 // elf 64 object format for linux
@@ -102,14 +101,8 @@ var sectionStringTable, sectionStringIndexes = buildStringTable([]string{
 	".text", ".symtab", ".strtab", ".shstrtab",
 })
 
-func writeObjectFileElf(filename string, asms []asm) {
-	file, err := os.Create(filename)
-	defer file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	buffer := bufio.NewWriter(file)
+func writeObjectElf(w io.Writer, asms []asm) {
+	buffer := bufio.NewWriter(w)
 
 	stringTable, stringIndexes := buildAsmStringTable(asms)
 
@@ -192,11 +185,11 @@ func writeObjectFileElf(filename string, asms []asm) {
 		flags:       SHF_ALLOC | SHF_EXECINSTR,
 		addr:        0,
 		offset:      SIZEOF_ELF64HEADER,
-		size:        uint64(symbolCount * SIZEOF_ELF64SYMBOL),
+		size:        uint64(asmBlockSize),
 		link:        0,
 		info:        0,
 		addralign:   8,
-		entsize:     SIZEOF_ELF64SYMBOL,
+		entsize:     0,
 	}
 	writeStruct(buffer, asmSection)
 
@@ -0,0 +1,101 @@
+package atomic
+
+import "strconv"
+
+// named values of an integer primative eg. enum: seatClass byte { economy premium business = 5 first }
+// usable as a field type. fields of the enum hold only its members, unless cast
+type enumNode struct {
+	name    string
+	typ     string // the primative holding the values
+	prim    primative
+	members []enumMember
+}
+
+type enumMember struct {
+	name  string
+	value int64
+}
+
+// members are numbered from zero, or from the value of the previous member declaring one
+type enumMemberNode struct {
+	name  string
+	value int64
+}
+
+// the primative and members are laid out by reference.layout once the enums of all units are known
+func (n *enumNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return nil
+}
+
+func (n *enumMemberNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return nil
+}
+
+// resolves the primative of an enum from the profile, as fields are, checking its members fit it
+func (r reference) layoutEnum(p *profile, name string, d *diagnostics) {
+	e := r.enums[name]
+	decl := r.declarations[name]
+	pr, ok := p.primative(e.typ)
+	if !ok || !pr.integer {
+		d.errorf(codeUnknownType, decl.span, "Enum %s must be of an integer primative, not %s", name, e.typ)
+		return
+	}
+	e.prim = pr
+	e.members = e.members[:0]
+	for _, ma := range decl.sub {
+		m, ok := ma.node.(*enumMemberNode)
+		if !ok {
+			continue
+		}
+		if _, dupe := e.value(m.name); dupe {
+			d.errorf(codeDuplicate, ma.span, "Enum %s already has a member %s", name, m.name)
+			continue
+		}
+		if !literalFits(strconv.FormatInt(m.value, 10), pr) {
+			d.errorf(codeType, ma.span, "Value %d of %s.%s does not fit %s", m.value, name, m.name, e.typ)
+			continue
+		}
+		e.members = append(e.members, enumMember{
+			name:  m.name,
+			value: m.value,
+		})
+	}
+}
+
+// returns the value of a member by name
+func (n *enumNode) value(name string) (int64, bool) {
+	for _, m := range n.members {
+		if m.name == name {
+			return m.value, true
+		}
+	}
+	return 0, false
+}
+
+// returns true if a literal is the value of a member
+func (n *enumNode) isMember(literal string) bool {
+	v, err := parseInteger(literal)
+	if err != nil {
+		return false
+	}
+	for _, m := range n.members {
+		if m.value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// resolves a member of an enum referenced as enum.member. returns a nil enum if the name is not an enum,
+// or false if it has no such member
+func (f *frame) enumMember(enum string, member string, at span) (*enumNode, int64, bool) {
+	e, ok := f.ref.enums[enum]
+	if !ok {
+		return nil, 0, false
+	}
+	v, ok := e.value(member)
+	if !ok {
+		f.diags.errorf(codeUnresolved, at, "Enum %s has no member %s", enum, member)
+	}
+	return e, v, ok
+}
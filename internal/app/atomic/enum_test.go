@@ -0,0 +1,106 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// structs and enums share their names, whichever is declared first
+func TestEnumAndStructNames(t *testing.T) {
+	got := diagnosticStrings(compileErrors(compileSource(t, `package: t
+enum: colour byte { red green }
+type: colour { r int }
+type: shade { r int }
+enum: shade byte { dark }
+type: o { c colour s shade }
+`)))
+	want := []string{
+		"A201 3:1 Duplicate struct definition: colour",
+		"A201 5:1 Duplicate enum definition: shade",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// members load as their values, fields of an enum copy with the width of its primative, and other values
+// populate them through a cast
+func TestEnums(t *testing.T) {
+	listing := compileListing(t, `package: t
+enum: seat short { economy premium business = 5 first }
+type: src { c seat i int }
+type: o { c seat d seat r int }
+function: f {
+    > src
+    > o
+    + o { c <- seat.first d <- src.c r <- 0 }
+    when: src.c == seat.business { + o { d <- 1 r <- 1 } }
+}
+function: g {
+    > src
+    > o
+    + o { c <- seat(src.i) d <- 5 r <- src.c }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"movz d=9 h=0 i=6", "strh i=0 n=1 t=9", // first follows business = 5
+			"ldrsh i=0 n=0 t=8", "strh i=1 n=1 t=8",
+			"movz d=9 h=0 i=0", "str.w i=1 n=1 t=9",
+			"ldrsh i=0 n=0 t=16", "subs d=31 i=5 n=16", "b.c c=1 i=7",
+			"ldrsh i=0 n=0 t=8", "strh i=0 n=1 t=8",
+			"movz d=9 h=0 i=1", "strh i=1 n=1 t=9",
+			"movz d=9 h=0 i=1", "str.w i=1 n=1 t=9",
+			"exit_f:", "ret n=30",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=1 n=0 t=8", "strh i=0 n=1 t=8",
+			"movz d=9 h=0 i=5", "strh i=1 n=1 t=9",
+			"ldrsh i=0 n=0 t=8", "str.w i=1 n=1 t=8", // members widen to integers
+			"exit_g:", "ret n=30", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// values which may not be members are errors without a cast, as are comparisons with them
+func TestEnumErrors(t *testing.T) {
+	got := diagnosticStrings(compileErrors(compileSource(t, `package: t
+enum: seat short { economy premium business = 5 first }
+enum: meal byte { veg fish }
+type: src { c seat i int m meal }
+type: o { c seat d seat r int }
+function: f {
+    > src
+    > o
+    + o { c <- 3 d <- src.i r <- 0 }
+    + o { c <- meal.veg d <- src.m r <- 0 }
+    + o { c <- seat.nope d <- 1 r <- 0 }
+    when: src.c == 3 { + o { r <- 1 } }
+    when: src.c == meal.fish { + o { r <- 1 } }
+}
+`)))
+	want := []string{
+		"A204 9:11 Literal 3 is not a member of enum seat",
+		"A204 9:18 Populating o.d seat from src.i int may not be a member, which requires an explicit cast",
+		"A204 10:11 Populating o.c seat from an expression of meal narrows, which requires an explicit cast",
+		"A204 10:25 Populating o.d seat from src.m meal may not be a member, which requires an explicit cast",
+		"A202 11:11 Enum seat has no member nope",
+		"A204 12:5 Can not compare src.c seat with 3, which is not a member",
+		"A204 13:5 Can not compare src.c seat with a member of meal",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
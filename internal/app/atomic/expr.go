@@ -0,0 +1,663 @@
+package atomic
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// an arithmetic expression populating a field eg. total <- fare.base + fare.tax * 2
+// operators take their operands from the subs, and constant sub-expressions are folded as the ast is resolved
+type exprNode struct {
+	op      string // a binary operator, neg, ~ or cast. empty for a field or literal
+	input   string // the input of a field
+	path    string // field path within the input
+	literal string // a literal number, a double if it has a fraction
+	cast    string // the type converted to by a cast
+	failed  bool   // folding reported an error, so typing doesn't report it again
+}
+
+// binary operators by precedence, as in go
+var precedence = map[string]int{
+	"|": 1, "^": 1, "+": 1, "-": 1,
+	"*": 2, "/": 2, "%": 2, "<<": 2, ">>": 2, "&": 2,
+}
+
+// operators which only apply to integers
+var integerOperators = map[string]bool{"%": true, "&": true, "|": true, "^": true, "<<": true, ">>": true, "~": true}
+
+// integer operators taking registers, with madd for * as there is no separate multiply
+var integerInstructions = map[string]string{"+": "add", "-": "sub", "&": "and", "|": "orr", "^": "eor"}
+var floatInstructions = map[string]string{"+": "fadd", "-": "fsub", "*": "fmul", "/": "fdiv"}
+
+// casts aren't folded, as the size of the type they convert to depends on the profile
+func (n *exprNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	if n.op == "" || n.op == "cast" {
+		return nil
+	}
+	var operands []string
+	for _, s := range a.sub {
+		o, ok := s.node.(*exprNode)
+		if !ok || o.literal == "" {
+			return nil
+		}
+		operands = append(operands, o.literal)
+	}
+	literal, ok, reported := foldLiterals(n.op, operands, d, a.span)
+	if ok {
+		a.node = &exprNode{literal: literal}
+		a.sub = nil
+	}
+	n.failed = reported
+	return nil
+}
+
+// computes an operator on literals, as integers unless one of them is a double. booleans and strings aren't folded.
+// returns true if the operator couldn't fold and reported why
+func foldLiterals(op string, operands []string, d *diagnostics, at span) (string, bool, bool) {
+	ints := make([]int64, len(operands))
+	floats := make([]float64, len(operands))
+	integer := true
+	for i, o := range operands {
+		if v, err := parseInteger(o); err == nil {
+			ints[i], floats[i] = v, float64(v)
+			continue
+		}
+		v, err := strconv.ParseFloat(o, 64)
+		if err != nil {
+			return "", false, false // reported when the expression is typed
+		}
+		floats[i] = v
+		integer = false
+	}
+	if integer {
+		v, ok := foldInts(op, ints)
+		if !ok {
+			d.errorf(codeType, at, "Division by zero")
+		}
+		return strconv.FormatInt(v, 10), ok, !ok
+	}
+	if integerOperators[op] {
+		d.errorf(codeType, at, "Operator %s requires integers", op)
+		return "", false, true
+	}
+	return floatLiteral(foldFloats(op, floats)), true, false
+}
+
+// folds integers as the instructions compute them, wrapping at 64 bits with shifts taken modulo 64
+func foldInts(op string, v []int64) (int64, bool) {
+	switch op {
+	case "neg":
+		return -v[0], true
+	case "~":
+		return ^v[0], true
+	case "+":
+		return v[0] + v[1], true
+	case "-":
+		return v[0] - v[1], true
+	case "*":
+		return v[0] * v[1], true
+	case "/":
+		if v[1] == 0 {
+			return 0, false
+		}
+		return v[0] / v[1], true
+	case "%":
+		if v[1] == 0 {
+			return 0, false
+		}
+		return v[0] % v[1], true
+	case "&":
+		return v[0] & v[1], true
+	case "|":
+		return v[0] | v[1], true
+	case "^":
+		return v[0] ^ v[1], true
+	case "<<":
+		return v[0] << (uint64(v[1]) & 63), true
+	}
+	return v[0] >> (uint64(v[1]) & 63), true
+}
+
+func foldFloats(op string, v []float64) float64 {
+	switch op {
+	case "neg":
+		return -v[0]
+	case "+":
+		return v[0] + v[1]
+	case "-":
+		return v[0] - v[1]
+	case "*":
+		return v[0] * v[1]
+	}
+	return v[0] / v[1]
+}
+
+// formats a double so it doesn't read back as an integer
+func floatLiteral(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if _, err := parseInteger(s); err == nil {
+		s += ".0"
+	}
+	return s
+}
+
+// the type of the value of an expression
+type exprType struct {
+	prim    primative
+	untyped bool   // an integer literal, taking the type of what it is combined with
+	enum    string // a field or member of an enum, operators on them compute integers
+}
+
+// an expression being emitted, with the types and fields or enum members of its nodes
+type evaluation struct {
+	types   map[*ast]exprType
+	fields  map[*ast]fieldPath
+	members map[*ast]int64
+	temps   int
+}
+
+// a value computed into a temporary register
+type exprValue struct {
+	r    register
+	name string
+}
+
+// computes an expression and stores it to the target field, with its width. narrowing the result requires the
+// whole expression to be cast to the type of the field
+func (f *frame) emitExpression(p *profile, as *asm, m mapping, target string, to fieldPath, base int) {
+	e := &evaluation{
+		types:   map[*ast]exprType{},
+		fields:  map[*ast]fieldPath{},
+		members: map[*ast]int64{},
+	}
+	if len(p.spillRegisters()) < 2 {
+		f.diags.errorf(codeRegister, m.span, "No spill register for expression")
+		return
+	}
+	t, ok := f.typeExpression(p, e, m.expr)
+	if !ok {
+		return
+	}
+	root := m.expr.node.(*exprNode)
+	if root.op == "cast" && root.cast != typeName(to) {
+		f.diags.errorf(codeType, m.span, "Cast to %s does not match %s.%s %s", root.cast, target, to.path, typeName(to))
+		return
+	}
+	from := fieldPath{prim: t.prim, enum: t.enum}
+	if t.untyped && (to.prim.integer || to.prim.float) {
+		from.prim = to.prim // an integer literal takes the type of the field, if it fits
+		if root.literal != "" && !literalFits(root.literal, to.prim) {
+			f.diags.errorf(codeType, m.span, "Literal %s does not fit %s.%s %s", root.literal, target, to.path, typeName(to))
+			return
+		}
+		if en, ok := f.ref.enums[to.enum]; ok && root.literal != "" {
+			if !en.isMember(root.literal) {
+				f.diags.errorf(codeType, m.span, "Literal %s is not a member of enum %s", root.literal, to.enum)
+				return
+			}
+			from.enum = to.enum
+		}
+	}
+	source := "an expression of " + typeName(from)
+	if root.literal != "" {
+		source = root.literal
+	}
+	c, narrowing := conversionOf(from, to)
+	if c == conversionNone || to.typ != "" {
+		f.diags.errorf(codeType, m.span, "Can not populate %s.%s %s from %s", target, to.path, typeName(to), source)
+		return
+	}
+	if narrowing && root.op != "cast" {
+		f.diags.errorf(codeType, m.span, "Populating %s.%s %s from %s narrows, which requires an explicit cast",
+			target, to.path, typeName(to), source)
+		return
+	}
+	v, ok := f.emitValue(p, as, e, m.expr, to.prim.float)
+	if !ok {
+		return
+	}
+	f.emitFieldStore(p, as, to, base, v.r)
+	f.releaseValue(v.name)
+}
+
+// returns true if an integer literal is in the range of a primative
+func literalFits(literal string, pr primative) bool {
+	v, err := parseInteger(literal)
+	if err != nil || !pr.integer || pr.width() >= 64 {
+		return err == nil
+	}
+	bits := uint(pr.width())
+	if pr.signed {
+		return v >= -1<<(bits-1) && v < 1<<(bits-1)
+	}
+	return v >= 0 && v < 1<<bits
+}
+
+// types an expression and its operands. integer operators compute 64 bits, typed as the widest operand.
+// a double operand makes the operator a double
+func (f *frame) typeExpression(p *profile, e *evaluation, a *ast) (exprType, bool) {
+	n := a.node.(*exprNode)
+	switch {
+	case n.failed:
+		return exprType{}, false
+	case n.literal != "":
+		if _, err := parseInteger(n.literal); err == nil {
+			pr, _ := p.primative("long")
+			e.types[a] = exprType{prim: pr, untyped: true}
+			return e.types[a], true
+		}
+		if n.literal == "true" || n.literal == "false" {
+			pr, _ := p.primative("bool")
+			e.types[a] = exprType{prim: pr}
+			return e.types[a], true
+		}
+		if strings.HasPrefix(n.literal, "\"") {
+			// functions have no references outside themselves, so strings are passed in the fields of inputs
+			f.diags.errorf(codeType, a.span, "String %s can not be an immediate, pass it in a field of an input", n.literal)
+			return exprType{}, false
+		}
+		if _, err := strconv.ParseFloat(n.literal, 64); err != nil {
+			f.diags.errorf(codeSyntax, a.span, "Literal not a number: %s", n.literal)
+			return exprType{}, false
+		}
+		pr, _ := p.primative("double")
+		e.types[a] = exprType{prim: pr}
+		return e.types[a], true
+	case n.input != "":
+		if en, v, ok := f.enumMember(n.input, n.path, a.span); en != nil {
+			e.members[a] = v
+			e.types[a] = exprType{prim: en.prim, enum: en.name}
+			return e.types[a], ok
+		}
+		fp, ok := f.expressionField(n, a.span)
+		if !ok {
+			return exprType{}, false
+		}
+		e.fields[a] = fp
+		e.types[a] = exprType{prim: fp.prim, enum: fp.enum}
+		return e.types[a], true
+	}
+
+	ok := true
+	var types []exprType
+	for i := range a.sub {
+		t, valid := f.typeExpression(p, e, &a.sub[i])
+		types = append(types, t)
+		ok = ok && valid
+	}
+	if !ok {
+		return exprType{}, false
+	}
+	if n.op == "cast" {
+		if en, ok := f.ref.enums[n.cast]; ok {
+			e.types[a] = exprType{prim: en.prim, enum: en.name}
+			return e.types[a], true
+		}
+		pr, ok := p.primative(n.cast)
+		if typ, width, bits := parseBitsType(n.cast); bits {
+			pr, ok = bitsPrimative(p, typ, width), true
+		}
+		if !ok || (!pr.integer && !pr.float) {
+			f.diags.errorf(codeType, a.span, "Can not cast to %s", n.cast)
+			return exprType{}, false
+		}
+		e.types[a] = exprType{prim: pr}
+		return e.types[a], true
+	}
+	for _, t := range types {
+		if t.prim.boolean {
+			f.diags.errorf(codeType, a.span, "Operator %s requires numbers", n.op)
+			return exprType{}, false
+		}
+		if integerOperators[n.op] && t.prim.float {
+			f.diags.errorf(codeType, a.span, "Operator %s requires integers", n.op)
+			return exprType{}, false
+		}
+	}
+
+	t := types[0]
+	if len(types) > 1 && n.op != "<<" && n.op != ">>" {
+		r := types[1]
+		switch {
+		case r.prim.float || t.untyped:
+			t = r
+		case t.prim.float || r.untyped:
+		case r.prim.width() > t.prim.width() || (r.prim.width() == t.prim.width() && r.prim.signed):
+			t = r
+		}
+	}
+	t.enum = ""
+	e.types[a] = t
+	return t, true
+}
+
+// resolves a field used by an expression, which must be an integer or a double
+func (f *frame) expressionField(n *exprNode, at span) (fieldPath, bool) {
+	s, ok := f.ref.structs[n.input]
+	if !ok || !f.hasValue(n.input) {
+		f.diags.errorf(codeUnresolved, at, "Unable to resolve %s, it is not an input", n.input)
+		return fieldPath{}, false
+	}
+	fp, ok := f.ref.lookup(s, n.path, f.diags, at)
+	if !ok {
+		return fieldPath{}, false
+	}
+	if fp.typ != "" || (!fp.prim.integer && !fp.prim.float) {
+		f.diags.errorf(codeType, at, "Can not use %s.%s %s in an expression", n.input, n.path, typeName(fp))
+		return fieldPath{}, false
+	}
+	return fp, true
+}
+
+// allocates a temporary register for a value computed by an expression
+func (f *frame) exprTemp(p *profile, e *evaluation, float bool) (exprValue, bool) {
+	e.temps++
+	name := "expr " + strconv.Itoa(e.temps)
+	if float {
+		r, _ := f.floatRegisterForValue(p, name)
+		return exprValue{r: r, name: name}, r.name != ""
+	}
+	r, _ := f.registerForValue(p, name)
+	return exprValue{r: r, name: name}, r.name != ""
+}
+
+// emits an expression into a temporary register, converting an integer to a double if float is set
+func (f *frame) emitValue(p *profile, as *asm, e *evaluation, a *ast, float bool) (exprValue, bool) {
+	n := a.node.(*exprNode)
+	t := e.types[a]
+	var v exprValue
+	var ok bool
+	member, isMember := e.members[a]
+	switch {
+	case n.literal != "":
+		return f.emitLiteral(p, as, e, n.literal, float)
+	case isMember:
+		return f.emitLiteral(p, as, e, strconv.FormatInt(member, 10), float)
+	case n.input != "":
+		fp := e.fields[a]
+		if v, ok = f.exprTemp(p, e, fp.prim.float); !ok {
+			return v, false
+		}
+		// the spill register holding the base is free once the field is loaded
+		spill := p.spillRegisters()[1]
+		base, _ := f.loadValue(p, as, n.input, 1)
+		deref := v.r
+		if fp.prim.float {
+			deref = spill
+		}
+		b := f.emitDerefs(p, as, fp, base.index, deref)
+		f.emitFieldLoad(p, as, fp, b, v.r)
+	case n.op == "cast":
+		if v, ok = f.emitCast(p, as, e, a, t.prim); !ok {
+			return v, false
+		}
+	case len(a.sub) == 1:
+		if v, ok = f.emitValue(p, as, e, &a.sub[0], t.prim.float); !ok {
+			return v, false
+		}
+		zr := p.findStackRegister().index // the zero register shares its encoding
+		switch {
+		case t.prim.float:
+			as.emit(p.findFloat("fneg", "dn").set("dn", v.r.index, v.r.index))
+		case n.op == "neg":
+			as.emit(p.find("sub", "dmns").set("dmns", v.r.index, v.r.index, zr, 0))
+		default:
+			as.emit(p.find("orn", "dmns").set("dmns", v.r.index, v.r.index, zr, 0))
+		}
+	case t.prim.float:
+		if v, ok = f.emitOperands(p, as, e, a, true); !ok {
+			return v, false
+		}
+	default:
+		if v, ok = f.emitArithmetic(p, as, e, a, t); !ok {
+			return v, false
+		}
+	}
+	if float && !t.prim.float {
+		return f.emitIntToFloat(p, as, e, v)
+	}
+	return v, true
+}
+
+// moves a literal into a temporary register, through a general purpose register for doubles
+func (f *frame) emitLiteral(p *profile, as *asm, e *evaluation, literal string, float bool) (exprValue, bool) {
+	bits, err := parseInteger(literal)
+	switch {
+	case float:
+		fv, _ := strconv.ParseFloat(literal, 64)
+		bits = int64(math.Float64bits(fv))
+	case literal == "true" || literal == "false":
+		bits, err = 0, nil
+		if literal == "true" {
+			bits = 1
+		}
+	case err != nil:
+		f.errorf(codeType, "Literal %s is not an integer", literal)
+		return exprValue{}, false
+	}
+	v, ok := f.exprTemp(p, e, false)
+	if !ok {
+		return v, false
+	}
+	if !float {
+		for _, ins := range moveImmediate(p, v.r, uint64(bits)) {
+			as.emit(ins)
+		}
+		return v, true
+	}
+	fv, ok := f.exprTemp(p, e, true)
+	if ok {
+		for _, ins := range moveDouble(p, v.r, fv.r, uint64(bits)) {
+			as.emit(ins)
+		}
+	}
+	f.releaseValue(v.name)
+	return fv, ok
+}
+
+func (f *frame) emitIntToFloat(p *profile, as *asm, e *evaluation, v exprValue) (exprValue, bool) {
+	fv, ok := f.exprTemp(p, e, true)
+	if ok {
+		as.emit(p.findFloat("scvtf", "dn").set("dn", fv.r.index, v.r.index))
+	}
+	f.releaseValue(v.name)
+	return fv, ok
+}
+
+// converts the operand of a cast, truncating integers to the size of the type and extending them back to 64 bits
+func (f *frame) emitCast(p *profile, as *asm, e *evaluation, a *ast, to primative) (exprValue, bool) {
+	s := &a.sub[0]
+	from := e.types[s].prim
+	v, ok := f.emitValue(p, as, e, s, from.float || to.float)
+	if !ok || to.float {
+		return v, ok
+	}
+	if from.float {
+		iv, ok := f.exprTemp(p, e, false)
+		if ok {
+			as.emit(p.findFloat("fcvtzs", "dn").set("dn", iv.r.index, v.r.index))
+		}
+		f.releaseValue(v.name)
+		if v = iv; !ok {
+			return v, false
+		}
+	}
+	if to.width() < 64 {
+		extend := "ubfm"
+		if to.signed {
+			extend = "sbfm"
+		}
+		as.emit(p.find(extend, "dnrs").set("dnrs", v.r.index, v.r.index, 0, to.width()-1))
+	}
+	return v, true
+}
+
+// emits both operands of a binary operator, computing it into the register of the left
+func (f *frame) emitOperands(p *profile, as *asm, e *evaluation, a *ast, float bool) (exprValue, bool) {
+	n := a.node.(*exprNode)
+	shift := n.op == "<<" || n.op == ">>"
+	l, r, ok := f.emitPair(p, as, e, &a.sub[0], float, &a.sub[1], float && !shift)
+	if !ok {
+		return l, false
+	}
+	defer f.releaseValue(r.name)
+	if float {
+		as.emit(p.findFloat(floatInstructions[n.op], "dnm").set("dnm", l.r.index, l.r.index, r.r.index))
+		return l, true
+	}
+
+	zr := p.findStackRegister().index
+	t := e.types[a]
+	switch n.op {
+	case "*":
+		as.emit(p.find("madd", "dnma").set("dnma", l.r.index, l.r.index, r.r.index, zr))
+	case "/":
+		// loads zero extend unsigned fields, so a signed divide suits both
+		as.emit(p.find("sdiv", "dnm").set("dnm", l.r.index, l.r.index, r.r.index))
+	case "%":
+		q, ok := f.exprTemp(p, e, false)
+		if !ok {
+			return l, false
+		}
+		as.emit(p.find("sdiv", "dnm").set("dnm", q.r.index, l.r.index, r.r.index))
+		as.emit(p.find("msub", "dnma").set("dnma", l.r.index, q.r.index, r.r.index, l.r.index))
+		f.releaseValue(q.name)
+	case "<<":
+		as.emit(p.find("lslv", "dnm").set("dnm", l.r.index, l.r.index, r.r.index))
+	case ">>":
+		shift := "lsrv"
+		if t.prim.signed {
+			shift = "asrv"
+		}
+		as.emit(p.find(shift, "dnm").set("dnm", l.r.index, l.r.index, r.r.index))
+	default:
+		as.emit(p.find(integerInstructions[n.op], "dmns").set("dmns", l.r.index, r.r.index, l.r.index, 0))
+	}
+	return l, true
+}
+
+// emits an integer operator, adding and subtracting small literals as immediates, and fusing a multiply
+// with the addition or subtraction of its product
+func (f *frame) emitArithmetic(p *profile, as *asm, e *evaluation, a *ast, t exprType) (exprValue, bool) {
+	n := a.node.(*exprNode)
+	if n.op != "+" && n.op != "-" {
+		return f.emitOperands(p, as, e, a, false)
+	}
+	left, right := &a.sub[0], &a.sub[1]
+	if n.op == "+" && (immediateOperand(left) || isProduct(left, e)) && !immediateOperand(right) {
+		left, right = right, left
+	}
+	if immediateOperand(right) {
+		v, ok := f.emitValue(p, as, e, left, false)
+		if ok {
+			imm, _ := parseInteger(right.node.(*exprNode).literal)
+			as.emit(p.find(integerInstructions[n.op], "dni").set("dni", v.r.index, v.r.index, int(imm)))
+		}
+		return v, ok
+	}
+	if !isProduct(right, e) {
+		return f.emitOperands(p, as, e, a, false)
+	}
+
+	fused := "madd"
+	if n.op == "-" {
+		fused = "msub"
+	}
+	var v, x, y exprValue
+	ok := true
+	factors := func() bool {
+		x, y, ok = f.emitPair(p, as, e, &right.sub[0], false, &right.sub[1], false)
+		return ok
+	}
+	addend := func() bool {
+		v, ok = f.emitValue(p, as, e, left, false)
+		return ok
+	}
+	if registersNeeded(right) > registersNeeded(left) {
+		if !factors() {
+			return v, false
+		}
+		if !addend() {
+			f.releaseValue(x.name)
+			f.releaseValue(y.name)
+			return v, false
+		}
+	} else if !addend() || !factors() {
+		f.releaseValue(v.name)
+		return v, false
+	}
+	f.releaseValue(x.name)
+	f.releaseValue(y.name)
+	as.emit(p.find(fused, "dnma").set("dnma", v.r.index, x.r.index, y.r.index, v.r.index))
+	return v, true
+}
+
+// emits the operands of a binary operator, the one needing more registers first so the register of the other
+// isn't held while it's computed. the registers needed by an expression then grow with the depth of its balanced
+// subexpressions, rather than the length of a chain of operators
+func (f *frame) emitPair(p *profile, as *asm, e *evaluation, left *ast, lfloat bool, right *ast, rfloat bool) (exprValue, exprValue, bool) {
+	if registersNeeded(right) > registersNeeded(left) {
+		r, ok := f.emitValue(p, as, e, right, rfloat)
+		if !ok {
+			return r, r, false
+		}
+		l, ok := f.emitValue(p, as, e, left, lfloat)
+		if !ok {
+			f.releaseValue(r.name)
+		}
+		return l, r, ok
+	}
+	l, ok := f.emitValue(p, as, e, left, lfloat)
+	if !ok {
+		return l, l, false
+	}
+	r, ok := f.emitValue(p, as, e, right, rfloat)
+	if !ok {
+		f.releaseValue(l.name)
+	}
+	return l, r, ok
+}
+
+// returns the registers an expression needs to be computed, emitting the operand needing more first
+func registersNeeded(a *ast) int {
+	switch len(a.sub) {
+	case 0:
+		return 1
+	case 1:
+		return registersNeeded(&a.sub[0])
+	}
+	l, r := registersNeeded(&a.sub[0]), registersNeeded(&a.sub[1])
+	switch {
+	case l == r:
+		return l + 1
+	case l > r:
+		return l
+	}
+	return r
+}
+
+// returns true if an operand is a literal which encodes as an add or subtract immediate
+func immediateOperand(a *ast) bool {
+	n := a.node.(*exprNode)
+	v, err := parseInteger(n.literal)
+	return err == nil && v >= 0 && v <= 0xfff
+}
+
+// returns true if an operand is an integer multiply, which may be fused with an add or subtract
+func isProduct(a *ast, e *evaluation) bool {
+	n := a.node.(*exprNode)
+	return n.op == "*" && !e.types[a].prim.float
+}
+
+// returns the inputs whose fields an expression uses
+func expressionInputs(a *ast) []string {
+	var inputs []string
+	if n, ok := a.node.(*exprNode); ok && n.input != "" {
+		inputs = append(append(inputs, n.input), indexInputs(n.path)...)
+	}
+	for i := range a.sub {
+		inputs = append(inputs, expressionInputs(&a.sub[i])...)
+	}
+	return inputs
+}
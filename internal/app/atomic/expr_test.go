@@ -0,0 +1,175 @@
+package atomic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// returns a source populating out.r from an expression of the fields of 8 inputs
+func expressionSource(expr string) string {
+	var sb strings.Builder
+	sb.WriteString("package: t\n")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(&sb, "type: t%d { v long }\n", i)
+	}
+	sb.WriteString("type: out { r long }\nfunction: f {\n")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(&sb, "    > t%d\n", i)
+	}
+	fmt.Fprintf(&sb, "    > out\n    + out { r <- %s }\n}\n", expr)
+	return sb.String()
+}
+
+// returns a chain of an operator over the fields of the inputs, nested to the right
+func nestedExpression(op string, depth int) string {
+	expr := fmt.Sprintf("t%d.v", depth%8+1)
+	for i := depth - 1; i >= 0; i-- {
+		expr = fmt.Sprintf("t%d.v %s (%s)", i%8+1, op, expr)
+	}
+	return expr
+}
+
+// returns the value of a nested expression over the values of the inputs
+func nestedValue(op func(a, b int64) int64, depth int, v func(i int) int64) int64 {
+	r := v(depth%8 + 1)
+	for i := depth - 1; i >= 0; i-- {
+		r = op(v(i%8+1), r)
+	}
+	return r
+}
+
+// expressions deeper than the registers compute the value of the expression
+func TestDeepExpressions(t *testing.T) {
+	v := func(i int) int64 { return int64(i*i*7 + 3) }
+	add := func(a, b int64) int64 { return a + b }
+	sub := func(a, b int64) int64 { return a - b }
+	tests := []struct {
+		name string
+		expr string
+		want int64
+	}{
+		{"added to the right", nestedExpression("+", 32), nestedValue(add, 32, v)},
+		{"subtracted to the right", nestedExpression("-", 32), nestedValue(sub, 32, v)},
+		{"multiplied and added", "t1.v + t2.v * (" + nestedExpression("+", 32) + ")",
+			v(1) + v(2)*nestedValue(add, 32, v)},
+		{"balanced", "(" + nestedExpression("+", 4) + ") * (" + nestedExpression("-", 4) + ") + t8.v * (t7.v - t6.v)",
+			nestedValue(add, 4, v)*nestedValue(sub, 4, v) + v(8)*(v(7)-v(6))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing := compileListing(t, expressionSource(tt.expr))
+			// t1 to t8 then out, each a long at a multiple of 0x100
+			var inputs []int64
+			memory := map[int64]int64{}
+			for i := 1; i <= 9; i++ {
+				inputs = append(inputs, int64(i)*0x100)
+				memory[int64(i)*0x100] = v(i)
+			}
+			memory[0x900] = 0
+			runInstructions(t, functionInstructions(listing, "f"), inputs, memory)
+			if got := memory[0x900]; got != tt.want {
+				t.Errorf("got %d, want %d\n%s", got, tt.want, functionListing(listing, "f"))
+			}
+		})
+	}
+}
+
+// expressions compute integers as 64 bits and doubles when an operand is one, folding constants, and store the
+// result with the width of the target
+func TestExpressions(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: fare { base int tax int rate double n long }
+type: out { total int d double s short m long }
+function: f {
+    > fare
+    > out
+    + out { total <- fare.base + fare.tax * 2 d <- fare.rate * 1.5 + fare.base s <- short((fare.base << 3) & 255 | fare.tax >> 1) m <- fare.n - (3 + 4) * 2 }
+}
+function: g {
+    > fare
+    > out
+    + out { total <- fare.base / fare.tax d <- -fare.rate / 2.0 s <- short(~fare.base % 7) m <- fare.n * fare.n - fare.n }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsw i=1 n=0 t=9", "movz d=10 h=0 i=2", "ldrsw i=0 n=0 t=11", "madd a=11 d=11 m=10 n=9",
+			"str.w i=0 n=1 t=11",
+			"ldr i=1 n=0 t=17", "fmov d=18 i=120", "fmul d=17 m=18 n=17", // 1.5
+			"ldrsw i=0 n=0 t=9", "scvtf d=18 n=9", "fadd d=17 m=18 n=17",
+			"str i=1 n=1 t=17",
+			"ldrsw i=0 n=0 t=9", "movz d=10 h=0 i=3", "lslv d=9 m=10 n=9",
+			"movz d=10 h=0 i=255", "and d=9 m=10 n=9 s=0",
+			"ldrsw i=1 n=0 t=10", "movz d=11 h=0 i=1", "asrv d=10 m=11 n=10",
+			"orr d=9 m=10 n=9 s=0", "sbfm d=9 n=9 r=0 s=15",
+			"strh i=8 n=1 t=9",
+			"ldr i=2 n=0 t=9", "sub d=9 i=14 n=9", // (3 + 4) * 2 folds to 14
+			"str i=3 n=1 t=9",
+			"exit_f:", "ret n=30", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=0 n=0 t=9", "ldrsw i=1 n=0 t=10", "sdiv d=9 m=10 n=9", "str.w i=0 n=1 t=9",
+			"ldr i=1 n=0 t=17", "fneg d=17 n=17", "fmov d=18 i=0", "fdiv d=17 m=18 n=17", "str i=1 n=1 t=17", // 2.0
+			"ldrsw i=0 n=0 t=9", "orn d=9 m=9 n=31 s=0",
+			"movz d=10 h=0 i=7", "sdiv d=11 m=10 n=9", "msub a=9 d=9 m=10 n=11", // the remainder
+			"sbfm d=9 n=9 r=0 s=15", "strh i=8 n=1 t=9",
+			"ldr i=2 n=0 t=9", "ldr i=2 n=0 t=10", "madd a=31 d=9 m=10 n=9",
+			"ldr i=2 n=0 t=10", "sub d=9 m=10 n=9 s=0", "str i=3 n=1 t=9",
+			"exit_g:", "ret n=30", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// folding reports an error at the operator once, and typing at the mapping
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{"folded modulo of a double", "1.5 % 2", []string{"A204 21:18 Operator % requires integers"}},
+		{"folded division by zero", "t1.v + 1 / 0", []string{"A204 21:25 Division by zero"}},
+		{"modulo of a double", "t1.v % 1.5", []string{"A204 21:18 Operator % requires integers"}},
+		{"shift of a double", "(2.5 << 1) + t1.v", []string{"A204 21:18 Operator << requires integers"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compileDiagnostics(t, expressionSource(tt.expr)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMappingExpressionErrors(t *testing.T) {
+	got := compileDiagnostics(t, `package: t
+type: fare { base int tax int }
+type: out { total int s short }
+function: f {
+    > fare
+    > out
+    + out { total <- fare.base total <- 0 s <- fare.base + fare.tax }
+}
+`)
+	want := []string{
+		"A201 7:32 Field out.total is already mapped",
+		"A204 7:43 Populating out.s short from an expression of int narrows, which requires an explicit cast",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -4,66 +4,260 @@ package atomic
 type frame struct {
 	parent    *frame
 	values    map[string]register
-	allocated map[int]string
+	allocated map[string]string // register name to value name
+	inputs    []string          // inputs in declaration order
+	stack     *stackFrame       // shared by the frames of a function
+	live      *liveness
 	ref       *reference
+	diags     *diagnostics
+	span      span      // source location of the node being emitted
+	node      *ast      // the node being emitted
+	call      *callSite // the call whose exit handlers are being emitted
+	dispatch  *caseSite // the case whose arms are being emitted
+	when      *whenSite // the when whose else is being emitted
+	// indexes of buffers checked by the node being emitted, and the lengths of buffers their constant indexes prove
+	provenFor     *ast
+	provenLengths map[string]int64
+	populating    string // the input being populated, whose buffers may change length
+	// streams held by a loop which checked they have the elements its reads and writes take
+	checkedStreams map[string]bool
 }
 
-func newFrame(ref *reference) *frame {
+func newFrame(ref *reference, d *diagnostics) *frame {
 	f := frame{
 		values:    make(map[string]register),
-		allocated: make(map[int]string),
+		allocated: make(map[string]string),
+		stack:     newStackFrame(),
+		live:      &liveness{},
 		ref:       ref,
+		diags:     d,
 	}
 	return &f
 }
 
 func (f *frame) push() *frame {
-	nf := newFrame(f.ref)
+	nf := newFrame(f.ref, f.diags)
 	nf.parent = f
+	nf.stack = f.stack
+	nf.live = f.live
 	return nf
 }
 
-func (f *frame) pushParameter(p *profile, name string) register {
-	for _, r := range p.registers {
-		if r.param {
-			_, allocated := f.allocated[r.index]
-			if !allocated {
-				f.values[name] = r
-				f.allocated[r.index] = name
-				return r
-			}
+// records an error against the node being emitted
+func (f *frame) errorf(code string, format string, a ...interface{}) {
+	f.diags.errorf(code, f.span, format, a...)
+}
+
+// assigns every input of the function its parameter register, or its place in the caller's argument area
+// beyond the parameter registers, as the inputs arrive there on entry. the return addresses of exits follow the
+// inputs. the registers are reserved until the inputs are declared, then released after their last use
+func (f *frame) plan(p *profile, fa *ast, spilled []string) {
+	f.live = computeLiveness(f.ref, fa)
+	f.stack.outgoing = f.ref.stackArguments(p, fa)
+
+	params := p.paramRegisters()
+	for i, name := range f.live.parameters() {
+		if i < len(params) && contains(spilled, name) {
+			f.stack.spill(name, params[i])
+		} else if i < len(params) {
+			f.allocated[params[i].name] = name
+			f.stack.reserved[name] = params[i]
+		} else {
+			f.stack.arguments[name] = i - len(params)
 		}
 	}
-	shenanigans("Unable to add param register for %s", name)
-	return register{}
 }
 
-// finds or allocates a register for a value, returning true if the value already existed
+// makes a planned input visible to the nodes which follow its declaration
+func (f *frame) declareInput(name string) {
+	f.inputs = append(f.inputs, name)
+	if r, ok := f.stack.reserved[name]; ok {
+		f.values[name] = r
+	}
+}
+
+// returns the inputs of this frame and its parents, in declaration order
+func (f *frame) declaredInputs() []string {
+	if f.parent == nil {
+		return f.inputs
+	}
+	return append(f.parent.declaredInputs(), f.inputs...)
+}
+
+// releases the inputs no longer used once a node has been emitted
+func (f *frame) emitted(a *ast) {
+	for _, name := range f.live.releases[a] {
+		f.releaseValue(name)
+		delete(f.stack.spilled, name)
+		delete(f.stack.arguments, name)
+	}
+}
+
+// finds or allocates a general purpose register for a value, returning true if the value already existed
 func (f *frame) registerForValue(p *profile, name string) (register, bool) {
+	return f.allocate(p, name, false)
+}
+
+// finds or allocates a floating point register for a value, returning true if the value already existed
+func (f *frame) floatRegisterForValue(p *profile, name string) (register, bool) {
+	return f.allocate(p, name, true)
+}
+
+// allocates scratch registers in preference, keeping parameter registers free for longer, then callee saved
+// registers which are saved on entry and restored on exit. once they are exhausted an input is spilled
+func (f *frame) allocate(p *profile, name string, float bool) (register, bool) {
 	r, exists := f.values[name]
 	if exists {
 		return r, true
 	}
 
-	for _, r := range p.registers {
-		_, inUse := f.allocated[r.index]
-		if !inUse {
-			f.values[name] = r
-			f.allocated[r.index] = name
-			return r, false
+	r, ok := f.freeRegister(p, float)
+	if !ok && !float {
+		r, ok = f.spillInput()
+	}
+	if !ok {
+		f.errorf(codeRegister, "Unable to resolve register for %s", name)
+		return register{}, false
+	}
+	f.values[name] = r
+	f.allocated[r.name] = name
+	return r, false
+}
+
+func (f *frame) freeRegister(p *profile, float bool) (register, bool) {
+	preferences := []func(r register) bool{
+		func(r register) bool { return r.scratch && !r.param },
+		func(r register) bool { return r.scratch && r.param },
+		func(r register) bool { return !r.scratch },
+	}
+	for _, preferred := range preferences {
+		for _, r := range p.registers {
+			if r.float != float || r.frame || r.link || r.stack || r.spill || f.isAllocated(r) || !preferred(r) {
+				continue
+			}
+			if !r.scratch {
+				f.stack.save(r)
+			}
+			return r, true
+		}
+	}
+	return register{}, false
+}
+
+func (f *frame) isAllocated(r register) bool {
+	if _, inUse := f.allocated[r.name]; inUse {
+		return true
+	}
+	return f.parent != nil && f.parent.isAllocated(r)
+}
+
+// frees the register of the input used furthest ahead, storing it to a stack slot on entry. inputs hold their
+// registers from entry, so the slot holds the input wherever it is reloaded. as earlier uses in an enclosing
+// loop may have used the register, the function is emitted again with the input spilled from the start
+func (f *frame) spillInput() (register, bool) {
+	victim := ""
+	var vr register
+	for rn, name := range f.allocated {
+		r, ok := f.stack.reserved[name]
+		if !ok || r.name != rn {
+			continue
+		}
+		if victim == "" || f.live.after(name, victim) {
+			victim, vr = name, r
 		}
 	}
-	shenanigans("Unable to resolve register for %s", name)
+	if victim == "" {
+		return register{}, false
+	}
+	f.stack.spill(victim, vr)
+	f.stack.late = append(f.stack.late, victim)
+	delete(f.values, victim)
+	delete(f.allocated, vr.name)
+	delete(f.stack.reserved, victim)
+	return vr, true
+}
+
+// returns the register holding a value, reloading spilled values and inputs passed on the stack into the
+// numbered spill register
+func (f *frame) loadValue(p *profile, as *asm, name string, spill int) (register, bool) {
+	if r, ok := f.valueRegister(name); ok {
+		return r, true
+	}
+	if !contains(f.declaredInputs(), name) {
+		return register{}, false
+	}
+	spills := p.spillRegisters()
+	if spill >= len(spills) {
+		f.errorf(codeRegister, "No spill register to reload %s", name)
+		return register{}, false
+	}
+	return f.reloadValue(p, as, name, spills[spill])
+}
+
+// reloads a spilled input, or one passed on the stack, into rt
+func (f *frame) reloadValue(p *profile, as *asm, name string, rt register) (register, bool) {
+	sp := p.findStackRegister()
+	pr := p.layout(pointerPrimative)
+	if slot, ok := f.stack.spilled[name]; ok {
+		f.emitLoad(p, as, pr, sp.index, f.stack.offset(slot, pr.size), rt)
+		return rt, true
+	}
+	if arg, ok := f.stack.arguments[name]; ok {
+		// the frame size isn't known until the function is complete, the load is encoded then
+		f.stack.patches = append(f.stack.patches, argumentLoad{
+			index:    len(as.instructions),
+			register: rt,
+			argument: arg,
+		})
+		as.emit(0)
+		return rt, true
+	}
 	return register{}, false
 }
 
+// returns true if a value is held in a register or on the stack
+func (f *frame) hasValue(name string) bool {
+	if _, ok := f.valueRegister(name); ok {
+		return true
+	}
+	_, spilled := f.stack.spilled[name]
+	_, argument := f.stack.arguments[name]
+	return (spilled || argument) && contains(f.declaredInputs(), name)
+}
+
+// returns the value a register is allocated to, in this frame or its parents
+func (f *frame) allocatedValue(r register) (string, bool) {
+	if name, ok := f.allocated[r.name]; ok {
+		return name, true
+	}
+	if f.parent != nil {
+		return f.parent.allocatedValue(r)
+	}
+	return "", false
+}
+
+// finds the register of an existing value, without allocating
+func (f *frame) valueRegister(name string) (register, bool) {
+	r, exists := f.values[name]
+	if !exists && f.parent != nil {
+		return f.parent.valueRegister(name)
+	}
+	return r, exists
+}
+
 func (f *frame) releaseValue(name string) bool {
 	r, found := f.values[name]
 	if found {
 		delete(f.values, name)
-		delete(f.allocated, r.index)
+		delete(f.allocated, r.name)
 		return true
 	}
+	for rn, value := range f.allocated {
+		if value == name { // reserved for an input not yet declared
+			delete(f.allocated, rn)
+			return true
+		}
+	}
 
 	if f.parent != nil {
 		return f.parent.releaseValue(name)
@@ -0,0 +1,58 @@
+package atomic
+
+import (
+	"fmt"
+	"testing"
+)
+
+// returns an expression subtracting balanced halves of the fields of the inputs, and its value
+func balancedExpression(depth int, leaf *int, v func(i int) int64) (string, int64) {
+	if depth == 0 {
+		*leaf++
+		return fmt.Sprintf("t%d.v", *leaf%8+1), v(*leaf%8 + 1)
+	}
+	left, lv := balancedExpression(depth-1, leaf, v)
+	right, rv := balancedExpression(depth-1, leaf, v)
+	return "(" + left + ") - (" + right + ")", lv - rv
+}
+
+// an expression needing more registers than the scratch registers uses callee saved registers, which are
+// restored on return along with the frame and link registers and the stack pointer
+func TestCalleeSavedRegisters(t *testing.T) {
+	v := func(i int) int64 { return int64(i*i*7 + 3) }
+	leaf := 0
+	expr, want := balancedExpression(11, &leaf, v)
+	listing := compileListing(t, expressionSource(expr))
+	instructions := functionInstructions(listing, "f")
+
+	prologue := []string{
+		"f:",
+		"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=48 n=31",
+		"stp i=0 n=31 t=18 u=19", "stp i=2 n=31 t=20 u=21", "str i=4 n=31 t=22",
+		"ldr i=8 n=31 t=16", // out, above the saved registers, frame and link registers
+	}
+	for i, ins := range prologue {
+		if i >= len(instructions) || instructions[i] != ins {
+			t.Fatalf("got prologue %q, want %q", instructions[:len(prologue)], prologue)
+		}
+	}
+
+	var inputs []int64
+	memory := map[int64]int64{}
+	for i := 1; i <= 9; i++ {
+		inputs = append(inputs, int64(i)*0x100)
+		memory[int64(i)*0x100] = v(i)
+	}
+	x := runInstructions(t, instructions, inputs, memory)
+	if got := memory[0x900]; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+	for r := 18; r <= 30; r++ {
+		if x[r] != int64(0x7700+r) {
+			t.Errorf("x%d is %#x on return", r, x[r])
+		}
+	}
+	if x[31] != entrySP {
+		t.Errorf("sp is %#x on return", x[31])
+	}
+}
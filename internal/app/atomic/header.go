@@ -0,0 +1,229 @@
+package atomic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+var cTypes = map[string]string{
+	"string":  "const char*",
+	"bool":    "bool",
+	"byte":    "uint8_t",
+	"short":   "int16_t",
+	"int":     "int32_t",
+	"long":    "int64_t",
+	"double":  "double",
+	"pointer": "void*",
+}
+
+// writes a C header declaring the structs of a unit and those they contain. static assertions let the
+// C compiler confirm its layout matches the one the functions were compiled against.
+func writeHeader(w io.Writer, r *reference, u *unit) {
+	guard := "ATOMIC_" + strings.ToUpper(unitName(u.filename)) + "_H"
+	fmt.Fprintf(w, "// generated by atomic from %s\n\n", u.filename)
+	fmt.Fprintf(w, "#ifndef %s\n#define %s\n\n", guard, guard)
+	fmt.Fprint(w, "#include <stdbool.h>\n#include <stddef.h>\n#include <stdint.h>\n")
+
+	written := map[string]bool{}
+	for _, a := range u.ast.sub {
+		switch n := a.node.(type) {
+		case *enumNode:
+			if r.enums[n.name] == n {
+				writeHeaderEnum(w, n, written)
+			}
+		case *structNode:
+			if r.structs[n.name] == n {
+				writeHeaderStruct(w, r, n, written)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n#endif // %s\n", guard)
+}
+
+// writes structs contained by value first, as C requires them to be complete
+func writeHeaderStruct(w io.Writer, r *reference, s *structNode, written map[string]bool) {
+	if written[s.name] {
+		return
+	}
+	written[s.name] = true
+	for _, f := range s.fields {
+		if f.typ != "" && !f.pointer {
+			writeHeaderStruct(w, r, r.structs[f.typ], written)
+		}
+		if f.enum != "" {
+			writeHeaderEnum(w, r.enums[f.enum], written)
+		}
+		if f.stream && f.capacity == 0 {
+			writeHeaderStream(w, written)
+		}
+	}
+
+	var attributes []string
+	if s.packed {
+		attributes = append(attributes, "packed")
+	}
+	if s.align != 0 {
+		attributes = append(attributes, fmt.Sprintf("aligned(%d)", s.align))
+	}
+	attribute := ""
+	if len(attributes) > 0 {
+		attribute = fmt.Sprintf("__attribute__((%s)) ", strings.Join(attributes, ", "))
+	}
+
+	// structs may be declared by several headers, each guarded
+	guard := "ATOMIC_STRUCT_" + s.name
+	fmt.Fprintf(w, "\n#ifndef %s\n#define %s\n", guard, guard)
+	// the inputs of functions pointed to may not be declared yet, they only need to be named
+	declared := map[string]bool{}
+	for _, f := range s.fields {
+		if fn, ok := r.functions[f.typ]; ok && f.pointer && r.structs[f.typ] == nil {
+			for _, in := range fn.inputs {
+				if !declared[in] {
+					declared[in] = true
+					fmt.Fprintf(w, "struct %s;\n", in)
+				}
+			}
+		}
+	}
+	if s.variant {
+		writeHeaderVariant(w, r, s)
+	} else {
+		fmt.Fprintf(w, "struct %s%s {\n", attribute, s.name)
+		for _, f := range s.fields {
+			fmt.Fprintf(w, "    %s;%s\n", cDeclaration(r, f), cOrder(f))
+		}
+		fmt.Fprint(w, "};\n")
+	}
+	fmt.Fprintf(w, "_Static_assert(sizeof(struct %s) == %d, \"size of %s\");\n", s.name, s.size, s.name)
+	fmt.Fprintf(w, "_Static_assert(_Alignof(struct %s) == %d, \"alignment of %s\");\n", s.name, s.alignment, s.name)
+	for _, f := range s.fields {
+		if f.prim.bits > 0 {
+			continue // bit fields have no offset, their placement is checked by the size of the struct
+		}
+		fmt.Fprintf(w, "_Static_assert(offsetof(struct %s, %s) == %d, \"offset of %s.%s\");\n",
+			s.name, f.name, f.offset, s.name, f.name)
+	}
+	fmt.Fprintf(w, "#endif // %s\n", guard)
+}
+
+// declares a variant as its tag and a union of its members, with the tag of each member as a constant
+// prefixed by the variant's name
+func writeHeaderVariant(w io.Writer, r *reference, s *structNode) {
+	fmt.Fprint(w, "enum {\n")
+	for i, f := range s.fields[1:] {
+		fmt.Fprintf(w, "    %s_%s = %d,\n", s.name, f.name, i)
+	}
+	fmt.Fprint(w, "};\n")
+	fmt.Fprintf(w, "struct %s {\n", s.name)
+	fmt.Fprintf(w, "    %s;\n", cDeclaration(r, s.fields[0]))
+	fmt.Fprint(w, "    union {\n")
+	for _, f := range s.fields[1:] {
+		fmt.Fprintf(w, "        %s;\n", cDeclaration(r, f))
+	}
+	fmt.Fprint(w, "    };\n")
+	fmt.Fprint(w, "};\n")
+}
+
+// declares an enum as its primative, with its members as constants prefixed by its name
+func writeHeaderEnum(w io.Writer, e *enumNode, written map[string]bool) {
+	if written[e.name] {
+		return
+	}
+	written[e.name] = true
+	guard := "ATOMIC_ENUM_" + e.name
+	fmt.Fprintf(w, "\n#ifndef %s\n#define %s\n", guard, guard)
+	fmt.Fprintf(w, "typedef %s %s;\n", cTypes[e.prim.name], e.name)
+	fmt.Fprint(w, "enum {\n")
+	for _, m := range e.members {
+		fmt.Fprintf(w, "    %s_%s = %d,\n", e.name, m.name, m.value)
+	}
+	fmt.Fprint(w, "};\n")
+	fmt.Fprintf(w, "#endif // %s\n", guard)
+}
+
+// declares the descriptor of streams backed by a callback, which every header declaring one shares
+func writeHeaderStream(w io.Writer, written map[string]bool) {
+	if written["atomic_stream"] {
+		return
+	}
+	written["atomic_stream"] = true
+	fmt.Fprint(w, "\n#ifndef ATOMIC_STREAM\n#define ATOMIC_STREAM\n")
+	fmt.Fprint(w, "struct atomic_stream {\n")
+	fmt.Fprint(w, "    void* base;\n")
+	fmt.Fprint(w, "    int64_t length;\n")
+	fmt.Fprint(w, "    int64_t capacity;\n")
+	fmt.Fprint(w, "    void (*refill)(struct atomic_stream*);\n")
+	fmt.Fprint(w, "};\n")
+	fmt.Fprintf(w, "_Static_assert(sizeof(struct atomic_stream) == %d, \"size of atomic_stream\");\n", streamSize)
+	fmt.Fprint(w, "#endif // ATOMIC_STREAM\n")
+}
+
+// declares a field, function pointers declare the inputs of the function as its parameters
+func cDeclaration(r *reference, f field) string {
+	name := f.name
+	switch {
+	case f.stream && f.capacity > 0:
+		// a fixed buffer holds its elements after its length and position
+		return fmt.Sprintf("struct { int64_t length; int64_t position; %s elements[%d]; } %s", cType(f), f.capacity, name)
+	case f.stream:
+		return fmt.Sprintf("struct atomic_stream %s", name)
+	case f.bound != "":
+		return fmt.Sprintf("%s* %s", cType(f), name)
+	case f.prim.bits > 0:
+		return fmt.Sprintf("%s %s : %d", cBitsType(f.prim), name, f.prim.bits)
+	}
+	if f.length > 0 {
+		name += fmt.Sprintf("[%d]", f.length)
+	}
+	if fn, ok := r.functions[f.typ]; ok && f.pointer && r.structs[f.typ] == nil {
+		params := make([]string, len(fn.inputs))
+		for i, in := range fn.inputs {
+			params[i] = fmt.Sprintf("struct %s*", in)
+		}
+		for range fn.exits {
+			params = append(params, "void*") // return addresses of the exits
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		return fmt.Sprintf("void (*%s)(%s)", name, strings.Join(params, ", "))
+	}
+	return fmt.Sprintf("%s %s", cType(f), name)
+}
+
+func cType(f field) string {
+	switch {
+	case f.pointer:
+		return fmt.Sprintf("struct %s*", f.typ)
+	case f.typ != "":
+		return fmt.Sprintf("struct %s", f.typ)
+	case f.enum != "":
+		return f.enum
+	}
+	return cTypes[f.prim.name]
+}
+
+// declares a bit field as its declared word, which C lays it out within as atomic does
+func cBitsType(pr primative) string {
+	if pr.boolean {
+		return cTypes["bool"]
+	}
+	c := fmt.Sprintf("int%d_t", bitsWord(pr.bits)*8)
+	if !pr.signed {
+		c = "u" + c
+	}
+	return c
+}
+
+// notes the declared byte order of a field, which C can't declare, so the code filling it reverses its bytes
+func cOrder(f field) string {
+	switch f.order {
+	case "be":
+		return " // big endian"
+	case "le":
+		return " // little endian"
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package atomic
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// the instructions loading a constant into a 64 bit register. a single orr of a logical immediate, or a movz
+// and a movk for each further halfword which isn't zero. values mostly of ones halfwords start with a movn,
+// then need a movk for each halfword which isn't all ones
+func moveImmediate(p *profile, rt register, value uint64) []uint32 {
+	zeros, ones := 0, 0
+	for hw := 0; hw < 4; hw++ {
+		switch value >> (hw * 16) & 0xffff {
+		case 0:
+			zeros++
+		case 0xffff:
+			ones++
+		}
+	}
+	if zeros < 3 && ones < 3 {
+		if imm, ok := logicalImmediate(value); ok {
+			zr := p.findStackRegister().index // the zero register shares its encoding
+			return []uint32{p.find("orr", "dni").set("dni", rt.index, zr, imm)}
+		}
+	}
+
+	first, skip := "movz", uint64(0)
+	if ones > zeros {
+		first, skip = "movn", 0xffff
+	}
+	var ins []uint32
+	for hw := 0; hw < 4; hw++ {
+		half := value >> (hw * 16) & 0xffff
+		switch {
+		case len(ins) > 0 && half != skip:
+			ins = append(ins, p.find("movk", "dhi").set("dhi", rt.index, hw, int(half)))
+		case len(ins) == 0 && half != skip:
+			ins = append(ins, p.find(first, "dhi").set("dhi", rt.index, hw, int(half^skip)))
+		}
+	}
+	if len(ins) == 0 { // zero, or all ones
+		ins = append(ins, p.find(first, "dhi").set("dhi", rt.index, 0, 0))
+	}
+	return ins
+}
+
+// the instructions loading the bits of a double into the float register ft. an fmov of an 8 bit immediate
+// for values such as 0.5 or 3.0, otherwise through the general purpose register rt
+func moveDouble(p *profile, rt register, ft register, value uint64) []uint32 {
+	if imm, ok := floatImmediate(value); ok {
+		return []uint32{p.findFloat("fmov", "di").set("di", ft.index, imm)}
+	}
+	return append(moveImmediate(p, rt, value), p.findFloat("fmov", "dn").set("dn", ft.index, rt.index))
+}
+
+// encodes a double as the 8 bit immediate of an fmov, a sign, 3 bits of exponent and 4 bits of fraction
+func floatImmediate(value uint64) (int, bool) {
+	if value&(1<<48-1) != 0 {
+		return 0, false
+	}
+	exponent := value >> 52 & 0x7ff
+	b := exponent >> 8 & 1
+	if exponent>>2 != (b^1)<<8|b*0xff {
+		return 0, false
+	}
+	return int(value>>63<<7 | b<<6 | exponent&3<<4 | value>>48&0xf), true
+}
+
+// encodes a value as the immediate of a logical instruction, N:immr:imms, if it's a rotated run of ones
+// repeating in elements of 2 to 64 bits
+func logicalImmediate(value uint64) (int, bool) {
+	if value == 0 || value == ^uint64(0) {
+		return 0, false
+	}
+	size := 64
+	for size > 2 {
+		half := size / 2
+		mask := uint64(1)<<half - 1
+		if value&mask != value>>half&mask {
+			break
+		}
+		size = half
+	}
+	mask := ^uint64(0) >> (64 - size)
+	element := value & mask
+	ones := bits.OnesCount64(element)
+	run := uint64(1)<<ones - 1
+	for r := 0; r < size; r++ {
+		// the element is the run of ones rotated right by r
+		rotated := (run>>r | run<<(size-r)) & mask
+		if rotated != element {
+			continue
+		}
+		n := 0
+		if size == 64 {
+			n = 1
+		}
+		imms := ^(size*2-1)&0x3f | (ones - 1)
+		return n<<12 | r<<6 | imms, true
+	}
+	return 0, false
+}
+
+// a decimal literal with a leading zero, which would be octal in c
+var errLeadingZero = errors.New("leading zero")
+
+// parses an integer literal in decimal, hex 0x or binary 0b. unsigned 64 bit values wrap to negative.
+// leading zeros are rejected rather than read as octal
+func parseInteger(literal string) (int64, error) {
+	digits := strings.TrimPrefix(literal, "-")
+	negative := len(digits) < len(literal)
+	base := 10
+	switch {
+	case len(digits) > 2 && (digits[:2] == "0x" || digits[:2] == "0X"):
+		base, digits = 16, digits[2:]
+	case len(digits) > 2 && (digits[:2] == "0b" || digits[:2] == "0B"):
+		base, digits = 2, digits[2:]
+	case leadingZero(digits):
+		return 0, &strconv.NumError{Func: "parseInteger", Num: literal, Err: errLeadingZero}
+	}
+	u, err := strconv.ParseUint(digits, base, 64)
+	switch {
+	case err != nil:
+		return 0, &strconv.NumError{Func: "parseInteger", Num: literal, Err: err.(*strconv.NumError).Err}
+	case !negative:
+		return int64(u), nil
+	case u > 1<<63:
+		return 0, &strconv.NumError{Func: "parseInteger", Num: literal, Err: strconv.ErrRange}
+	}
+	return -int64(u), nil
+}
+
+// reports whether a number is decimal digits with a leading zero, eg. 010
+func leadingZero(number string) bool {
+	if len(number) < 2 || number[0] != '0' {
+		return false
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
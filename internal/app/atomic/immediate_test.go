@@ -0,0 +1,206 @@
+package atomic
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseInteger(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    int64
+		ok      bool
+	}{
+		{"0", 0, true},
+		{"42", 42, true},
+		{"-42", -42, true},
+		{"0x10", 16, true},
+		{"0XfF", 255, true},
+		{"-0x10", -16, true},
+		{"0b1010", 10, true},
+		{"9223372036854775807", 1<<63 - 1, true},
+		{"-9223372036854775808", -1 << 63, true},
+		{"0xffffffffffffffff", -1, true}, // unsigned wraps
+		{"18446744073709551616", 0, false},
+		{"-9223372036854775809", 0, false},
+		{"010", 0, false}, // not octal
+		{"08", 0, false},
+		{"00", 0, false},
+		{"0o17", 0, false},
+		{"1_000", 0, false},
+		{"0x", 0, false},
+		{"0b102", 0, false},
+		{"1.5", 0, false},
+		{"+1", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.literal, func(t *testing.T) {
+			got, err := parseInteger(tt.literal)
+			if (err == nil) != tt.ok || got != tt.want {
+				t.Errorf("parseInteger(%q) = %d, %v, want %d ok %v", tt.literal, got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string // errors
+	}{
+		{"hex array length", "type: o { a [0x10]byte r int }\nfunction: f {\n    > o\n    + o { r <- 1 }\n}", nil},
+		{"binary loop count", "type: o { r int }\nfunction: f {\n    > o\n    loop: 0b11 { + o { r <- 1 } }\n}", nil},
+		{"hex case values", "type: o { c int r int }\nfunction: f {\n    > o\n    case: o.c { 0x10: { + o { r <- 1 } } -0x2: { + o { r <- 2 } } }\n}", nil},
+		{"leading zero", "type: o { r int }\nfunction: f {\n    > o\n    + o { r <- 010 }\n}",
+			[]string{"A100 5:16 Number 010 has a leading zero, octal is not supported"}},
+		{"leading zero read as decimal", "type: o { r long }\nfunction: f {\n    > o\n    + o { r <- 08 }\n}",
+			[]string{"A100 5:16 Number 08 has a leading zero, octal is not supported"}},
+		{"leading zero of a loop count", "type: o { r int }\nfunction: f {\n    > o\n    loop: 04 { + o { r <- 1 } }\n}",
+			[]string{"A100 5:11 Number 04 has a leading zero, octal is not supported"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diagnosticStrings(compileErrors(compileSource(t, "package: t\n"+tt.source+"\n")))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// constants and literals load with the fewest instructions, doubles through a general purpose register
+func TestConstants(t *testing.T) {
+	listing := compileListing(t, `package: t
+const: seats 400
+const: mask 0b1010 << 4
+const: big 0x5678000012340000
+const: on true
+type: o { a int b long c long d bool e byte f long g double h short }
+function: f {
+    > o
+    + o { a <- seats b <- big c <- 0x00ff00ff00ff00ff d <- on e <- mask f <- -2 g <- 0.1 h <- -1 }
+}
+`)
+	want := []string{
+		"f:",
+		"movz d=9 h=0 i=400", "str.w i=0 n=0 t=9",
+		"movz d=9 h=1 i=4660", "movk d=9 h=3 i=22136", "str i=1 n=0 t=9",
+		"orr d=9 i=39 n=31", "str i=2 n=0 t=9", // a logical immediate
+		"movz d=9 h=0 i=1", "strb i=24 n=0 t=9",
+		"movz d=9 h=0 i=160", "strb i=25 n=0 t=9",
+		"movn d=9 h=0 i=1", "str i=4 n=0 t=9",
+		"movz d=9 h=0 i=39322", "movk d=9 h=1 i=39321", "movk d=9 h=2 i=39321", "movk d=9 h=3 i=16313", // 0.1
+		"fmov d=17 n=9", "str i=5 n=0 t=17",
+		"movn d=9 h=0 i=0", "strh i=24 n=0 t=9",
+		"exit_f:", "ret n=30", "padding", "padding",
+	}
+	if got := functionInstructions(listing, "f"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConstantErrors(t *testing.T) {
+	got := diagnosticStrings(compileErrors(compileSource(t, `package: t
+const: seats 400
+const: seats 401
+const: x o.a
+type: o { r int e byte }
+function: f {
+    > o
+    + o { r <- seats e <- 300 }
+}
+`)))
+	want := []string{
+		"A201 3:8 Duplicate constant definition: seats",
+		"A204 4:10 Constant x is not a literal or constant expression",
+		"A204 8:22 Literal 300 does not fit o.e byte",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMoveImmediate(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []uint32 // x9, as assembled by llvm-mc
+	}{
+		{0, []uint32{0xd2800009}},                                   // movz x9, #0
+		{1, []uint32{0xd2800029}},                                   // movz x9, #1
+		{0x1234, []uint32{0xd2824689}},                              // movz x9, #0x1234
+		{0x5678000012340000, []uint32{0xd2a24689, 0xf2eacf09}},      // movz x9, #0x1234, lsl 16; movk x9, #0x5678, lsl 48
+		{0xff, []uint32{0xd2801fe9}},                                // movz x9, #0xff, as three halfwords are zero
+		{0x00ff00ff00ff00ff, []uint32{0xb2009fe9}},                  // orr x9, xzr, #0x00ff00ff00ff00ff
+		{0x5555555555555555, []uint32{0xb200f3e9}},                  // orr x9, xzr, #0x5555555555555555
+		{0x100000001, []uint32{0xb20003e9}},                         // orr x9, xzr, #0x100000001
+		{^uint64(0), []uint32{0x92800009}},                          // movn x9, #0
+		{0xffffffffffffedcc, []uint32{0x92824669}},                  // movn x9, #0x1233
+		{0xffffffffabcdedcb, []uint32{0x92824689, 0xf2b579a9}},      // movn x9, #0x1234; movk x9, #0xabcd, lsl 16
+		{0x100010001, []uint32{0xd2800029, 0xf2a00029, 0xf2c00029}}, // movz, movk lsl 16, movk lsl 32
+	}
+	p := &testProfile(t).profile
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%#x", tt.value), func(t *testing.T) {
+			if got := moveImmediate(p, register{index: 9}, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %08x, want %08x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogicalImmediate(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  int // N:immr:imms
+		ok    bool
+	}{
+		{0xff, 0x1007, true},
+		{0x5555555555555555, 0x3c, true},
+		{0xaaaaaaaaaaaaaaaa, 0x7c, true},
+		{0x00ff00ff00ff00ff, 0x27, true},
+		{0x8000000000000001, 0x1041, true},
+		{0xfffffffffffffffe, 0x1ffe, true},
+		{0x100000001, 0x0, true},
+		{0, 0, false},
+		{^uint64(0), 0, false},
+		{0x5, 0, false},
+		{0x1234, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%#x", tt.value), func(t *testing.T) {
+			if got, ok := logicalImmediate(tt.value); ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("got %#x %v, want %#x %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFloatImmediate(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  int // the 8 bit immediate of an fmov
+		ok    bool
+	}{
+		{2.0, 0x00, true},
+		{1.0, 0x70, true},
+		{-0.5, 0xe0, true},
+		{31.0, 0x3f, true},
+		{0.125, 0x40, true},
+		{0, 0, false},
+		{0.1, 0, false},
+		{32.0, 0, false},
+		{0.0625, 0, false},
+		{1.0 / 3, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.value), func(t *testing.T) {
+			if got, ok := floatImmediate(math.Float64bits(tt.value)); ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("got %#x %v, want %#x %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
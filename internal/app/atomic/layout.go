@@ -0,0 +1,573 @@
+package atomic
+
+import (
+	"sort"
+	"strings"
+)
+
+var pointerPrimative = primative{
+	name:  "pointer",
+	size:  8, // assuming 64 bit architecture
+	align: 8,
+}
+
+// layout states of structs, detecting structs which contain themselves by value
+const (
+	layoutPending = iota
+	layoutActive
+	layoutDone
+)
+
+// resolves field types and computes sizes, offsets and alignment, once the structs of all units are known.
+// enums are resolved first, as fields of them take their primative
+func (r reference) layout(p *profile, d *diagnostics) {
+	enums := make([]string, 0, len(r.enums))
+	for name := range r.enums {
+		enums = append(enums, name)
+	}
+	sort.Strings(enums)
+	for _, name := range enums {
+		r.layoutEnum(p, name, d)
+	}
+
+	names := make([]string, 0, len(r.structs))
+	for name := range r.structs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	state := make(map[string]int, len(names))
+	for _, name := range names {
+		r.layoutStruct(p, name, state, d)
+	}
+}
+
+// lays out fields in declaration order, each aligned to its natural alignment unless the struct is packed.
+// the struct is aligned to its most aligned field or declared alignment, and padded to a multiple of it,
+// which matches C struct layout in the AAPCS64 abi given the primative sizes and alignments of the profile.
+// returns false if the struct is already being laid out, which means it contains itself by value
+func (r reference) layoutStruct(p *profile, name string, state map[string]int, d *diagnostics) bool {
+	switch state[name] {
+	case layoutDone:
+		return true
+	case layoutActive:
+		return false
+	}
+	state[name] = layoutActive
+
+	s := r.structs[name]
+	if s.variant {
+		r.layoutVariant(p, name, state, d)
+		state[name] = layoutDone
+		return true
+	}
+	s.fields = s.fields[:0]
+	off := 0
+	end := 0 // the bit following the last field, which a bit field may share a word with
+	alignment := 1
+	for _, fa := range r.declarations[name].sub {
+		fn, ok := fa.node.(*fieldNode)
+		if !ok {
+			continue
+		}
+		f := field{
+			name: fn.name,
+		}
+		var bits primative
+		if fn.bits > 0 {
+			bits = bitsPrimative(p, fn.typ, fn.bits)
+		} else if pr, ok := p.primative(fn.typ); ok && pr.boolean && s.packed && !fn.pointer && !fn.stream &&
+			fn.length == 0 && fn.bound == "" {
+			bits = pr // bools of packed structs share words, as single bits
+			bits.bits = 1
+		}
+		if bits.bits > 0 {
+			if fn.order != "" {
+				d.errorf(codeType, fa.span, "Byte order can only be declared for integer fields, not bit field %s", fn.name)
+				continue
+			}
+			if fn.pointer || fn.stream || fn.length > 0 || fn.bound != "" {
+				d.errorf(codeUnknownType, fa.span, "Bit field %s can not be a pointer, array, stream or buffer", fn.name)
+				continue
+			}
+			if end, ok = layoutBits(p, &f, bits, end, s.packed); !ok {
+				d.errorf(codeOffset, fa.span, "Bit field %s.%s can not be accessed through a single aligned word", name, fn.name)
+				continue
+			}
+			s.fields = append(s.fields, f)
+			off = alignUp(end, 8) / 8
+			if !s.packed && bits.align > alignment {
+				alignment = bits.align // of its declared word, as C aligns the struct
+			}
+			continue
+		}
+		falign := 1
+		if _, ok := r.structs[fn.typ]; ok {
+			f.typ = fn.typ
+			// the elements of a buffer or a descriptor stream are reached through a pointer, laid out once they're reached
+			if fn.pointer || fn.bound != "" || (fn.stream && fn.length == 0) {
+				f.pointer = fn.pointer
+				f.prim = p.layout(pointerPrimative)
+				f.size = f.prim.size
+				falign = f.prim.align
+			} else if r.layoutStruct(p, fn.typ, state, d) {
+				f.size = r.structs[fn.typ].size
+				falign = r.structs[fn.typ].alignment
+			} else {
+				d.errorf(codeRecursive, fa.span, "Type %s contains itself by value through field %s, use a pointer *%s",
+					fn.typ, fn.name, fn.typ)
+				continue
+			}
+		} else if _, ok := r.functions[fn.typ]; ok && fn.pointer { // a function pointer
+			f.typ = fn.typ
+			f.pointer = true
+			f.prim = p.layout(pointerPrimative)
+			f.size = f.prim.size
+			falign = f.prim.align
+		} else if _, ok := r.functions[fn.typ]; ok {
+			d.errorf(codeUnknownType, fa.span, "Function %s can only be referenced by a pointer *%s", fn.typ, fn.typ)
+			continue
+		} else if e, ok := r.enums[fn.typ]; ok && !fn.pointer {
+			if !e.prim.integer {
+				continue // the enum is in error
+			}
+			f.prim = e.prim
+			f.enum = e.name
+			f.size = f.prim.size
+			falign = f.prim.align
+		} else if ok {
+			d.errorf(codeUnknownType, fa.span, "Pointers to enum %s are not supported", fn.typ)
+			continue
+		} else if pr, ok := p.primative(fn.typ); ok && !fn.pointer {
+			f.prim = pr
+			f.size = pr.size
+			falign = pr.align
+		} else if ok {
+			d.errorf(codeUnknownType, fa.span, "Pointers to primative %s are not supported", fn.typ)
+			continue
+		} else {
+			d.errorf(codeUnknownType, fa.span, "Unknown type %s", fn.typ)
+			continue
+		}
+		switch {
+		case fn.bound != "" && (fn.pointer || fn.stream):
+			d.errorf(codeUnknownType, fa.span, "Buffers of pointers or streams are not supported, use a buffer of %s", fn.typ)
+			continue
+		case fn.bound != "":
+			pr := p.layout(pointerPrimative)
+			f.bound = fn.bound
+			f.size, falign = pr.size, pr.align
+		case fn.stream && fn.pointer:
+			d.errorf(codeUnknownType, fa.span, "Streams of pointers are not supported, use a stream of %s", fn.typ)
+			continue
+		case fn.stream:
+			f.stream = true
+			f.capacity = fn.length
+			f.size, falign = streamLayout(f.size, falign, fn.length)
+		case fn.length > 0:
+			f.length = fn.length
+			f.size *= fn.length
+		}
+		if fn.order != "" && (!f.prim.integer || f.typ != "" || f.stream || f.bound != "") {
+			d.errorf(codeType, fa.span, "Byte order can only be declared for integer fields and arrays of them, not %s", fn.name)
+			continue
+		}
+		f.order = fn.order
+		if s.packed {
+			falign = 1
+		}
+		off = alignUp(off, falign)
+		f.offset = off
+		s.fields = append(s.fields, f)
+		off += f.size
+		end = off * 8
+		if falign > alignment {
+			alignment = falign
+		}
+	}
+	for _, fa := range r.declarations[name].sub {
+		if fn, ok := fa.node.(*fieldNode); ok && fn.bound != "" && !s.countable(fn.bound) {
+			d.errorf(codeType, fa.span, "Length %s of buffer %s.%s is not an integer field of %s", fn.bound, name, fn.name, name)
+		}
+	}
+	if s.align > alignment {
+		alignment = s.align
+	}
+	s.alignment = alignment
+	s.size = alignUp(off, alignment)
+	for _, f := range s.fields {
+		if f.prim.bits > 0 && f.offset+f.size > s.size {
+			d.errorf(codeOffset, r.declarations[name].span, "Bit field %s.%s can not be accessed without reaching past the end of %s",
+				name, f.name, name)
+		}
+	}
+
+	state[name] = layoutDone
+	return true
+}
+
+// returns true if a field may count the elements of a buffer, an integer held by value
+func (s *structNode) countable(name string) bool {
+	f := s.fieldNamed(name)
+	return f.prim.integer && f.prim.bits == 0 && (f.order == "" || f.order == nativeOrder) && f.typ == "" && f.enum == "" && f.length == 0 && !f.stream && f.bound == ""
+}
+
+func alignUp(off int, align int) int {
+	return (off + align - 1) &^ (align - 1)
+}
+
+// a primative reached from the base of a struct, possibly through nested structs and pointers
+type fieldPath struct {
+	path     string // dotted field names from the base eg. pass.passengerName
+	name     string // the final field name
+	prim     primative
+	typ      string       // the struct type or function referenced by a pointer field
+	enum     string       // the enum of the field, whose primative holds its members
+	offset   int          // from the base, or from the last pointer loaded
+	bit      int          // the offset of a bit field within the word at its offset
+	order    string       // the declared byte order of an integer field, be or le
+	derefs   []int        // offsets of pointers loaded in turn, before accessing the field
+	nested   bool         // a struct, array or stream held by value, which has an address but no primative
+	length   int          // the elements of an array which isn't indexed
+	element  string       // the type of the elements of an array which isn't indexed, or of a stream
+	stream   bool         // a stream, a descriptor or a fixed buffer of its elements
+	capacity int          // the elements of a fixed buffer stream
+	buffer   bool         // a buffer read and written as a stream, a pointer to elements counted by another field
+	count    int          // the offset of the length of a buffer, from the same base as its pointer
+	counter  primative    // the primative of the length of a buffer
+	indexes  []arrayIndex // indexes of arrays read from fields, added to the base in turn
+}
+
+// an index of an array read from a field of an input, scaled by the size of the elements and added to the base
+// once the given number of pointers have been loaded. an index of an array of primatives is scaled by the load
+// or store of the field itself
+type arrayIndex struct {
+	input  string
+	field  fieldPath
+	derefs int
+	size   int
+	access bool
+	// the index of a buffer is checked against its length, read from the base before its pointer is loaded.
+	// a constant index is folded into the offset, so it's only checked
+	buffer   string // the dotted path of the buffer from its input, identifying the checks of it
+	count    int
+	counter  primative
+	constant int64
+}
+
+// flattens nested struct fields, optionally following pointers to the structs they reference
+func (r *reference) flatten(s *structNode, throughPointers bool) []fieldPath {
+	var paths []fieldPath
+	r.flattenInto(&paths, s, nil, 0, nil, throughPointers, map[string]bool{s.name: true})
+	return paths
+}
+
+func (r *reference) flattenInto(paths *[]fieldPath, s *structNode, prefix []string, base int, derefs []int,
+	throughPointers bool, visiting map[string]bool) {
+
+	if s.variant {
+		return // the member a variant holds is only reached by switching on it, or populated as a member
+	}
+	for _, f := range s.fields {
+		if f.length > 0 || f.stream || f.bound != "" {
+			continue // elements of arrays, streams and buffers are reached by indexes and reads, they aren't populated by name
+		}
+		names := append(append([]string{}, prefix...), f.name)
+		if f.typ == "" || f.pointer {
+			*paths = append(*paths, fieldPath{
+				path:   strings.Join(names, "."),
+				name:   f.name,
+				prim:   f.prim,
+				typ:    f.typ,
+				enum:   f.enum,
+				offset: base + f.offset,
+				bit:    f.bit,
+				order:  f.order,
+				derefs: derefs,
+			})
+		}
+		nested, ok := r.structs[f.typ]
+		if !ok || (f.pointer && (!throughPointers || visiting[f.typ])) {
+			continue
+		}
+
+		visiting[f.typ] = true
+		if f.pointer {
+			r.flattenInto(paths, nested, names, 0, append(append([]int{}, derefs...), base+f.offset), throughPointers, visiting)
+		} else {
+			r.flattenInto(paths, nested, names, base+f.offset, derefs, throughPointers, visiting)
+		}
+		visiting[f.typ] = false
+	}
+}
+
+// resolves a dotted field path within a struct, following pointers to the structs they reference and indexing
+// arrays, reporting paths which don't resolve and constant indexes outside their arrays. unlike flatten, the path
+// may end at a struct or array held by value
+func (r *reference) lookup(s *structNode, path string, d *diagnostics, at span) (fieldPath, bool) {
+	root := s.name
+	names := splitPath(path)
+	base := 0
+	var derefs []int
+	var indexes []arrayIndex
+	for i, segment := range names {
+		name, index := splitIndex(segment)
+		var f *field
+		for fi := range s.fields {
+			if s.fields[fi].name == name {
+				f = &s.fields[fi]
+			}
+		}
+		if f == nil {
+			d.errorf(codeUnresolved, at, "Type %s has no field %s", root, path)
+			return fieldPath{}, false
+		}
+		if s.variant && name != "tag" {
+			// the member held is only known within the arm of a switch taken for it
+			d.errorf(codeType, at, "Member %s of variant %s is reached through a switch: on it",
+				name, strings.TrimSuffix(root+"."+strings.Join(names[:i], "."), "."))
+			return fieldPath{}, false
+		}
+		last := i == len(names)-1
+		offset := base + f.offset
+		switch {
+		case f.stream && (index != "" || !last):
+			d.errorf(codeType, at, "Stream %s.%s can only be read and written, not reached by %s",
+				root, strings.Join(append(names[:i:i], name), "."), path)
+			return fieldPath{}, false
+		case f.stream:
+			return fieldPath{
+				path:     path,
+				name:     name,
+				offset:   offset,
+				derefs:   derefs,
+				nested:   true,
+				element:  elementName(*f),
+				stream:   true,
+				capacity: f.capacity,
+				indexes:  indexes,
+			}, true
+		case f.bound != "" && index == "" && last:
+			count := s.fieldNamed(f.bound)
+			return fieldPath{
+				path:    path,
+				name:    name,
+				offset:  offset,
+				derefs:  derefs,
+				nested:  true,
+				element: elementName(*f),
+				stream:  true,
+				buffer:  true,
+				count:   base + count.offset,
+				counter: count.prim,
+				indexes: indexes,
+			}, true
+		case f.bound != "" && index == "":
+			d.errorf(codeType, at, "Buffer %s.%s must be indexed to reach %s", root, strings.Join(names[:i+1], "."), path)
+			return fieldPath{}, false
+		case f.bound != "":
+			// the pointer to the elements is loaded, then the index is added to it
+			count := s.fieldNamed(f.bound)
+			ix := arrayIndex{
+				buffer:  root + "." + strings.Join(append(names[:i:i], name), "."),
+				count:   base + count.offset,
+				counter: count.prim,
+			}
+			derefs = append(append([]int{}, derefs...), offset)
+			size := r.elementSize(*f)
+			base = 0
+			if n, err := parseInteger(index); err == nil {
+				if n < 0 {
+					d.errorf(codeBounds, at, "Index %d is outside %s", n, ix.buffer)
+					return fieldPath{}, false
+				}
+				ix.constant = n
+				base = int(n) * size
+			} else {
+				field, ok := r.lookupIndex(index, d, at)
+				if !ok {
+					return fieldPath{}, false
+				}
+				ix.input, ix.field = field.input, field.field
+				ix.access = last && f.typ == ""
+			}
+			ix.derefs = len(derefs)
+			ix.size = size
+			indexes = append(indexes, ix)
+			if last {
+				return fieldPath{
+					path:    path,
+					name:    name,
+					prim:    f.prim,
+					typ:     f.typ,
+					enum:    f.enum,
+					offset:  base,
+					derefs:  derefs,
+					nested:  f.typ != "",
+					indexes: indexes,
+				}, true
+			}
+			if s = r.structs[f.typ]; s == nil {
+				d.errorf(codeUnresolved, at, "Type %s has no field %s", root, path)
+				return fieldPath{}, false
+			}
+			continue
+		case index != "" && f.length == 0:
+			d.errorf(codeType, at, "Field %s.%s is not an array", root, strings.Join(append(names[:i:i], name), "."))
+			return fieldPath{}, false
+		case index != "":
+			size := f.size / f.length
+			if n, err := parseInteger(index); err == nil {
+				if n < 0 || n >= int64(f.length) {
+					d.errorf(codeBounds, at, "Index %d is outside %s.%s, which has %d elements",
+						n, root, strings.Join(append(names[:i:i], name), "."), f.length)
+					return fieldPath{}, false
+				}
+				offset += int(n) * size
+				break
+			}
+			ix, ok := r.lookupIndex(index, d, at)
+			if !ok {
+				return fieldPath{}, false
+			}
+			ix.derefs = len(derefs)
+			ix.size = size
+			ix.access = last && (f.typ == "" || f.pointer)
+			indexes = append(indexes, ix)
+		case f.length > 0 && last:
+			return fieldPath{
+				path:    path,
+				name:    name,
+				offset:  offset,
+				derefs:  derefs,
+				nested:  true,
+				length:  f.length,
+				element: elementName(*f),
+				indexes: indexes,
+			}, true
+		case f.length > 0:
+			d.errorf(codeType, at, "Array %s.%s must be indexed to reach %s", root, strings.Join(names[:i+1], "."), path)
+			return fieldPath{}, false
+		}
+		if last {
+			return fieldPath{
+				path:    path,
+				name:    name,
+				prim:    f.prim,
+				typ:     f.typ,
+				enum:    f.enum,
+				offset:  offset,
+				bit:     f.bit,
+				order:   f.order,
+				derefs:  derefs,
+				nested:  f.typ != "" && !f.pointer,
+				indexes: indexes,
+			}, true
+		}
+		nested, ok := r.structs[f.typ]
+		if !ok {
+			d.errorf(codeUnresolved, at, "Type %s has no field %s", root, path)
+			return fieldPath{}, false
+		}
+		if f.pointer {
+			derefs = append(append([]int{}, derefs...), offset)
+			base = 0
+		} else {
+			base = offset
+		}
+		s = nested
+	}
+	return fieldPath{}, false
+}
+
+// returns the field of a struct with the given name
+func (s *structNode) fieldNamed(name string) field {
+	for _, f := range s.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return field{}
+}
+
+// the size of the elements a buffer points to
+func (r *reference) elementSize(f field) int {
+	if s, ok := r.structs[f.typ]; ok {
+		return s.size
+	}
+	return f.prim.size
+}
+
+// the type of the elements of an array, stream or buffer field
+func elementName(f field) string {
+	switch {
+	case f.pointer:
+		return "*" + f.typ
+	case f.enum != "":
+		return f.enum
+	case f.typ == "":
+		return f.prim.name
+	}
+	return f.typ
+}
+
+// resolves the field an array is indexed by, which must be an integer
+func (r *reference) lookupIndex(index string, d *diagnostics, at span) (arrayIndex, bool) {
+	split := strings.SplitN(index, ".", 2)
+	s, ok := r.structs[split[0]]
+	if len(split) < 2 || !ok {
+		d.errorf(codeType, at, "Index %s is not an integer or a field of an input", index)
+		return arrayIndex{}, false
+	}
+	fp, ok := r.lookup(s, split[1], d, at)
+	if !ok {
+		return arrayIndex{}, false
+	}
+	if !fp.prim.integer || fp.typ != "" {
+		d.errorf(codeType, at, "Index %s %s is not an integer", index, typeName(fp))
+		return arrayIndex{}, false
+	}
+	return arrayIndex{
+		input: split[0],
+		field: fp,
+	}, true
+}
+
+// splits a field path at the dots outside its indexes eg. seats[pass.seat].number
+func splitPath(path string) []string {
+	var names []string
+	depth, from := 0, 0
+	for i, c := range path {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0:
+			names = append(names, path[from:i])
+			from = i + 1
+		}
+	}
+	return append(names, path[from:])
+}
+
+// splits the name of a field from its index eg. seats[3] into seats and 3
+func splitIndex(segment string) (string, string) {
+	i := strings.IndexByte(segment, '[')
+	if i < 0 || !strings.HasSuffix(segment, "]") {
+		return segment, ""
+	}
+	return segment[:i], segment[i+1 : len(segment)-1]
+}
+
+// returns the inputs the indexes of a field path are read from
+func indexInputs(path string) []string {
+	var inputs []string
+	for _, segment := range splitPath(path) {
+		_, index := splitIndex(segment)
+		if split := strings.SplitN(index, ".", 2); len(split) == 2 {
+			inputs = append(append(inputs, split[0]), indexInputs(split[1])...)
+		}
+	}
+	return inputs
+}
@@ -0,0 +1,159 @@
+package atomic
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fields typed by structs declared in any file, by value or through pointers, with recursion by value reported
+func TestTypedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		want    []string // diagnostics
+	}{
+		{"struct and pointer fields", []string{"package: t\ntype: airport { code int hub *airport }\n" +
+			"type: pass { gate short dep airport arr *airport }\nfunction: f {\n    > pass\n}\n"}, nil},
+		{"declared in another file", []string{
+			"package: a\ntype: pass { gate short dep airport }\nfunction: f {\n    > pass\n}\n",
+			"package: b\ntype: airport { code int }\n",
+		}, nil},
+		{"recursion by value", []string{"package: t\ntype: a { b b }\ntype: b { c c n int }\ntype: c { a a }\n"}, []string{
+			"A203 4:11 Type a contains itself by value through field a, use a pointer *a",
+		}},
+		{"recursion through pointers", []string{"package: t\ntype: d { self *d next [2]*d }\n"}, nil},
+		{"recursion through a stream", []string{"package: t\ntype: node { v int next stream node }\n"}, nil},
+		{"recursion through a fixed stream", []string{"package: t\ntype: node { v int next stream [2]node }\n"}, []string{
+			"A203 2:20 Type node contains itself by value through field next, use a pointer *node",
+		}},
+		{"unknown types", []string{"package: t\ntype: e { f missing g *missing }\n"}, []string{
+			"A200 2:11 Unknown type missing",
+			"A200 2:21 Unknown type missing",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []Source
+			for i, s := range tt.sources {
+				sources = append(sources, Source{Filename: string(rune('a'+i)) + ".atomic", Data: []byte(s)})
+			}
+			got := diagnosticStrings(Compile(sources, Options{Profile: testProfile(t), Concurrency: 1}).Diagnostics)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// layouts as a C compiler lays out the same structs, asserted by the header
+var layoutTests = []struct {
+	name  string
+	types string
+	want  []string // static assertions of the header
+}{
+	{"natural alignment", "type: s { b bool l long h short }", []string{
+		"sizeof(struct s) == 24", "_Alignof(struct s) == 8",
+		"offsetof(struct s, b) == 0", "offsetof(struct s, l) == 8", "offsetof(struct s, h) == 16",
+	}},
+	{"tail padding", "type: s { l long i int b byte }", []string{
+		"sizeof(struct s) == 16", "_Alignof(struct s) == 8",
+		"offsetof(struct s, i) == 8", "offsetof(struct s, b) == 12",
+	}},
+	{"packed", "type: s packed { b byte l long h short }", []string{
+		"sizeof(struct s) == 11", "_Alignof(struct s) == 1",
+		"offsetof(struct s, l) == 1", "offsetof(struct s, h) == 9",
+	}},
+	{"aligned", "type: s align 16 { i int }", []string{
+		"sizeof(struct s) == 16", "_Alignof(struct s) == 16",
+	}},
+	{"packed and aligned", "type: s packed align 4 { b byte i int }", []string{
+		"sizeof(struct s) == 8", "_Alignof(struct s) == 4", "offsetof(struct s, i) == 1",
+	}},
+	{"nested struct", "type: inner { b byte l long }\ntype: s { b byte i inner d double }", []string{
+		"sizeof(struct s) == 32", "_Alignof(struct s) == 8",
+		"offsetof(struct s, i) == 8", "offsetof(struct s, d) == 24",
+	}},
+	{"pointers", "type: inner { l long }\ntype: s { b byte p *inner h short }", []string{
+		"sizeof(struct s) == 24", "_Alignof(struct s) == 8",
+		"offsetof(struct s, p) == 8", "offsetof(struct s, h) == 16",
+	}},
+	{"enum", "enum: seat short { economy premium business = 5 first }\ntype: s { b byte c seat l long }", []string{
+		"sizeof(struct s) == 16", "_Alignof(struct s) == 8",
+		"offsetof(struct s, c) == 2", "offsetof(struct s, l) == 8",
+	}},
+	{"arrays", "type: inner { h short b byte }\ntype: s { b byte a [3]int i [2]inner d [2]double }", []string{
+		"sizeof(struct s) == 40", "_Alignof(struct s) == 8",
+		"offsetof(struct s, a) == 4", "offsetof(struct s, i) == 16", "offsetof(struct s, d) == 24",
+	}},
+	{"streams", "type: inner { h short b byte }\ntype: s { b byte legs stream inner codes stream [5]inner n int }", []string{
+		"sizeof(struct s) == 88", "_Alignof(struct s) == 8",
+		"offsetof(struct s, legs) == 8", "offsetof(struct s, codes) == 40", "offsetof(struct s, n) == 80",
+	}},
+	{"bit fields", "type: s { kind bits:3 delta sbits:5 wide bits:12 b byte on bool }", []string{
+		"sizeof(struct s) == 6", "_Alignof(struct s) == 2", "offsetof(struct s, b) == 4", "offsetof(struct s, on) == 5",
+	}},
+	{"packed bools", "type: s packed { a bool b bool n byte c bool }", []string{
+		"sizeof(struct s) == 3", "_Alignof(struct s) == 1", "offsetof(struct s, n) == 1",
+	}},
+	{"variant", "type: card { number long cvv short }\ntype: cash { amount int }\nvariant: payment { card cash }\n" +
+		"type: s { id int pay payment }", []string{
+		"sizeof(struct payment) == 24", "_Alignof(struct payment) == 8",
+		"offsetof(struct payment, card) == 8", "offsetof(struct payment, cash) == 8",
+		"sizeof(struct s) == 32", "offsetof(struct s, pay) == 8",
+	}},
+	{"buffers", "type: inner { h short b byte }\ntype: s { b byte n short legs buffer [n]inner }", []string{
+		"sizeof(struct s) == 16", "_Alignof(struct s) == 8",
+		"offsetof(struct s, n) == 2", "offsetof(struct s, legs) == 8",
+	}},
+}
+
+func TestLayout(t *testing.T) {
+	cc, _ := exec.LookPath("cc")
+	for _, tt := range layoutTests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := compileSource(t, "package: t\n"+tt.types+"\nfunction: f {\n    > s\n}\n")
+			if errors := compileErrors(r); len(errors) > 0 {
+				t.Fatalf("unexpected errors: %v", errors)
+			}
+			header := r.Files[0].Header
+			for _, want := range tt.want {
+				if !strings.Contains(header, "_Static_assert("+want+",") {
+					t.Errorf("missing %s\n%s", want, header)
+				}
+			}
+			if cc == "" {
+				return
+			}
+			// the C compiler checks the static assertions agree with its layout
+			file := filepath.Join(t.TempDir(), "test.c")
+			if err := os.WriteFile(file, []byte(header), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(cc, "-std=c11", "-fsyntax-only", file).CombinedOutput(); err != nil {
+				t.Errorf("%v\n%s\n%s", err, out, header)
+			}
+		})
+	}
+}
+
+func TestLayoutAttributes(t *testing.T) {
+	tests := []struct {
+		types string
+		want  []string
+	}{
+		{"type: s align 3 { i int }", []string{"A100 2:15 Alignment must be a power of two: 3"}},
+		{"type: s align 0 { i int }", []string{"A100 2:15 Alignment must be a power of two: 0"}},
+		{"type: s tight { i int }", []string{"A100 2:9 Unknown type attribute: tight"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.types, func(t *testing.T) {
+			if got := compileDiagnostics(t, "package: t\n"+tt.types+"\n"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package atomic
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenKeyword // an identifier immediately followed by a colon eg. type:
+	tokenNumber
+	tokenString
+	tokenPunct
+	tokenComment
+	tokenIllegal
+)
+
+var tokenKindNames = map[tokenKind]string{
+	tokenEOF:     "end of file",
+	tokenIdent:   "identifier",
+	tokenKeyword: "keyword",
+	tokenNumber:  "number",
+	tokenString:  "string",
+	tokenPunct:   "punctuation",
+	tokenComment: "comment",
+	tokenIllegal: "illegal character",
+}
+
+func (k tokenKind) String() string {
+	return tokenKindNames[k]
+}
+
+// a location in a source file. lines and columns start at 1, columns count runes.
+type position struct {
+	filename string
+	line     int
+	col      int
+}
+
+func (p position) String() string {
+	if p.col == 0 {
+		return fmt.Sprintf("%s:%d", p.filename, p.line)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.filename, p.line, p.col)
+}
+
+// the source range of a token or node, end is exclusive
+type span struct {
+	start position
+	end   position
+}
+
+func (s span) String() string {
+	return s.start.String()
+}
+
+// returns a span covering both spans
+func (s span) to(e span) span {
+	return span{start: s.start, end: e.end}
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	span span
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return t.kind.String()
+	}
+	return fmt.Sprintf("%s '%s'", t.kind, t.text)
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+type lexer struct {
+	source []byte
+	offset int
+	pos    position
+}
+
+func newLexer(filename string, source []byte) *lexer {
+	return &lexer{
+		source: source,
+		pos: position{
+			filename: filename,
+			line:     1,
+			col:      1,
+		},
+	}
+}
+
+func (l *lexer) peekRune(ahead int) rune {
+	off := l.offset
+	for {
+		if off >= len(l.source) {
+			return -1
+		}
+		r, size := utf8.DecodeRune(l.source[off:])
+		if ahead == 0 {
+			return r
+		}
+		ahead--
+		off += size
+	}
+}
+
+func (l *lexer) nextRune() rune {
+	if l.offset >= len(l.source) {
+		return -1
+	}
+	r, size := utf8.DecodeRune(l.source[l.offset:])
+	l.offset += size
+	if r == '\n' {
+		l.pos.line++
+		l.pos.col = 1
+	} else {
+		l.pos.col++
+	}
+	return r
+}
+
+// returns the next token, including comments
+func (l *lexer) next() token {
+	for unicode.IsSpace(l.peekRune(0)) {
+		l.nextRune()
+	}
+
+	start := l.pos
+	from := l.offset
+	kind := tokenIllegal
+
+	r := l.peekRune(0)
+	switch {
+	case r == -1:
+		return token{kind: tokenEOF, span: span{start: start, end: start}}
+	case r == ';':
+		for r := l.peekRune(0); r != '\n' && r != -1; r = l.peekRune(0) {
+			l.nextRune()
+		}
+		kind = tokenComment
+	case isIdentStart(r):
+		for isIdentPart(l.peekRune(0)) {
+			l.nextRune()
+		}
+		kind = tokenIdent
+		if l.peekRune(0) == ':' {
+			l.nextRune()
+			kind = tokenKeyword
+		}
+	case unicode.IsDigit(r):
+		for isIdentPart(l.peekRune(0)) {
+			l.nextRune()
+		}
+		if l.peekRune(0) == '.' && unicode.IsDigit(l.peekRune(1)) {
+			l.nextRune()
+			for isIdentPart(l.peekRune(0)) {
+				l.nextRune()
+			}
+		}
+		kind = tokenNumber
+	case r == '"':
+		l.nextRune()
+		for {
+			r := l.nextRune()
+			if r == '"' {
+				kind = tokenString
+				break
+			}
+			if r == '\\' {
+				l.nextRune()
+				continue
+			}
+			if r == '\n' || r == -1 {
+				break // unterminated string is left illegal
+			}
+		}
+	case pairs[string([]rune{r, l.peekRune(1)})]:
+		l.nextRune()
+		l.nextRune()
+		kind = tokenPunct
+	case unicode.IsPunct(r) || unicode.IsSymbol(r):
+		l.nextRune()
+		kind = tokenPunct
+	default:
+		l.nextRune()
+	}
+
+	return token{
+		kind: kind,
+		text: string(l.source[from:l.offset]),
+		span: span{start: start, end: l.pos},
+	}
+}
+
+// punctuation of two characters, the mapping and stream arrows, comparison and shift operators
+var pairs = map[string]bool{"<-": true, "->": true, "==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true,
+	"<<": true, ">>": true}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
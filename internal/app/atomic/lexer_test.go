@@ -0,0 +1,91 @@
+package atomic
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// lexes a source to its tokens, written as kind 'text' line:col-line:col
+func lexTokens(source string) []string {
+	var tokens []string
+	l := newLexer("test.atomic", []byte(source))
+	for {
+		t := l.next()
+		if t.kind == tokenEOF {
+			return tokens
+		}
+		tokens = append(tokens, fmt.Sprintf("%s %d:%d-%d:%d", t, t.span.start.line, t.span.start.col,
+			t.span.end.line, t.span.end.col))
+	}
+}
+
+func TestLexer(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"keyword and identifier", "type: leg", []string{
+			"keyword 'type:' 1:1-1:6",
+			"identifier 'leg' 1:7-1:10",
+		}},
+		{"field path", "pass.seat.row", []string{
+			"identifier 'pass' 1:1-1:5",
+			"punctuation '.' 1:5-1:6",
+			"identifier 'seat' 1:6-1:10",
+			"punctuation '.' 1:10-1:11",
+			"identifier 'row' 1:11-1:14",
+		}},
+		{"numbers", "42 0x1f 0b101 1.5 7.x", []string{
+			"number '42' 1:1-1:3",
+			"number '0x1f' 1:4-1:8",
+			"number '0b101' 1:9-1:14",
+			"number '1.5' 1:15-1:18",
+			"number '7' 1:19-1:20",
+			"punctuation '.' 1:20-1:21",
+			"identifier 'x' 1:21-1:22",
+		}},
+		{"pairs of punctuation", "<- -> == != <= >= && || << >> < -", []string{
+			"punctuation '<-' 1:1-1:3",
+			"punctuation '->' 1:4-1:6",
+			"punctuation '==' 1:7-1:9",
+			"punctuation '!=' 1:10-1:12",
+			"punctuation '<=' 1:13-1:15",
+			"punctuation '>=' 1:16-1:18",
+			"punctuation '&&' 1:19-1:21",
+			"punctuation '||' 1:22-1:24",
+			"punctuation '<<' 1:25-1:27",
+			"punctuation '>>' 1:28-1:30",
+			"punctuation '<' 1:31-1:32",
+			"punctuation '-' 1:33-1:34",
+		}},
+		{"strings", `"gate \"7\"" "open`, []string{
+			`string '"gate \"7\""' 1:1-1:13`,
+			`illegal character '"open' 1:14-1:19`,
+		}},
+		{"comments and lines", "; a comment\n  + pass ;more\n}", []string{
+			"comment '; a comment' 1:1-1:12",
+			"punctuation '+' 2:3-2:4",
+			"identifier 'pass' 2:5-2:9",
+			"comment ';more' 2:10-2:15",
+			"punctuation '}' 3:1-3:2",
+		}},
+		{"columns count runes", "é_1 x", []string{
+			"identifier 'é_1' 1:1-1:4",
+			"identifier 'x' 1:5-1:6",
+		}},
+		{"illegal character", "a\x01b", []string{
+			"identifier 'a' 1:1-1:2",
+			"illegal character '\x01' 1:2-1:3",
+			"identifier 'b' 1:3-1:4",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lexTokens(tt.source); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package atomic
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// exported types for embedding the compiler, see pkg/atomic
+
+// Profile is a processor profile loaded for a target os.
+type Profile struct {
+	profile profile
+}
+
+// TargetOS returns the os the profile was loaded for.
+func (p *Profile) TargetOS() string {
+	return p.profile.targetos
+}
+
+// LoadProfile parses a processor profile for the target os. The name is only used in diagnostics.
+func LoadProfile(r io.Reader, name string, targetOS string) (*Profile, []Diagnostic) {
+	d := &diagnostics{}
+	p := readProfile(r, name, targetOS, false, d)
+	p.diags = nil
+	return &Profile{profile: p}, exportDiagnostics(d)
+}
+
+// Options configures a compilation.
+type Options struct {
+	Profile     *Profile
+	Concurrency int  // defaults to the host CPU count
+	Unchecked   bool // omits bounds checks, for trusted code
+}
+
+// Source is a named atomic source file.
+type Source struct {
+	Filename string
+	Data     []byte
+}
+
+// Result holds the compiled files and every diagnostic reported while compiling them.
+type Result struct {
+	Files       []File
+	Diagnostics []Diagnostic
+}
+
+// HasErrors returns true if any diagnostic is an error, in which case no objects are produced.
+func (r *Result) HasErrors() bool {
+	for _, d := range r.Diagnostics {
+		if d.Severity == severityError.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// File is the output for a single source file.
+type File struct {
+	Filename string
+	Object   []byte // linkable object, nil if there were errors
+	AST      Node
+	Listing  string // instructions and symbols of each function
+	Header   string // C declarations of the file's types, empty if there were errors
+}
+
+// Diagnostic is an error or warning with its source position.
+type Diagnostic struct {
+	Severity  string
+	Code      string
+	Filename  string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Message   string
+}
+
+func (d Diagnostic) String() string {
+	return d.diagnostic().String()
+}
+
+func (d Diagnostic) diagnostic() diagnostic {
+	sev := severityError
+	if d.Severity == severityWarning.String() {
+		sev = severityWarning
+	}
+	return diagnostic{
+		severity: sev,
+		code:     d.Code,
+		span: span{
+			start: position{filename: d.Filename, line: d.Line, col: d.Column},
+			end:   position{filename: d.Filename, line: d.EndLine, col: d.EndColumn},
+		},
+		message: d.Message,
+	}
+}
+
+// Node is a resolved AST node. Kind is the node type and Detail its attributes.
+type Node struct {
+	Kind     string
+	Detail   string
+	Line     int
+	Column   int
+	Children []Node
+}
+
+// Compile parses, resolves and compiles the sources without touching the filesystem.
+func Compile(sources []Source, o Options) Result {
+	d := &diagnostics{}
+	if o.Profile == nil {
+		d.errorf(codeProfile, span{}, "No profile provided")
+		return Result{Diagnostics: exportDiagnostics(d)}
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = runtime.NumCPU()
+	}
+
+	// the profile is shared, diagnostics belong to this compilation
+	p := o.Profile.profile
+	p.diags = d
+
+	ss := make([]source, len(sources))
+	for i, s := range sources {
+		ss[i] = source{
+			filename: s.Filename,
+			data:     s.Data,
+		}
+	}
+
+	units := compileUnits(ss, &p, o.Concurrency, o.Unchecked, d)
+
+	r := Result{
+		Files: make([]File, 0, len(units)),
+	}
+	for _, u := range units {
+		var listing strings.Builder
+		for _, a := range u.asms {
+			a.writeListing(&listing, &p)
+		}
+		root := exportNode(&u.ast)
+		root.Kind = "unit"
+		root.Detail = u.filename
+		r.Files = append(r.Files, File{
+			Filename: u.filename,
+			Object:   u.object,
+			AST:      root,
+			Listing:  listing.String(),
+			Header:   string(u.header),
+		})
+	}
+	r.Diagnostics = exportDiagnostics(d)
+	return r
+}
+
+func exportDiagnostics(d *diagnostics) []Diagnostic {
+	list := d.sorted()
+	ds := make([]Diagnostic, 0, len(list))
+	for _, dg := range list {
+		ds = append(ds, Diagnostic{
+			Severity:  dg.severity.String(),
+			Code:      dg.code,
+			Filename:  dg.span.start.filename,
+			Line:      dg.span.start.line,
+			Column:    dg.span.start.col,
+			EndLine:   dg.span.end.line,
+			EndColumn: dg.span.end.col,
+			Message:   dg.message,
+		})
+	}
+	return ds
+}
+
+func exportNode(a *ast) Node {
+	n := Node{
+		Line:   a.span.start.line,
+		Column: a.span.start.col,
+	}
+	if a.node != nil {
+		n.Kind = strings.TrimSuffix(reflect.TypeOf(a.node).Elem().Name(), "Node")
+		n.Detail = strings.TrimPrefix(strings.TrimSuffix(fmt.Sprintf("%+v", a.node), "}"), "&{")
+	}
+	for i := range a.sub {
+		n.Children = append(n.Children, exportNode(&a.sub[i]))
+	}
+	return n
+}
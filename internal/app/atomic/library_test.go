@@ -0,0 +1,125 @@
+package atomic
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// returns the kinds of the nodes of an ast, depth first, with their positions
+func nodeKinds(n Node) []string {
+	kinds := []string{n.Kind + " " + position{line: n.Line, col: n.Column}.String()}
+	for _, c := range n.Children {
+		kinds = append(kinds, nodeKinds(c)...)
+	}
+	return kinds
+}
+
+func TestCompileInMemory(t *testing.T) {
+	p := testProfile(t)
+	sources := []Source{
+		{Filename: "a.atomic", Data: []byte("package: a\ntype: o { r int }\nfunction: f {\n    > o\n    + o { r <- 1 }\n}\n")},
+		{Filename: "b.atomic", Data: []byte("package: b\ntype: q { s long }\nfunction: g {\n    > q\n}\n")},
+	}
+	// the profile is shared by compilations, and by the functions compiled concurrently within them
+	for i := 0; i < 2; i++ {
+		r := Compile(sources, Options{Profile: p, Concurrency: 2})
+		if r.HasErrors() || len(r.Diagnostics) > 0 {
+			t.Fatalf("unexpected diagnostics: %v", r.Diagnostics)
+		}
+		if len(r.Files) != 2 || r.Files[0].Filename != "a.atomic" || r.Files[1].Filename != "b.atomic" {
+			t.Fatalf("got files %v", r.Files)
+		}
+		a := r.Files[0]
+		if !bytes.HasPrefix(a.Object, []byte("\x7fELF")) {
+			t.Errorf("object is not an elf object: %q", a.Object)
+		}
+		if want := []string{"f:", "movz d=9 h=0 i=1", "str.w i=0 n=0 t=9", "exit_f:", "ret n=30", "padding"}; !reflect.DeepEqual(functionInstructions(a.Listing, "f"), want) {
+			t.Errorf("got listing\n%s", a.Listing)
+		}
+		if !strings.Contains(a.Header, "struct o {\n    int32_t r;\n};\n") {
+			t.Errorf("got header\n%s", a.Header)
+		}
+		want := []string{"unit :0", "package :1:1", "struct :2:1", "field :2:11", "function :3:1", "input :4:5",
+			"populate :5:5", "mapping :5:11", "expr :5:16"}
+		if got := nodeKinds(a.AST); !reflect.DeepEqual(got, want) {
+			t.Errorf("got ast %q, want %q", got, want)
+		}
+		if a.AST.Detail != "a.atomic" {
+			t.Errorf("got unit %s", a.AST.Detail)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	r := Compile([]Source{{Filename: "a.atomic", Data: []byte("package: a\ntype: o { r nothing }\n")}}, Options{Profile: testProfile(t)})
+	if !r.HasErrors() || r.Files[0].Object != nil || r.Files[0].Header != "" {
+		t.Errorf("got object %q and header %q with diagnostics %v", r.Files[0].Object, r.Files[0].Header, r.Diagnostics)
+	}
+	want := []Diagnostic{{Severity: "error", Code: codeUnknownType, Filename: "a.atomic", Line: 2, Column: 11, EndLine: 2,
+		EndColumn: 20, Message: "Unknown type nothing"}}
+	if !reflect.DeepEqual(r.Diagnostics, want) {
+		t.Errorf("got %+v, want %+v", r.Diagnostics, want)
+	}
+
+	r = Compile(nil, Options{})
+	if len(r.Diagnostics) != 1 || r.Diagnostics[0].Code != codeProfile || r.Diagnostics[0].Message != "No profile provided" {
+		t.Errorf("got %+v", r.Diagnostics)
+	}
+}
+
+func TestLoadProfileErrors(t *testing.T) {
+	p, diags := LoadProfile(strings.NewReader("1101 0010 1hhi\nbogus\n"), "bad.profile", "linux")
+	var got []string
+	for _, d := range diags {
+		got = append(got, position{filename: d.Filename, line: d.Line}.String()+" "+d.Code+" "+d.Message)
+	}
+	want := []string{
+		"bad.profile:1 A400 Instruction template requires a name",
+		"bad.profile:2 A400 Instruction template requires a name",
+	}
+	if p == nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// instructions missing from the profile are reported at the statements emitting them
+func TestMissingInstruction(t *testing.T) {
+	data, err := os.ReadFile("../../../profile/arm64.profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Replace(string(data), "\n1101 0010 1hhi", "\n#101 0010 1hhi", 1) // movz
+	p, diags := LoadProfile(strings.NewReader(text), "arm64.profile", "linux")
+	if len(diags) > 0 {
+		t.Fatalf("loading profile: %v", diags)
+	}
+	source := `package: t
+type: o { r int s int }
+function: f {
+    > o
+    + o { r <- 1 s <- 2 }
+    loop: 3 {
+        + o { s <- 2 r <- 1 }
+    }
+}
+`
+	var got []string
+	for _, d := range Compile([]Source{{Filename: "test.atomic", Data: []byte(source)}}, Options{Profile: p}).Diagnostics {
+		if d.Severity == severityError.String() {
+			got = append(got, position{line: d.Line, col: d.Column}.String()+" "+d.Code+" "+d.Message)
+		}
+	}
+	want := []string{
+		":5:5 A301 Couldn't find instruction movz with dhi",
+		":5:5 A301 Couldn't find instruction movz with dhi",
+		":6:5 A301 Couldn't find instruction movz with dhi", // the counter of the loop
+		":7:9 A301 Couldn't find instruction movz with dhi",
+		":7:9 A301 Couldn't find instruction movz with dhi",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
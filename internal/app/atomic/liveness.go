@@ -0,0 +1,103 @@
+package atomic
+
+import "sort"
+
+// live ranges of the inputs of a function, computed over its AST before it is emitted
+type liveness struct {
+	inputs   []string        // in declaration order, which decides their parameter registers
+	exits    []string        // values holding the return addresses of exits, passed after the inputs
+	lastUse  map[string]*ast // the node after which an input is no longer used
+	order    map[*ast]int    // the order in which nodes complete
+	releases map[*ast][]string
+	bounds   string // the exit taken by accesses out of bounds, used by every node following its naming
+}
+
+func computeLiveness(r *reference, fa *ast) *liveness {
+	l := &liveness{
+		lastUse:  map[string]*ast{},
+		order:    map[*ast]int{},
+		releases: map[*ast][]string{},
+	}
+	l.walk(r, fa, nil)
+	for name, a := range l.lastUse {
+		l.releases[a] = append(l.releases[a], name)
+	}
+	for a := range l.releases {
+		sort.Strings(l.releases[a])
+	}
+	return l
+}
+
+// records uses against the node itself, or the outermost loop containing it as the loop body repeats
+func (l *liveness) walk(r *reference, a *ast, loop *ast) {
+	for i := range a.sub {
+		s := &a.sub[i]
+		owner := s
+		if loop != nil {
+			owner = loop
+		}
+		switch n := s.node.(type) {
+		case *inputNode:
+			if !contains(l.inputs, n.name) {
+				l.inputs = append(l.inputs, n.name)
+			}
+			l.lastUse[n.name] = owner // unused inputs are released once declared
+		case *populateNode:
+			for _, name := range n.uses(r, s, l.inputs) {
+				l.lastUse[name] = owner
+			}
+		case *exitNode:
+			if !contains(l.exits, exitValue(n.name)) {
+				l.exits = append(l.exits, exitValue(n.name))
+			}
+			l.lastUse[exitValue(n.name)] = owner
+		case *slipNode:
+			l.lastUse[exitValue(n.exit)] = owner
+		case *boundsNode:
+			l.bounds = exitValue(n.exit)
+		case *whenNode:
+			for _, name := range n.uses() {
+				l.lastUse[name] = owner
+			}
+		case *caseNode:
+			for _, name := range append([]string{n.input}, indexInputs(n.path)...) {
+				l.lastUse[name] = owner
+			}
+		case *switchNode:
+			for _, name := range append([]string{n.input}, indexInputs(n.path)...) {
+				l.lastUse[name] = owner
+			}
+		case *callNode:
+			for _, name := range n.uses() {
+				l.lastUse[name] = owner
+			}
+		case *streamNode:
+			for _, name := range n.uses() {
+				l.lastUse[name] = owner
+			}
+		case *loopNode:
+			l.walk(r, s, owner)
+			l.order[s] = len(l.order)
+			continue
+		}
+		if l.bounds != "" {
+			l.lastUse[l.bounds] = owner
+		}
+		l.walk(r, s, loop)
+		l.order[s] = len(l.order)
+	}
+}
+
+// the values passed to the function in parameter registers or on the stack, in order
+func (l *liveness) parameters() []string {
+	return append(append([]string{}, l.inputs...), l.exits...)
+}
+
+// returns true if the input a is used after the input b
+func (l *liveness) after(a string, b string) bool {
+	oa, ob := l.order[l.lastUse[a]], l.order[l.lastUse[b]]
+	if oa != ob {
+		return oa > ob
+	}
+	return a < b
+}
@@ -0,0 +1,74 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// small loops are unrolled, others count down a counter reserved before their bodies, and nested counts fold
+func TestLoops(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: o { r int s int }
+type: src { i int }
+function: f {
+    > o
+    loop: 3 { + o { r <- 1 s <- 0 } }
+}
+function: g {
+    > o
+    loop: 100 { + o { r <- 1 s <- 0 } }
+}
+function: h {
+    > src
+    > o
+    loop: 6 { + o { r <- src.i + 1 s <- src.i * 3 } }
+}
+function: k {
+    > o
+    loop: 10 { loop: 20 { + o { r <- 1 s <- 0 } } }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		// no counter is held, so the body has the first free register
+		{"f", []string{
+			"f:",
+			"movz d=9 h=0 i=1", "str.w i=0 n=0 t=9", "movz d=9 h=0 i=0", "str.w i=1 n=0 t=9",
+			"movz d=9 h=0 i=1", "str.w i=0 n=0 t=9", "movz d=9 h=0 i=0", "str.w i=1 n=0 t=9",
+			"movz d=9 h=0 i=1", "str.w i=0 n=0 t=9", "movz d=9 h=0 i=0", "str.w i=1 n=0 t=9",
+			"exit_f:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"movz d=8 h=0 i=100",
+			"movz d=10 h=0 i=1", "str.w i=0 n=0 t=10", "movz d=10 h=0 i=0", "str.w i=1 n=0 t=10",
+			"subs d=8 i=1 n=8", "b.c c=1 i=524283", // back 5 instructions to the body while x8 isn't zero
+			"exit_g:", "ret n=30",
+		}},
+		// a low count whose body is too large to unroll is emitted again holding a counter
+		{"h", []string{
+			"h:",
+			"movz d=8 h=0 i=6",
+			"ldrsw i=0 n=0 t=10", "add d=10 i=1 n=10", "str.w i=0 n=1 t=10",
+			"ldrsw i=0 n=0 t=10", "movz d=11 h=0 i=3", "madd a=31 d=10 m=11 n=10", "str.w i=1 n=1 t=10",
+			"subs d=8 i=1 n=8", "b.c c=1 i=524280",
+			"exit_h:", "ret n=30", "padding",
+		}},
+		{"k", []string{
+			"k:",
+			"movz d=8 h=0 i=200",
+			"movz d=10 h=0 i=1", "str.w i=0 n=0 t=10", "movz d=10 h=0 i=0", "str.w i=1 n=0 t=10",
+			"subs d=8 i=1 n=8", "b.c c=1 i=524283",
+			"exit_k:", "ret n=30",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
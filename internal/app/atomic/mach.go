@@ -4,8 +4,6 @@ import (
 	"bufio"
 	"encoding/binary"
 	"io"
-	"log"
-	"os"
 )
 
 // mach-o 64 structures for mac os darwin
@@ -113,14 +111,8 @@ var exportSymbolTypesMach = map[bool]uint8{
 	true:  0xf,
 }
 
-func writeObjectFileMach(filename string, asms []asm) {
-	file, err := os.Create(filename)
-	defer file.Close()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	buffer := bufio.NewWriter(file)
+func writeObjectMach(w io.Writer, asms []asm) {
+	buffer := bufio.NewWriter(w)
 
 	// align assembler and calculate combined lengths
 	asmSize := 0
@@ -8,31 +8,41 @@ type ast struct {
 	sub     []ast
 	node    node
 	emitter func(f *frame, p *profile, a *asm) func()
+	span    span // source location of the node
 }
 
 type node interface {
-	resolve(a *ast) func(f *frame, p *profile, a *asm) func() // called on the final ascent of the ast, allowing nodes to collect data, optimise etc
+	resolve(a *ast, d *diagnostics) func(f *frame, p *profile, a *asm) func() // called on the final ascent of the ast, allowing nodes to collect data, optimise etc
 }
 
 type primative struct {
 	name    string
 	size    int
+	align   int
 	integer bool
 	boolean bool
 	signed  bool
 	float   bool
+	bits    int // the width of a bit field, whose size is that of the word it's accessed through
 }
 
 type reference struct {
-	structs   map[string]*structNode
-	functions map[string]*functionNode
+	structs      map[string]*structNode
+	enums        map[string]*enumNode
+	functions    map[string]*functionNode
+	declarations map[string]*ast // struct and enum declarations, providing fields, members and their source spans
+	unchecked    bool            // accesses which would take the bounds exit aren't checked
 }
 
-func (a *ast) resolve() {
+func (a *ast) resolve(d *diagnostics) {
 	compact := false
 	for i, _ := range a.sub {
 		s := &a.sub[i]
-		s.emitter = s.node.resolve(s)
+		n := s.node
+		emitter := n.resolve(s, d)
+		if s.node == n { // a node replaced during resolve keeps the replacement's emitter
+			s.emitter = emitter
+		}
 		if s.node == nil {
 			compact = true
 		}
@@ -42,9 +52,7 @@ func (a *ast) resolve() {
 		for i, _ := range a.sub {
 			s := &a.sub[i]
 			if s.node != nil {
-				na := &a.sub[n]
-				na.sub = s.sub
-				na.node = s.node
+				a.sub[n] = *s
 				n++
 			}
 		}
@@ -55,6 +63,8 @@ func (a *ast) resolve() {
 func (a *ast) emit(f *frame, p *profile, as *asm) func() {
 	var closure func()
 	if a.emitter != nil {
+		f.span = a.span
+		f.node = a
 		closure = a.emitter(f, p, as)
 	}
 
@@ -72,13 +82,19 @@ func (a *ast) emit(f *frame, p *profile, as *asm) func() {
 
 	if closure != nil {
 		if len(a.sub) > 0 {
-			// if node has sub nodes run the closure now, post sub nodes
+			// if node has sub nodes run the closure now, post sub nodes, reporting at this node
+			f.span = a.span
 			closure()
 		} else {
 			// otherwise return closure to the caller, deferred to the end of this node's peers
-			return closure
+			f.emitted(a)
+			return func() {
+				f.span = a.span
+				closure()
+			}
 		}
 	}
+	f.emitted(a)
 	return nil
 }
 
@@ -93,12 +109,14 @@ func (a *ast) collapseIfSingleSubElement() {
 		s := &a.sub[0]
 		a.sub = s.sub
 		a.node = s.node
+		a.emitter = s.emitter
 	}
 }
 
-func (a *ast) append(n node) *ast {
+func (a *ast) append(n node, s span) *ast {
 	as := ast{
 		node: n,
+		span: s,
 	}
 	a.sub = append(a.sub, as)
 	return &a.sub[len(a.sub)-1]
@@ -109,59 +127,77 @@ func (p *primative) String() string {
 }
 
 var primatives = map[string]primative{
-	"[]": {
-		name: "array",
-		size: 4,
-	},
 	"string": {
-		name: "string",
-		size: 8, // assuming 64 bit architecture
+		name:  "string",
+		size:  8, // assuming 64 bit architecture
+		align: 8,
 	},
 	"bool": {
 		name:    "bool",
 		size:    1,
+		align:   1,
 		boolean: true,
 	},
 	"byte": {
 		name:    "byte",
 		size:    1,
+		align:   1,
 		integer: true,
 	},
 	"short": {
 		name:    "short",
 		size:    2,
+		align:   2,
 		integer: true,
+		signed:  true,
 	},
 	"int": {
 		name:    "int",
 		size:    4,
+		align:   4,
 		integer: true,
+		signed:  true,
 	},
 	"long": {
 		name:    "long",
 		size:    8,
+		align:   8,
 		integer: true,
+		signed:  true,
 	},
 	"double": {
 		name:  "double",
 		size:  8,
+		align: 8,
 		float: true,
 	},
 }
 
-func (r reference) populate(a *ast) {
-	for _, n := range a.sub {
+func (r reference) populate(a *ast, d *diagnostics) {
+	for i, _ := range a.sub {
+		n := &a.sub[i]
 		switch n.node.(type) {
 		case *structNode:
 			s := n.node.(*structNode)
-			if _, dupe := r.structs[s.name]; dupe {
-				shenanigans("Duplicate struct definition: %s", s.name)
+			if _, dupe := r.declarations[s.name]; dupe {
+				d.errorf(codeDuplicate, n.span, "Duplicate struct definition: %s", s.name)
+				continue
 			}
 			r.structs[s.name] = s
+			r.declarations[s.name] = n
+		case *enumNode:
+			e := n.node.(*enumNode)
+			if _, dupe := r.declarations[e.name]; dupe {
+				d.errorf(codeDuplicate, n.span, "Duplicate enum definition: %s", e.name)
+				continue
+			}
+			r.enums[e.name] = e
+			r.declarations[e.name] = n
 		case *functionNode:
 			f := n.node.(*functionNode)
-			if _, dupe := r.structs[f.name]; dupe {
-				shenanigans("Duplicate function definition: %s", f.name)
+			if _, dupe := r.functions[f.name]; dupe {
+				d.errorf(codeDuplicate, n.span, "Duplicate function definition: %s", f.name)
+				continue
 			}
 			r.functions[f.name] = f
 		}
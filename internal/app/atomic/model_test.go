@@ -0,0 +1,33 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// nodes replaced as the ast is resolved keep the emitters of the nodes replacing them
+func TestResolvedEmitters(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"loop of one collapsed into its populate", "loop: 1 { + o { r <- 1 } }", []string{
+			"f:", "movz d=9 h=0 i=1", "str.w i=0 n=0 t=9", "exit_f:", "ret n=30", "padding",
+		}},
+		{"populate moved down over a deleted loop", "loop: 0 { + o { r <- 1 } }\n    + o { s <- 2 }", []string{
+			"f:", "movz d=9 h=0 i=2", "str.w i=1 n=0 t=9", "exit_f:", "ret n=30", "padding",
+		}},
+		{"scope of one collapsed into its populate", "{ + o { s <- 3 } }", []string{
+			"f:", "movz d=9 h=0 i=3", "str.w i=1 n=0 t=9", "exit_f:", "ret n=30", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing := compileListing(t, "package: t\ntype: o { r int s int }\nfunction: f {\n    > o\n    "+tt.body+"\n}\n")
+			if got := functionInstructions(listing, "f"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,83 +4,125 @@ type packageNode struct {
 	name string
 }
 
-func (n *packageNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+func (n *packageNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return nil
+}
+
+// a named literal eg. const: maxSeats 400, substituted for its name by the parser where it's used later in the file
+type constNode struct {
+	name  string
+	value string
+}
+
+func (n *constNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
 	return nil
 }
 
 type structNode struct {
-	name   string
-	fields []field
-	size   int
+	name      string
+	packed    bool // fields are not aligned, as with the C packed attribute
+	align     int  // declared minimum alignment, as with the C aligned attribute
+	variant   bool // holds one of its member structs after a tag naming which, see variant.go
+	fields    []field
+	size      int
+	alignment int
 }
 
 type field struct {
 	name string
 
-	prim   primative
-	offset int
-}
-
-func (n *structNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
-	off := 0
-	for _, s := range a.sub {
-		switch s.node.(type) {
-		case *fieldNode:
-			fn := s.node.(*fieldNode)
-			p, ok := primatives[fn.typ]
-			if !ok {
-				shenanigans("Unknown type " + fn.typ)
-			}
-			f := field{
-				name:   fn.name,
-				prim:   p,
-				offset: off,
-			}
-			n.fields = append(n.fields, f)
-			off += p.size
-		}
-	}
+	prim     primative
+	offset   int
+	typ      string // name of the struct type for struct and pointer fields, or the function of a function pointer
+	enum     string // name of the enum for enum fields, which are of its primative
+	pointer  bool
+	length   int    // elements of a fixed length array, whose size is the size of an element times its length
+	stream   bool   // a stream of elements of the type, whose size is that of its descriptor or fixed buffer
+	capacity int    // elements of a fixed buffer stream, or 0 for a descriptor
+	bound    string // the integer field counting the elements a buffer points to
+	bit      int    // the offset of a bit field within the word at its offset
+	order    string // the byte order of an integer field, or its elements, be or le if declared
+	size     int
+}
+
+// fields are laid out by reference.layout once the structs of all units are known
+func (n *structNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
 	return nil
 }
 
 type fieldNode struct {
-	name string
-	typ  string
+	name    string
+	typ     string
+	pointer bool
+	length  int    // elements of a fixed length array eg. seats [32]seat, or of a fixed buffer stream, or 0
+	stream  bool   // a stream of elements eg. legs stream leg, or codes stream [16]byte
+	bound   string // the field counting the elements of a buffer eg. legs buffer [legCount]leg
+	bits    int    // the width of a bit field eg. flags bits:3, whose type is bits or sbits when signed
+	order   string // the byte order of an integer field eg. code be int, be or le, or the native order if empty
 }
 
-func (n *fieldNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+func (n *fieldNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
 	return nil
 }
 
 type functionNode struct {
-	name string
+	name   string
+	inputs []string // in declaration order, as callers pass them
+	exits  []string // alternate exits, whose return addresses callers pass after the inputs
 }
 
-func (n *functionNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+func (n *functionNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	n.inputs = n.inputs[:0]
+	n.exits = n.exits[:0]
+	collectDeclarations(a, n)
 	return func(f *frame, p *profile, as *asm) func() {
 		as.addSymbol(n.name, true)
+		start := len(as.instructions)
 
 		return func() {
 			as.addSymbol("exit_"+n.name, false)
+			f.emitEpilogue(p, as)
 			as.emit(p.findReg("ret", p.findLinkRegister().index))
+			f.emitSlipTail(p, as, n.name)
+			f.emitPrologue(p, as, start)
+		}
+	}
+}
+
+// collects the inputs and exits declared within a function
+func collectDeclarations(a *ast, n *functionNode) {
+	for i := range a.sub {
+		switch d := a.sub[i].node.(type) {
+		case *inputNode:
+			if !contains(n.inputs, d.name) {
+				n.inputs = append(n.inputs, d.name)
+			}
+		case *exitNode:
+			if !contains(n.exits, d.name) {
+				n.exits = append(n.exits, d.name)
+			}
 		}
+		collectDeclarations(&a.sub[i], n)
 	}
 }
 
 type scopeNode struct {
 }
 
-func (n *scopeNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+func (n *scopeNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
 	a.deleteIfNoSubElements()
 	a.collapseIfSingleSubElement()
 	return nil
 }
 
+// instructions an unrolled loop may take beyond the size of the counted loop
+const unrollAllowance = 16
+
 type loopNode struct {
 	count int
 }
 
-func (n *loopNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+func (n *loopNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
 	// if single sub node is a loop, collapse loop and combine counts
 	if len(a.sub) == 1 {
 		s := &a.sub[0]
@@ -99,60 +141,80 @@ func (n *loopNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
 	if n.count == 1 {
 		scope := &scopeNode{}
 		a.node = scope
-		scope.resolve(a)
+		scope.resolve(a, d)
 	}
-	return nil
-}
-
-type populateNode struct {
-	name string
-}
-
-func (n *populateNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+	if a.node != n {
+		return nil
+	}
+	streams := heldStreams(a)
 	return func(f *frame, p *profile, as *asm) func() {
-		targetStruct, ok := f.ref.structs[n.name]
-		if !ok {
-			shenanigans("Unable to resolve struct %s", n.name)
+		// a loop which may unroll is emitted without a counter. if its body is then too large to unroll the
+		// function is emitted again with the counter reserved before the body, so the body can't use its register
+		name := "loop " + f.span.start.String()
+		counting := !n.unrolls(4, 1) || contains(f.stack.counted, name)
+		var counter register
+		if counting {
+			counter, _ = f.registerForValue(p, name)
+			if _, ok := f.valueRegister(name); !ok {
+				return nil // the failed allocation was reported
+			}
 		}
+		held := f.holdStreams(p, as, streams, n.count)
+		start := len(as.instructions)
 
-		targetRegister, ok := f.registerForValue(p, n.name)
-		if !ok {
-			shenanigans("Unable to resolve %s", n.name)
-		}
-		tmp, _ := f.registerForValue(p, "tmp")
-
-		// this method currently makes a lot of terrible assumptions but its ok for a demo
-		for _, field := range targetStruct.fields {
-			for _, sourceStruct := range f.ref.structs {
-				if n.name != sourceStruct.name {
-					for _, sourceField := range sourceStruct.fields {
-						if sourceField.name == field.name {
-							sourceRegister, ok := f.registerForValue(p, sourceStruct.name)
-							if ok {
-								as.emit(p.find("ldr", "int").set("int", sourceField.offset/8, sourceRegister.index, tmp.index))
-								as.emit(p.find("str", "int").set("int", field.offset/8, targetRegister.index, tmp.index))
-							}
-						}
-					}
+		return func() {
+			defer f.releaseValue(name)
+			defer f.releaseStreams(p, as, held)
+			body := len(as.instructions) - start
+			if body == 0 {
+				return
+			}
+			init := moveImmediate(p, counter, uint64(n.count))
+			if !counting && n.unrolls(len(init), body) {
+				// the body is position independent, its branches are relative and within the body
+				for i := 1; i < n.count; i++ {
+					f.stack.copied(start, body, len(as.instructions))
+					as.instructions = append(as.instructions, as.instructions[start:start+body]...)
 				}
+				return
 			}
+			if !counting {
+				f.stack.counted = append(f.stack.counted, name)
+				return
+			}
+			as.insert(start, init...)
+			f.stack.moved(start, len(init))
+			top := start + len(init)
+			as.emit(p.find("subs", "dni").set("dni", counter.index, counter.index, 1))
+			as.emit(p.find("b.c", "ci").set("ci", condNE, as.branchOffset(top)))
 		}
-		f.releaseValue("tmp")
-		return nil
 	}
 }
 
+// returns true if unrolling the body takes no more than the allowance beyond the counted loop, whose counter
+// is loaded by init instructions. counts which don't unroll a body of one instruction loaded by the longest
+// init never unroll
+func (n *loopNode) unrolls(init int, body int) bool {
+	counted := init + body + 2
+	return n.count <= counted+unrollAllowance && body*n.count <= counted+unrollAllowance
+}
+
 type inputNode struct {
 	name string
 }
 
-func (n *inputNode) resolve(a *ast) func(f *frame, p *profile, as *asm) func() {
+func (n *inputNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
 	return func(f *frame, p *profile, as *asm) func() {
-		f.pushParameter(p, n.name)
-		// move reg to self as non breaky way to see it doing something
-		//as.emit(p.find("mov", "dn").set("dn", r.index, r.index))
-		return func() {
-			f.releaseValue(n.name)
+		if _, ok := f.ref.structs[n.name]; !ok {
+			f.errorf(codeUnresolved, "Unable to resolve struct %s", n.name)
+			return nil
 		}
+		if contains(f.declaredInputs(), n.name) {
+			f.errorf(codeDuplicate, "Input %s is already declared", n.name)
+			return nil
+		}
+		// the input's register or stack argument was planned from its live range, it is released after its last use
+		f.declareInput(n.name)
+		return nil
 	}
 }
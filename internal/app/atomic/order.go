@@ -0,0 +1,25 @@
+package atomic
+
+// the byte order of the processors of the profiles, fields declared in the other order are reversed as they're
+// loaded and stored
+const nativeOrder = "le"
+
+// reverses the bytes of the low 2, 4 or 8 bytes of a register
+var reverseInstructions = map[int]string{
+	2: "rev16",
+	4: "rev32",
+	8: "rev",
+}
+
+// returns true if a field is declared in the other byte order to the processor, with bytes to reverse
+func (fp fieldPath) swapped() bool {
+	return fp.order != "" && fp.order != nativeOrder && fp.prim.size > 1
+}
+
+// reverses the bytes of a field loaded as it is into the native order, then extends its sign
+func (f *frame) emitOrdered(p *profile, as *asm, pr primative, rt register) {
+	as.emit(p.find(reverseInstructions[pr.size], "dn").set("dn", rt.index, rt.index))
+	if pr.signed && pr.size < 8 {
+		as.emit(p.find("sbfm", "dnrs").set("dnrs", rt.index, rt.index, 0, pr.size*8-1))
+	}
+}
@@ -0,0 +1,83 @@
+package atomic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fields in the other byte order to the processor are reversed as they're loaded and stored, unless both are
+func TestByteOrder(t *testing.T) {
+	source := `package: t
+type: wire { length be short tag le int seq be long codes [2]be int b be byte }
+type: host { length short tag int seq long code int b byte }
+type: net { length be short tag be int seq be long }
+function: f {
+    > wire
+    > host
+    + host { length <- wire.length tag <- wire.tag seq <- wire.seq code <- wire.codes[1] b <- wire.b }
+}
+function: g {
+    > host
+    > wire
+    > net
+    + net { length <- wire.length tag <- wire.tag seq <- host.seq }
+}
+`
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrh i=0 n=0 t=8", "rev16 d=8 n=8", "sbfm d=8 n=8 r=0 s=15", "strh i=0 n=1 t=8", // reversed, then extended
+			"ldrsw i=1 n=0 t=8", "str.w i=1 n=1 t=8", // already little endian
+			"ldr i=1 n=0 t=8", "rev d=8 n=8", "str i=1 n=1 t=8",
+			"ldr.w i=5 n=0 t=8", "rev32 d=8 n=8", "sbfm d=8 n=8 r=0 s=31", "str.w i=4 n=1 t=8",
+			"ldrb i=24 n=0 t=8", "strb i=20 n=1 t=8", // a byte has no order
+			"exit_f:", "ret n=30",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsh i=0 n=1 t=8", "strh i=0 n=2 t=8", // big endian to big endian
+			"ldrsw i=1 n=1 t=8", "rev32 d=9 n=8", "str.w i=1 n=2 t=9",
+			"ldr i=1 n=0 t=8", "rev d=9 n=8", "str i=1 n=2 t=9",
+			"exit_g:", "ret n=30", "padding", "padding", "padding",
+		}},
+	}
+	listing := compileListing(t, source)
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// headers note the byte order of the fields declaring one
+func TestByteOrderHeader(t *testing.T) {
+	r := compileSource(t, "package: t\ntype: s { length be short tag le int codes [2]be int n int }\nfunction: f {\n    > s\n}\n")
+	want := "struct s {\n    int16_t length; // big endian\n    int32_t tag; // little endian\n" +
+		"    int32_t codes[2]; // big endian\n    int32_t n;\n};\n"
+	if header := r.Files[0].Header; !strings.Contains(header, want) {
+		t.Errorf("got header\n%s", header)
+	}
+}
+
+func TestByteOrderErrors(t *testing.T) {
+	source := `package: t
+type: inner { a int }
+type: bad { d be double i be inner o be bool c [2]be double s stream be int }
+`
+	want := []string{
+		"A204 3:13 Byte order can only be declared for integer fields and arrays of them, not d",
+		"A204 3:25 Byte order can only be declared for integer fields and arrays of them, not i",
+		"A204 3:36 Byte order can only be declared for integer fields and arrays of them, not o",
+		"A204 3:46 Byte order can only be declared for integer fields and arrays of them, not c",
+		"A204 3:61 Byte order can only be declared for integer fields and arrays of them, not s",
+	}
+	if got := compileDiagnostics(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,121 +1,805 @@
 package atomic
 
-import "C"
 import (
-	"bufio"
 	"crypto/sha256"
 	"fmt"
 	"io"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
 type parser struct {
-	reader   *bufio.Reader
+	lexer    *lexer
+	token    token // the current token, comments are skipped
 	filename string
 	ast      ast
-	baseNode node
-	lineNum  int
-	verbose  bool
+	diags    *diagnostics
+	consts   map[string]string // literal values of the constants declared so far
+}
+
+type source struct {
+	filename string
+	data     []byte
 }
 
 type unit struct {
 	filename string
 	ast      ast
+	asms     []asm  // compiled functions ordered by name
+	object   []byte // linkable object for the target os
+	header   []byte // C declarations of the unit's types
 }
 
-// minimal viable recursive parser - please don't take it very seriously
+// raised by syntaxError to unwind to the enclosing statement, which resynchronises and carries on
+type bailout struct{}
+
+// recursive descent parser over the lexer's tokens, line layout is not significant
 func (p *parser) parseSource(a *ast) {
+	p.next()
+	for p.token.kind != tokenEOF {
+		p.statement(true, func() {
+			t := p.next()
+			switch {
+			case t.is(tokenKeyword, "package:"):
+				name := p.expectIdent("package name")
+				a.append(&packageNode{
+					name: name.text,
+				}, t.span.to(name.span))
+			case t.is(tokenKeyword, "type:"):
+				name := p.expectIdent("type name")
+				sn := &structNode{
+					name: name.text,
+				}
+				p.parseStructAttributes(sn)
+				as := a.append(sn, t.span)
+				end := p.parseStruct(as)
+				as.span = t.span.to(end)
+			case t.is(tokenKeyword, "variant:"):
+				name := p.expectIdent("variant name")
+				as := a.append(&structNode{
+					name:    name.text,
+					variant: true,
+				}, t.span)
+				end := p.parseMembers(as)
+				as.span = t.span.to(end)
+			case t.is(tokenKeyword, "enum:"):
+				name := p.expectIdent("enum name")
+				typ := p.expectIdent("enum type")
+				as := a.append(&enumNode{
+					name: name.text,
+					typ:  typ.text,
+				}, t.span)
+				end := p.parseEnum(as)
+				as.span = t.span.to(end)
+			case t.is(tokenKeyword, "const:"):
+				name := p.expectIdent("constant name")
+				value := p.parseFolded()
+				literal := value.node.(*exprNode).literal
+				if _, dupe := p.consts[name.text]; dupe {
+					p.diags.errorf(codeDuplicate, name.span, "Duplicate constant definition: %s", name.text)
+				} else if literal == "" {
+					p.diags.errorf(codeType, value.span, "Constant %s is not a literal or constant expression", name.text)
+				} else {
+					p.consts[name.text] = literal
+				}
+				a.append(&constNode{
+					name:  name.text,
+					value: literal,
+				}, t.span.to(value.span))
+			case t.is(tokenKeyword, "function:"):
+				name := p.expectIdent("function name")
+				as := a.append(&functionNode{
+					name: name.text,
+				}, t.span)
+				end := p.parseBlock(as)
+				as.span = t.span.to(end)
+			default:
+				p.syntaxError(t.span, "Unknown base token: %s", t.text)
+			}
+		})
+	}
+	a.resolve(p.diags)
+}
+
+// parses optional layout attributes following a struct name eg. type: header packed align 8 { ... }
+func (p *parser) parseStructAttributes(sn *structNode) {
+	for p.token.kind == tokenIdent {
+		t := p.next()
+		switch t.text {
+		case "packed":
+			sn.packed = true
+		case "align":
+			n := p.expect(tokenNumber, "")
+			align, err := parseInteger(n.text)
+			if err != nil || align <= 0 || align&(align-1) != 0 {
+				p.diags.errorf(codeSyntax, n.span, "Alignment must be a power of two: %s", n.text)
+				continue
+			}
+			sn.align = int(align)
+		default:
+			p.syntaxError(t.span, "Unknown type attribute: %s", t.text)
+		}
+	}
+}
+
+// parses the fields of a struct between braces, returning the span of the closing brace
+func (p *parser) parseStruct(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			name := p.next()
+			if name.kind != tokenIdent {
+				p.syntaxError(name.span, "Field name must start with a letter: %s", name.text)
+			}
+			stream := false
+			if p.token.is(tokenIdent, "stream") {
+				p.next()
+				stream = true
+			}
+			bound := ""
+			if p.token.is(tokenIdent, "buffer") {
+				// a pointer to elements counted by another field eg. legs buffer [legCount]leg
+				p.next()
+				p.expect(tokenPunct, "[")
+				bound = p.expectIdent("length field").text
+				p.expect(tokenPunct, "]")
+			}
+			length := 0
+			if bound == "" && p.token.is(tokenPunct, "[") {
+				// a fixed length array eg. seats [32]seat, whose length may be a constant expression
+				p.next()
+				value := p.parseFolded()
+				n, err := parseInteger(value.node.(*exprNode).literal)
+				if err != nil || n < 1 {
+					p.syntaxError(value.span, "Length of array %s is not a positive integer constant", name.text)
+					n = 0
+				}
+				length = int(n)
+				p.expect(tokenPunct, "]")
+			}
+			pointer := false
+			if p.token.is(tokenPunct, "*") {
+				p.next()
+				pointer = true
+			}
+			order := ""
+			if p.token.is(tokenIdent, "be") || p.token.is(tokenIdent, "le") {
+				// the byte order of an integer eg. code be int, for wire formats
+				order = p.next().text
+			}
+			if p.token.is(tokenKeyword, "bits:") || p.token.is(tokenKeyword, "sbits:") {
+				// a bit field eg. flags bits:3, or sbits:3 which is signed
+				typ, width, end := p.parseBits()
+				a.append(&fieldNode{
+					name:    name.text,
+					typ:     typ,
+					pointer: pointer,
+					length:  length,
+					stream:  stream,
+					bound:   bound,
+					bits:    width,
+					order:   order,
+				}, name.span.to(end))
+				return
+			}
+			typ := p.expectIdent("field type")
+			a.append(&fieldNode{
+				name:    name.text,
+				typ:     typ.text,
+				pointer: pointer,
+				length:  length,
+				stream:  stream,
+				bound:   bound,
+				order:   order,
+			}, name.span.to(typ.span))
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses the type of a bit field eg. bits:3, returning the type, its width and the span of the width
+func (p *parser) parseBits() (string, int, span) {
+	t := p.next()
+	n := p.expect(tokenNumber, "")
+	width, err := parseInteger(n.text)
+	if err != nil || width < 1 || width > 64 {
+		p.diags.errorf(codeSyntax, n.span, "Width of a bit field must be 1 to 64 bits: %s", n.text)
+		width = 1
+	}
+	return strings.TrimSuffix(t.text, ":"), int(width), n.span
+}
+
+// parses function statements between braces, returning the span of the closing brace
+func (p *parser) parseBlock(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			t := p.token
+			switch {
+			case t.is(tokenPunct, "{"):
+				as := a.append(&scopeNode{}, t.span)
+				end := p.parseBlock(as)
+				as.span = t.span.to(end)
+			case t.is(tokenPunct, ">"):
+				p.next()
+				name := p.expectIdent("input name")
+				a.append(&inputNode{
+					name: name.text,
+				}, t.span.to(name.span))
+			case t.is(tokenPunct, "+"):
+				p.next()
+				// an input, or the member of a variant within one eg. + booking.pay.card
+				name := p.parsePath("struct name")
+				split := strings.SplitN(name.text, ".", 2)
+				n := &populateNode{
+					name: split[0],
+				}
+				if len(split) > 1 {
+					n.path = split[1]
+				}
+				as := a.append(n, t.span.to(name.span))
+				if p.token.is(tokenPunct, "{") {
+					end := p.parseMappings(as)
+					as.span = t.span.to(end)
+				}
+			case t.is(tokenKeyword, "call:"):
+				p.next()
+				fn := p.parsePath("function pointer")
+				split := strings.SplitN(fn.text, ".", 2)
+				if len(split) < 2 {
+					p.syntaxError(fn.span, "Expected input.field but found %s", fn.text)
+				}
+				n := &callNode{
+					input: split[0],
+					path:  split[1],
+				}
+				end := p.parseArguments(n)
+				as := a.append(n, t.span.to(end))
+				if p.token.is(tokenPunct, "{") {
+					end = p.parseHandlers(as)
+					as.span = t.span.to(end)
+				}
+			case t.is(tokenKeyword, "case:"):
+				p.next()
+				value := p.parsePath("case value")
+				split := strings.SplitN(value.text, ".", 2)
+				if len(split) < 2 {
+					p.syntaxError(value.span, "Expected input.field but found %s", value.text)
+				}
+				as := a.append(&caseNode{
+					input: split[0],
+					path:  split[1],
+				}, t.span.to(value.span))
+				end := p.parseArms(as)
+				as.span = t.span.to(end)
+			case t.is(tokenKeyword, "switch:"):
+				p.next()
+				value := p.parsePath("variant")
+				split := strings.SplitN(value.text, ".", 2)
+				n := &switchNode{
+					input: split[0],
+				}
+				if len(split) > 1 {
+					n.path = split[1]
+				}
+				as := a.append(n, t.span.to(value.span))
+				end := p.parseSwitchArms(as)
+				as.span = t.span.to(end)
+			case t.is(tokenKeyword, "when:"):
+				p.next()
+				n := &whenNode{}
+				p.parseCondition(n)
+				as := a.append(n, t.span)
+				then := as.append(&thenNode{}, p.token.span)
+				end := p.parseBlock(then)
+				then.span = then.span.to(end)
+				if p.token.is(tokenKeyword, "else:") {
+					e := p.next()
+					otherwise := as.append(&elseNode{}, e.span)
+					end = p.parseBlock(otherwise)
+					otherwise.span = e.span.to(end)
+				}
+				as.span = t.span.to(end)
+				as.resolve(p.diags)
+			case t.is(tokenKeyword, "read:") || t.is(tokenKeyword, "write:"):
+				p.next()
+				from := p.parsePath("stream or value")
+				p.expect(tokenPunct, "->")
+				to := p.parsePath("stream or value")
+				n := &streamNode{
+					write: t.text == "write:",
+				}
+				stream, value := from, to
+				if n.write {
+					stream, value = to, from
+				}
+				split := strings.SplitN(stream.text, ".", 2)
+				if len(split) < 2 {
+					p.syntaxError(stream.span, "Expected input.stream but found %s", stream.text)
+				}
+				n.input, n.path, n.value = split[0], split[1], value.text
+				as := a.append(n, t.span.to(to.span))
+				end := to.span
+				if p.token.is(tokenKeyword, "else:") {
+					e := p.next()
+					otherwise := as.append(&elseNode{}, e.span)
+					end = p.parseBlock(otherwise)
+					otherwise.span = e.span.to(end)
+				}
+				as.span = t.span.to(end)
+				as.resolve(p.diags)
+			case t.is(tokenKeyword, "exit:"):
+				p.next()
+				name := p.expectIdent("exit name")
+				a.append(&exitNode{
+					name: name.text,
+				}, t.span.to(name.span))
+			case t.is(tokenKeyword, "bounds:"):
+				p.next()
+				name := p.expectIdent("exit name")
+				a.append(&boundsNode{
+					exit: name.text,
+				}, t.span.to(name.span))
+			case t.is(tokenKeyword, "slip:"):
+				p.next()
+				name := p.expectIdent("exit name")
+				a.append(&slipNode{
+					exit: name.text,
+				}, t.span.to(name.span))
+			case t.is(tokenKeyword, "loop:"):
+				p.next()
+				c := p.expect(tokenNumber, "")
+				count, err := parseInteger(c.text)
+				if err != nil {
+					p.diags.errorf(codeSyntax, c.span, "Counter value not a number: %s", c.text)
+					count = 0
+				}
+				as := a.append(&loopNode{
+					count: int(count),
+				}, t.span)
+				end := p.parseBlock(as)
+				as.span = t.span.to(end)
+			default:
+				p.syntaxError(t.span, "Unknown function token: %s", t.text)
+			}
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses populate field mappings between braces eg. departureCode <- airport.airportCode or count <- int(totals.count)
+func (p *parser) parseMappings(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			target := p.parsePath("target field")
+			p.expect(tokenPunct, "<-")
+			m := &mappingNode{
+				target: target.text,
+			}
+			source := p.parseExpression(1)
+			as := a.append(m, target.span.to(source.span))
+			// a field, or a cast of one such as byte(src.count), is copied rather than computed
+			e := source.node.(*exprNode)
+			if e.op == "cast" && len(source.sub) == 1 {
+				if n := source.sub[0].node.(*exprNode); n.input != "" {
+					m.cast = e.cast
+					e = n
+				}
+			}
+			if e.input != "" {
+				m.source = e.input
+				m.path = e.path
+			} else {
+				as.sub = []ast{source}
+			}
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses an expression by precedence climbing, from operators of the given precedence up
+func (p *parser) parseExpression(level int) ast {
+	left := p.parseUnary()
 	for {
-		line, _, err := p.reader.ReadLine()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			shenanigans("Error reading source %v", err)
-		}
-		p.lineNum++
-		// remove comments
-		rawLine := strings.Split(string(line), ";")[0]
-		tokens := strings.Fields(rawLine)
-		if len(tokens) > 0 {
-			token := tokens[0]
-			switch p.baseNode.(type) {
-			default: // no base node
-				switch token {
-				case "package:":
-					a.append(&packageNode{
-						name: tokens[1],
-					})
-				case "type:":
-					as := a.append(&structNode{
-						name: tokens[1],
-					})
-					p.baseNode = as.node
-					p.parseSource(as)
-					p.baseNode = nil
-				case "function:":
-					as := a.append(&functionNode{
-						name: tokens[1],
-					})
-					p.baseNode = as.node
-					p.parseSource(as)
-					p.baseNode = nil
-				default:
-					p.syntaxError("Unknown base token: %s", strings.TrimSpace(rawLine))
-				}
-			case *functionNode:
-				switch token {
-				case "{":
-					as := a.append(&scopeNode{})
-					p.parseSource(as)
-				case "}":
-					a.resolve()
-					return
-				case ">":
-					a.append(&inputNode{
-						name: tokens[1],
-					})
-				case "+":
-					a.append(&populateNode{
-						name: tokens[1],
-					})
-				case "loop:":
-					count, err := strconv.Atoi(tokens[1])
+		op := p.token
+		l, ok := precedence[op.text]
+		if op.kind != tokenPunct || !ok || l < level {
+			return left
+		}
+		p.next()
+		right := p.parseExpression(l + 1)
+		left = p.expression(&exprNode{op: op.text}, left.span.to(right.span), left, right)
+	}
+}
+
+// parses a field, literal, cast, parenthesised expression or unary operator and its operand
+func (p *parser) parseUnary() ast {
+	t := p.token
+	switch {
+	case t.is(tokenPunct, "-") || t.is(tokenPunct, "~"):
+		p.next()
+		op := t.text
+		if op == "-" {
+			op = "neg"
+		}
+		operand := p.parseUnary()
+		return p.expression(&exprNode{op: op}, t.span.to(operand.span), operand)
+	case t.is(tokenPunct, "("):
+		p.next()
+		e := p.parseExpression(1)
+		e.span = t.span.to(p.expect(tokenPunct, ")").span)
+		return e
+	case t.kind == tokenNumber || t.kind == tokenString:
+		p.next()
+		return ast{node: &exprNode{literal: t.text}, span: t.span}
+	case t.is(tokenKeyword, "bits:") || t.is(tokenKeyword, "sbits:"):
+		// a cast to a bit field such as bits:3(src.count)
+		typ, width, _ := p.parseBits()
+		p.expect(tokenPunct, "(")
+		operand := p.parseExpression(1)
+		end := p.expect(tokenPunct, ")")
+		cast := typ + ":" + strconv.Itoa(width)
+		return p.expression(&exprNode{op: "cast", cast: cast}, t.span.to(end.span), operand)
+	}
+	path := p.parsePath("field, literal or expression")
+	if p.token.is(tokenPunct, "(") {
+		// a cast such as byte(src.count), the cast type is a single identifier
+		if strings.Contains(path.text, ".") {
+			p.syntaxError(path.span, "Expected a cast type but found %s", path.text)
+		}
+		p.next()
+		operand := p.parseExpression(1)
+		end := p.expect(tokenPunct, ")")
+		return p.expression(&exprNode{op: "cast", cast: path.text}, path.span.to(end.span), operand)
+	}
+	split := strings.SplitN(path.text, ".", 2)
+	if len(split) < 2 {
+		return ast{node: &exprNode{literal: p.constant(path)}, span: path.span}
+	}
+	return ast{node: &exprNode{input: split[0], path: split[1]}, span: path.span}
+}
+
+// parses an expression, folding it into a literal if it's constant
+func (p *parser) parseFolded() ast {
+	e := ast{sub: []ast{p.parseExpression(1)}}
+	e.resolve(p.diags)
+	return e.sub[0]
+}
+
+// returns the literal value of true, false or a constant declared earlier in the file
+func (p *parser) constant(name token) string {
+	if name.text == "true" || name.text == "false" {
+		return name.text
+	}
+	literal, ok := p.consts[name.text]
+	if !ok {
+		p.syntaxError(name.span, "Expected input.field or constant but found %s", name.text)
+	}
+	return literal
+}
+
+// returns an operator of an expression, resolving its operands so constant ones are folded
+func (p *parser) expression(n *exprNode, s span, operands ...ast) ast {
+	a := ast{node: n, span: s, sub: operands}
+	a.resolve(p.diags)
+	return a
+}
+
+// parses the members of an enum between braces eg. { economy premium business = 5 }, returning the span of
+// the closing brace
+func (p *parser) parseEnum(a *ast) span {
+	p.expect(tokenPunct, "{")
+	next := int64(0)
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			name := p.expectIdent("enum member")
+			end := name.span
+			if p.token.is(tokenPunct, "=") {
+				p.next()
+				value := p.parseFolded()
+				v, err := parseInteger(value.node.(*exprNode).literal)
+				if err != nil {
+					p.syntaxError(value.span, "Value of enum member %s is not an integer constant", name.text)
+				}
+				next = v
+				end = value.span
+			}
+			a.append(&enumMemberNode{
+				name:  name.text,
+				value: next,
+			}, name.span.to(end))
+			next++
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses the member structs of a variant between braces, as fields named by their types
+func (p *parser) parseMembers(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			typ := p.expectIdent("member type")
+			a.append(&fieldNode{
+				name: typ.text,
+				typ:  typ.text,
+			}, typ.span)
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses call arguments between parentheses eg. (passenger, booking.flight), returning the span of the closing parenthesis
+func (p *parser) parseArguments(n *callNode) span {
+	p.expect(tokenPunct, "(")
+	for !p.token.is(tokenPunct, ")") && p.token.kind != tokenEOF {
+		if len(n.args) > 0 {
+			p.expect(tokenPunct, ",")
+		}
+		n.args = append(n.args, p.parsePath("argument").text)
+	}
+	return p.expect(tokenPunct, ")").span
+}
+
+// parses exit handlers of a call between braces eg. { notFound: { ... } }, returning the span of the closing brace
+func (p *parser) parseHandlers(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			t := p.expect(tokenKeyword, "")
+			as := a.append(&handlerNode{
+				exit: strings.TrimSuffix(t.text, ":"),
+			}, t.span)
+			end := p.parseBlock(as)
+			as.span = t.span.to(end)
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses the arms of a case between braces eg. { 0: { ... } 1, 2: { ... } default: { ... } },
+// returning the span of the closing brace
+func (p *parser) parseArms(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			t := p.token
+			arm := &caseArmNode{}
+			if t.is(tokenKeyword, "default:") {
+				p.next()
+				arm.otherwise = true
+			} else {
+				for {
+					sign := ""
+					if p.token.is(tokenPunct, "-") {
+						sign = p.next().text
+					}
+					v := p.expect(tokenNumber, "")
+					value, err := parseInteger(sign + v.text)
 					if err != nil {
-						p.syntaxError("Counter value not a number")
+						p.diags.errorf(codeSyntax, v.span, "Case value not a number: %s", v.text)
 					}
-					as := a.append(&loopNode{
-						count: count,
-					})
-					p.parseSource(as)
-				default:
-					p.syntaxError("Unknown function token: %s", strings.TrimSpace(rawLine))
-				}
-			case *structNode:
-				switch token {
-				case "}":
-					a.resolve()
-					return
-				}
-				if unicode.IsLetter(rune(token[0])) {
-					a.append(&fieldNode{
-						name: token,
-						typ:  tokens[1],
-					})
-				} else {
-					p.syntaxError("Struct name must start with a letter: %s", token)
+					arm.values = append(arm.values, int(value))
+					if !p.token.is(tokenPunct, ",") {
+						break
+					}
+					p.next()
 				}
+				p.expect(tokenPunct, ":")
+			}
+			as := a.append(arm, t.span)
+			end := p.parseBlock(as)
+			as.span = t.span.to(end)
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses the arms of a switch between braces, each a member of the variant or the default
+func (p *parser) parseSwitchArms(a *ast) span {
+	p.expect(tokenPunct, "{")
+	for !p.token.is(tokenPunct, "}") && p.token.kind != tokenEOF {
+		p.statement(false, func() {
+			t := p.expect(tokenKeyword, "")
+			arm := &switchArmNode{
+				member:    strings.TrimSuffix(t.text, ":"),
+				otherwise: t.text == "default:",
 			}
+			as := a.append(arm, t.span)
+			end := p.parseBlock(as)
+			as.span = t.span.to(end)
+		})
+	}
+	end := p.closeBrace()
+	a.resolve(p.diags)
+	return end
+}
+
+// parses the operand of a comparison, a field of an input or a literal
+func (p *parser) parseOperand() operand {
+	if p.token.is(tokenPunct, "-") {
+		p.next()
+		n := p.expect(tokenNumber, "")
+		return operand{literal: "-" + n.text}
+	}
+	if p.token.kind == tokenNumber {
+		return operand{literal: p.next().text}
+	}
+	path := p.parsePath("field or literal")
+	split := strings.SplitN(path.text, ".", 2)
+	if len(split) < 2 {
+		return operand{literal: p.constant(path)}
+	}
+	return operand{input: split[0], path: split[1]}
+}
+
+// parses comparisons joined by && or || eg. booking.seatClass >= 2 && pass.gate != 0
+func (p *parser) parseCondition(n *whenNode) {
+	for {
+		t := comparison{left: p.parseOperand()}
+		op := p.expect(tokenPunct, "")
+		if _, ok := mirrored[op.text]; !ok {
+			p.syntaxError(op.span, "Expected a comparison but found %s", op)
+		}
+		t.op = op.text
+		t.right = p.parseOperand()
+		n.terms = append(n.terms, t)
+		if !p.token.is(tokenPunct, "&&") && !p.token.is(tokenPunct, "||") {
+			return
 		}
+		join := p.next()
+		if n.join != "" && n.join != join.text {
+			p.syntaxError(join.span, "Conditions can not mix && and ||, nest them in separate when blocks")
+		}
+		n.join = join.text
 	}
-	a.resolve()
 }
 
-func (p *parser) syntaxError(format string, a ...interface{}) {
-	shenanigans("%s line %d: %s", p.filename, p.lineNum, fmt.Sprintf(format, a...))
+// parses a dotted path of identifiers eg. pass.passengerName, returning it as a single token. arrays are
+// indexed by a number, a constant or a field of an input eg. booking.seats[pass.seat].number
+func (p *parser) parsePath(what string) token {
+	t := p.expectIdent(what)
+	p.parseIndex(&t)
+	for p.token.is(tokenPunct, ".") {
+		p.next()
+		n := p.expectIdent(what)
+		t.text += "." + n.text
+		t.span = t.span.to(n.span)
+		p.parseIndex(&t)
+	}
+	return t
+}
+
+// appends the index of an array to a path, substituting constants
+func (p *parser) parseIndex(t *token) {
+	if !p.token.is(tokenPunct, "[") {
+		return
+	}
+	p.next()
+	index := p.token
+	if index.kind == tokenNumber {
+		p.next()
+	} else {
+		index = p.parsePath("index")
+		if !strings.Contains(index.text, ".") {
+			index.text = p.constant(index)
+		}
+	}
+	end := p.expect(tokenPunct, "]")
+	t.text += "[" + index.text + "]"
+	t.span = t.span.to(end.span)
+}
+
+func (p *parser) closeBrace() span {
+	if p.token.kind == tokenEOF {
+		p.diags.errorf(codeSyntax, p.token.span, "Unexpected end of file, expected }")
+		return p.token.span
+	}
+	return p.next().span
+}
+
+// runs a statement parse, recovering from a syntax error by skipping to the start of the next statement
+func (p *parser) statement(base bool, parse func()) {
+	start := p.token.span.start
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			if p.token.span.start == start {
+				p.next() // always make progress past the offending token
+			}
+			p.synchronise(base)
+		}
+	}()
+	parse()
+}
+
+// skips tokens until one that can start a statement at the current nesting depth, or the closing brace of the block
+func (p *parser) synchronise(base bool) {
+	depth := 0
+	for p.token.kind != tokenEOF {
+		t := p.token
+		if depth == 0 {
+			if base && (t.is(tokenKeyword, "package:") || t.is(tokenKeyword, "type:") || t.is(tokenKeyword, "variant:") ||
+				t.is(tokenKeyword, "enum:") || t.is(tokenKeyword, "const:") || t.is(tokenKeyword, "function:")) {
+				return
+			}
+			if !base && (t.kind == tokenKeyword || t.is(tokenPunct, ">") || t.is(tokenPunct, "+") || t.is(tokenPunct, "}")) {
+				return
+			}
+		}
+		if t.is(tokenPunct, "{") {
+			depth++
+		} else if t.is(tokenPunct, "}") && depth > 0 {
+			depth--
+		}
+		p.next()
+	}
+}
+
+// advances to the next non comment token, returning the previous current token
+func (p *parser) next() token {
+	t := p.token
+	for {
+		p.token = p.lexer.next()
+		if p.token.kind == tokenIllegal {
+			p.diags.errorf(codeSyntax, p.token.span, "Illegal token: %s", p.token.text)
+			continue
+		}
+		if p.token.kind == tokenNumber && leadingZero(p.token.text) {
+			// read as decimal once reported, so it isn't reported again as a double
+			p.diags.errorf(codeSyntax, p.token.span, "Number %s has a leading zero, octal is not supported", p.token.text)
+			n := len(p.token.text) - 1
+			p.token.text = strings.TrimLeft(p.token.text[:n], "0") + p.token.text[n:]
+		}
+		if p.token.kind != tokenComment {
+			break
+		}
+	}
+	return t
+}
+
+// consumes the current token if it matches the kind, and text if not empty
+func (p *parser) expect(kind tokenKind, text string) token {
+	t := p.token
+	if t.kind != kind || (text != "" && t.text != text) {
+		if text != "" {
+			p.syntaxError(t.span, "Expected '%s' but found %s", text, t)
+		} else {
+			p.syntaxError(t.span, "Expected %s but found %s", kind, t)
+		}
+	}
+	return p.next()
+}
+
+func (p *parser) expectIdent(what string) token {
+	t := p.token
+	if t.kind != tokenIdent {
+		p.syntaxError(t.span, "Expected %s but found %s", what, t)
+	}
+	return p.next()
+}
+
+func (p *parser) syntaxError(s span, format string, a ...interface{}) {
+	p.diags.errorf(codeSyntax, s, format, a...)
+	panic(bailout{})
 }
 
 func (as *ast) printNode(w io.Writer, indent int) {
@@ -136,26 +820,17 @@ func (as *ast) getHash() []byte {
 	return h.Sum(nil)
 }
 
-func parseFile(o options, filename string, channel chan unit) {
-	file, err := os.Open(filename)
-	if err != nil {
-		shenanigans("Failed to open file: %s %v", filename, err)
-	}
-	defer file.Close()
-
+func parseUnit(s source, d *diagnostics, channel chan unit) {
 	p := parser{
-		reader:   bufio.NewReader(file),
-		filename: filename,
-		verbose:  o.verbose,
+		lexer:    newLexer(s.filename, s.data),
+		filename: s.filename,
+		diags:    d,
+		consts:   map[string]string{},
 	}
 	p.parseSource(&p.ast)
 
-	if o.verbose {
-		p.ast.printNode(os.Stdout, 0)
-	}
-
 	u := unit{
-		filename: filename,
+		filename: s.filename,
 		ast:      p.ast,
 	}
 	channel <- u
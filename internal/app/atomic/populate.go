@@ -0,0 +1,340 @@
+package atomic
+
+import (
+	"strings"
+)
+
+type populateNode struct {
+	name string
+	path string // the member of a variant within the input eg. pay.card, populated in place of the input
+}
+
+// a field of an input which may populate a target field
+type populateSource struct {
+	name  string // the input
+	field fieldPath
+}
+
+// target fields are populated from the same named fields of the inputs, unless mapped explicitly
+func (n *populateNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	mappings := collectMappings(a)
+	return func(f *frame, p *profile, as *asm) func() {
+		targetStruct, ok := f.ref.structs[n.name]
+		if !ok {
+			f.errorf(codeUnresolved, "Unable to resolve struct %s", n.name)
+			return nil
+		}
+		target := n.name
+		var variant fieldPath
+		member := 0
+		if n.path != "" {
+			if targetStruct, variant, member, ok = f.variantTarget(n); !ok {
+				return nil
+			}
+			target += "." + n.path
+		} else if targetStruct.variant {
+			f.errorf(codeType, "Variant %s is populated by one of its members eg. + %s.member", n.name, n.name)
+			return nil
+		}
+
+		targetRegister, ok := f.loadValue(p, as, n.name, 0)
+		if !ok {
+			f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", n.name)
+			return nil
+		}
+		tmp, _ := f.registerForValue(p, "tmp")
+		ftmp, _ := f.floatRegisterForValue(p, "ftmp")
+		f.populating = n.name
+
+		targetFields := f.ref.flatten(targetStruct, false)
+		explicit, elements := f.checkMappings(mappings, targetStruct, targetFields)
+		if n.path != "" {
+			// the fields of the member are reached as the variant holding it is
+			for i := range targetFields {
+				targetFields[i] = targetFields[i].within(variant, member)
+			}
+			for i := range elements {
+				elements[i] = elements[i].within(variant, member)
+			}
+		}
+		sources := f.populateSources(n.name)
+		var sourceName string
+		var sourceRegister register
+
+		for _, field := range append(targetFields, elements...) {
+			var from populateSource
+			at := f.span
+			cast := false
+			if m, ok := explicit[field.path]; ok {
+				if _, ok := f.ref.enums[m.source]; ok && m.expr == nil {
+					m.expr = m.member()
+				}
+				if m.expr != nil {
+					f.emitExpression(p, as, m, target, field, f.targetBase(p, as, field, targetRegister))
+					f.releaseValue("target")
+					sourceName = "" // spilled inputs of the expression were reloaded into the source's spill register
+					continue
+				}
+				if from, ok = f.mappedSource(m, target, field); !ok {
+					continue
+				}
+				at = m.span
+				cast = m.cast != ""
+			} else {
+				var matches []populateSource
+				for _, s := range sources {
+					if s.field.name == field.name {
+						matches = append(matches, s)
+					}
+				}
+				matches = shallowest(matches)
+				switch len(matches) {
+				case 0:
+					f.diags.warnf(codeUnpopulated, f.span, "Field %s.%s is not populated", target, field.path)
+					continue
+				case 1:
+					from = matches[0]
+				default:
+					names := make([]string, len(matches))
+					for i, s := range matches {
+						names[i] = s.name + "." + s.field.path
+					}
+					f.errorf(codeAmbiguous, "Field %s.%s matches %s, map it explicitly",
+						target, field.path, strings.Join(names, " and "))
+					continue
+				}
+			}
+
+			c, ok := f.checkConversion(at, from, target, field, cast)
+			if !ok {
+				continue
+			}
+			if from.name != sourceName {
+				// spilled inputs are reloaded into the same spill register, so only when the input changes
+				sourceName = from.name
+				sourceRegister, _ = f.loadValue(p, as, from.name, 1)
+			}
+			toBase := f.targetBase(p, as, field, targetRegister)
+			base := f.emitDerefs(p, as, from.field, sourceRegister.index, tmp)
+			f.emitConversion(p, as, c, from.field, base, field, toBase, tmp, ftmp)
+			f.releaseValue("target")
+		}
+		if n.path != "" {
+			f.emitTag(p, as, n, variant, targetRegister, tmp)
+		}
+		f.populating = ""
+		f.releaseValue("ftmp")
+		f.releaseValue("tmp")
+		return nil
+	}
+}
+
+// returns the register holding the base of a target field, computing it into a register of its own when the field
+// is an element of an array indexed by a field
+func (f *frame) targetBase(p *profile, as *asm, field fieldPath, base register) int {
+	if !field.computed() {
+		return base.index
+	}
+	rt, _ := f.registerForValue(p, "target")
+	return f.emitDerefs(p, as, field, base.index, rt)
+}
+
+// returns the inputs a populate may read, for computing their live ranges before emission
+func (n *populateNode) uses(r *reference, a *ast, declared []string) []string {
+	uses := []string{n.name}
+	target, ok := r.structs[n.name]
+	if n.path != "" {
+		// a member of a variant, named by its struct
+		uses = append(uses, indexInputs(n.path)...)
+		target, ok = r.structs[n.path[strings.LastIndex(n.path, ".")+1:]]
+	}
+	if !ok {
+		return uses
+	}
+	mapped := map[string]bool{}
+	for _, m := range collectMappings(a) {
+		mapped[m.target] = true
+		uses = append(uses, indexInputs(m.target)...)
+		if m.expr != nil {
+			uses = append(uses, expressionInputs(m.expr)...)
+		} else {
+			uses = append(append(uses, m.source), indexInputs(m.path)...)
+		}
+	}
+	names := map[string]bool{}
+	for _, field := range r.flatten(target, false) {
+		if !mapped[field.path] {
+			names[field.name] = true
+		}
+	}
+	for _, name := range declared {
+		s, ok := r.structs[name]
+		if !ok || name == n.name {
+			continue
+		}
+		for _, field := range r.flatten(s, true) {
+			if names[field.name] {
+				uses = append(uses, name)
+				break
+			}
+		}
+	}
+	return uses
+}
+
+// returns the fields of the inputs, other than the target, which may populate the target by name.
+// inputs are taken in declaration order so the result never depends on map ordering
+func (f *frame) populateSources(target string) []populateSource {
+	var sources []populateSource
+	for _, name := range f.declaredInputs() {
+		s, ok := f.ref.structs[name]
+		if name == target || !ok {
+			continue
+		}
+		if !f.hasValue(name) {
+			continue
+		}
+		for _, field := range f.ref.flatten(s, true) {
+			sources = append(sources, populateSource{
+				name:  name,
+				field: field,
+			})
+		}
+	}
+	return sources
+}
+
+// returns the sources with the shallowest field path, so a field of an input wins over one reached through
+// its nested structs and pointers. several remaining sources are ambiguous
+func shallowest(sources []populateSource) []populateSource {
+	var best []populateSource
+	depth := -1
+	for _, s := range sources {
+		d := strings.Count(s.field.path, ".")
+		if depth == -1 || d < depth {
+			best = best[:0]
+			depth = d
+		}
+		if d == depth {
+			best = append(best, s)
+		}
+	}
+	return best
+}
+
+// an explicit field mapping within a populate block eg. departureCode <- airport.airportCode
+// a mapping from an expression has no source, the expression is its sub
+type mappingNode struct {
+	target string // field path within the populated struct
+	source string // the input
+	path   string // field path within the input
+	cast   string // type of an explicit conversion, permitting narrowing
+}
+
+func (n *mappingNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	a.resolve(d)
+	return nil
+}
+
+type mapping struct {
+	mappingNode
+	span span
+	expr *ast // the expression computing the field, if any
+}
+
+func collectMappings(a *ast) []mapping {
+	var mappings []mapping
+	for i := range a.sub {
+		s := &a.sub[i]
+		if m, ok := s.node.(*mappingNode); ok {
+			mapped := mapping{
+				mappingNode: *m,
+				span:        s.span,
+			}
+			if len(s.sub) > 0 {
+				mapped.expr = &s.sub[0]
+			}
+			mappings = append(mappings, mapped)
+		}
+	}
+	return mappings
+}
+
+// returns an expression of the enum member a mapping names as its source eg. seat <- seatClass.business
+func (m mapping) member() *ast {
+	a := &ast{node: &exprNode{input: m.source, path: m.path}, span: m.span}
+	if m.cast != "" {
+		a = &ast{node: &exprNode{op: "cast", cast: m.cast}, span: m.span, sub: []ast{*a}}
+	}
+	return a
+}
+
+// returns the mappings by target field path, reporting those to unknown or already mapped fields, and the
+// elements of arrays they map, which are only populated explicitly eg. seats[0].number <- pass.seat
+func (f *frame) checkMappings(mappings []mapping, target *structNode, fields []fieldPath) (map[string]mapping, []fieldPath) {
+	paths := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		paths[field.path] = true
+	}
+	explicit := make(map[string]mapping, len(mappings))
+	var elements []fieldPath
+	for _, m := range mappings {
+		if _, dupe := explicit[m.target]; dupe {
+			f.diags.errorf(codeDuplicate, m.span, "Field %s.%s is already mapped", target.name, m.target)
+			continue
+		}
+		if !paths[m.target] && !strings.Contains(m.target, "[") {
+			f.diags.errorf(codeUnresolved, m.span, "Type %s has no field %s", target.name, m.target)
+			continue
+		}
+		if !paths[m.target] {
+			element, ok := f.ref.lookup(target, m.target, f.diags, m.span)
+			if !ok {
+				continue
+			}
+			if len(element.derefs) > 0 {
+				f.diags.errorf(codeUnresolved, m.span, "Type %s has no field %s", target.name, m.target)
+				continue
+			}
+			if element.nested {
+				f.diags.errorf(codeType, m.span, "Can not populate %s.%s %s, map the fields of the element",
+					target.name, m.target, typeName(element))
+				continue
+			}
+			elements = append(elements, element)
+		}
+		explicit[m.target] = m
+	}
+	return explicit, elements
+}
+
+// resolves the source of an explicit mapping, which must be a field of an input
+func (f *frame) mappedSource(m mapping, target string, to fieldPath) (populateSource, bool) {
+	s, ok := f.ref.structs[m.source]
+	if !ok {
+		f.diags.errorf(codeUnresolved, m.span, "Unable to resolve struct %s", m.source)
+		return populateSource{}, false
+	}
+	if !f.hasValue(m.source) {
+		f.diags.errorf(codeUnresolved, m.span, "Unable to resolve %s, it is not an input", m.source)
+		return populateSource{}, false
+	}
+	if m.cast != "" && m.cast != typeName(to) {
+		f.diags.errorf(codeType, m.span, "Cast to %s does not match %s.%s %s", m.cast, target, to.path, typeName(to))
+		return populateSource{}, false
+	}
+	for _, field := range f.ref.flatten(s, true) {
+		if field.path == m.path {
+			return populateSource{
+				name:  m.source,
+				field: field,
+			}, true
+		}
+	}
+	// elements of arrays aren't flattened, nor are structs and arrays held by value, which fail the conversion
+	field, ok := f.ref.lookup(s, m.path, f.diags, m.span)
+	return populateSource{
+		name:  m.source,
+		field: field,
+	}, ok
+}
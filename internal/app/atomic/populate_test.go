@@ -0,0 +1,257 @@
+package atomic
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// fields of structs held by value are populated in place, and those reached through pointers are loaded through them
+func TestNestedPopulate(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: airport { code int hub *airport }
+type: pass { gate short dep airport arr *airport }
+type: src { code int gate short }
+function: f {
+    > src
+    > pass
+    + pass
+}
+function: g {
+    > pass
+    > src
+    + src { code <- pass.arr.code }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsh i=2 n=0 t=8", "strh i=0 n=1 t=8", // src.gate to pass.gate
+			"ldrsw i=0 n=0 t=8", "str.w i=2 n=1 t=8", // src.code to pass.dep.code at 8
+			"exit_f:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldr i=3 n=0 t=8", "ldrsw i=0 n=8 t=8", "str.w i=0 n=1 t=8", // pass.arr at 24, then its code
+			"ldrsh i=0 n=0 t=8", "strh i=2 n=1 t=8", // pass.gate to src.gate at 4
+			"exit_g:", "ret n=30", "padding", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fields matched by name widen to the type of the target, converting integers to doubles with scvtf
+func TestPopulateWidening(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: src { b byte i int }
+type: dst { b int i double }
+function: f {
+    > src
+    > dst
+    + dst
+}
+`)
+	want := []string{
+		"f:",
+		"ldrb i=0 n=0 t=8", "str.w i=0 n=1 t=8",
+		"ldrsw i=1 n=0 t=8", "scvtf d=16 n=8", "str i=1 n=1 t=16",
+		"exit_f:", "ret n=30", "padding", "padding",
+	}
+	if got := functionInstructions(listing, "f"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// fields matched by name which narrow, or can't be converted, are errors at the populate
+func TestPopulateTypeErrors(t *testing.T) {
+	got := compileDiagnostics(t, `package: t
+type: other { x int }
+type: src { a long b int c double e *other f short g long }
+type: dst { a int b byte c int e int f short g double }
+function: f {
+    > src
+    > dst
+    + dst
+}
+`)
+	want := []string{
+		"A204 8:5 Populating dst.a int from src.a long narrows, which requires an explicit cast",
+		"A204 8:5 Populating dst.b byte from src.b int narrows, which requires an explicit cast",
+		"A204 8:5 Populating dst.c int from src.c double narrows, which requires an explicit cast",
+		"A204 8:5 Can not populate dst.e int from src.e *other",
+		"A204 8:5 Populating dst.g double from src.g long narrows, which requires an explicit cast",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// explicit mappings override matching by name, which still populates the fields they leave
+func TestExplicitMappings(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: airport { code int gate short }
+type: src { l long d double }
+type: pass { dep int gate short c int d double }
+function: f {
+    > airport
+    > src
+    > pass
+    + pass { dep <- airport.code gate <- airport.gate c <- int(src.l) }
+}
+function: g {
+    > src
+    > pass
+    + pass { c <- int(src.d) dep <- 0 gate <- 0 }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=8", "str.w i=0 n=2 t=8", // airport.code to pass.dep
+			"ldrsh i=2 n=0 t=8", "strh i=2 n=2 t=8",
+			"ldr i=0 n=1 t=8", "str.w i=2 n=2 t=8", // src.l cast to int, truncated by the store
+			"ldr i=1 n=1 t=16", "str i=2 n=2 t=16", // src.d matched by name
+			"exit_f:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"movz d=9 h=0 i=0", "str.w i=0 n=1 t=9",
+			"movz d=9 h=0 i=0", "strh i=2 n=1 t=9",
+			"ldr i=1 n=0 t=16", "fcvtzs d=8 n=16", "str.w i=2 n=1 t=8", // src.d cast to int, rounding toward zero
+			"ldr i=1 n=0 t=16", "str i=2 n=1 t=16",
+			"exit_g:", "ret n=30", "padding", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// ambiguous matches by name are errors, and target fields matched by nothing are warnings
+func TestMappingDiagnostics(t *testing.T) {
+	got := compileDiagnostics(t, `package: t
+type: airport { code int gate short }
+type: crew { gate short }
+type: src { l long d double }
+type: pass { dep int gate short c int d double }
+function: f {
+    > airport
+    > crew
+    > pass
+    + pass { dep <- airport.code }
+}
+function: g {
+    > src
+    > pass
+    + pass { c <- byte(src.l) d <- src.l dep <- src.nope gate <- 1 }
+}
+`)
+	want := []string{
+		"A205 10:5 Field pass.gate matches airport.gate and crew.gate, map it explicitly",
+		"A206 10:5 Field pass.c is not populated",
+		"A206 10:5 Field pass.d is not populated",
+		"A204 15:14 Cast to byte does not match pass.c int",
+		"A204 15:31 Populating pass.d double from src.l long narrows, which requires an explicit cast",
+		"A202 15:42 Type src has no field nope",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// only the function's inputs populate fields by name, and a field of an input wins over one nested in another input
+func TestPopulateInputs(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: airport { code int gate short }
+type: crew { airport airport }
+type: other { code int }
+type: pass { code int gate short }
+function: f {
+    > crew
+    > airport
+    > pass
+    + pass
+}
+function: g {
+    > crew
+    > pass
+    + pass
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsw i=0 n=1 t=8", "str.w i=0 n=2 t=8", // airport, the second input, over crew.airport
+			"ldrsh i=2 n=1 t=8", "strh i=2 n=2 t=8",
+			"exit_f:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=0 n=0 t=8", "str.w i=0 n=1 t=8", // crew.airport, as airport and other aren't inputs
+			"ldrsh i=2 n=0 t=8", "strh i=2 n=1 t=8",
+			"exit_g:", "ret n=30", "padding", "padding", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// objects are identical across compilations, whatever the order of maps and goroutines
+func TestDeterministicOutput(t *testing.T) {
+	source := []byte(`package: t
+type: a { x int y short z long }
+type: b { x int w byte }
+type: c { y short v double }
+type: d { x int y short z long w byte v double }
+function: f {
+    > a
+    > b
+    > c
+    > d
+    + d { x <- b.x y <- a.y }
+}
+function: g {
+    > c
+    > a
+    > d
+    + d { w <- 1 y <- c.y }
+}
+`)
+	p := testProfile(t)
+	var first []byte
+	for i := 0; i < 20; i++ {
+		r := Compile([]Source{{Filename: "test.atomic", Data: source}}, Options{Profile: p, Concurrency: 4})
+		if errors := compileErrors(r); len(errors) > 0 {
+			t.Fatalf("unexpected errors: %v", errors)
+		}
+		if i == 0 {
+			first = r.Files[0].Object
+		} else if !bytes.Equal(r.Files[0].Object, first) {
+			t.Fatalf("compilation %d differs from the first", i)
+		}
+	}
+}
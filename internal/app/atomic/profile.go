@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math/bits"
 	"os"
 	"sort"
 	"strconv"
@@ -17,6 +18,10 @@ type register struct {
 	param   bool
 	result  bool
 	link    bool
+	frame   bool
+	stack   bool
+	spill   bool // reserved for reloading spilled values
+	float   bool // floating point and simd register
 }
 
 type instruction struct {
@@ -33,16 +38,25 @@ type param struct {
 	len    int
 }
 
+// size and alignment of a primative in the target abi
+type typeLayout struct {
+	size  int
+	align int
+}
+
 type profile struct {
 	instructions []instruction
 	registers    []register
+	layouts      map[string]typeLayout
 	targetos     string
+	diags        *diagnostics
+	frame        *frame // of the function being emitted, through which failed lookups are reported
 }
 
 func (i instruction) isSupported() bool {
 	for _, o := range i.order {
-		// ignoring and SIMD, Vector or Float instructions for now
-		if len(o) == 2 && (strings.HasPrefix(o, "S") || strings.HasPrefix(o, "V") || strings.HasPrefix(o, "F")) {
+		// ignoring and SIMD or Vector instructions for now
+		if len(o) == 2 && (strings.HasPrefix(o, "S") || strings.HasPrefix(o, "V")) {
 			return false
 		}
 		if strings.HasPrefix(o, "SIMD") {
@@ -52,14 +66,28 @@ func (i instruction) isSupported() bool {
 	return true
 }
 
-func loadProfile(o options, filename string) profile {
+func loadProfile(o options, filename string, d *diagnostics) profile {
 	file, err := os.Open(filename)
 	if err != nil {
-		shenanigans("Failed to open file: %s %v", filename, err)
+		d.errorf(codeIO, span{}, "Failed to open file: %s %v", filename, err)
+		return profile{
+			targetos: o.targetos,
+			diags:    d,
+		}
 	}
 	defer file.Close()
 
-	reader := bufio.NewReader(file)
+	return readProfile(file, filename, o.targetos, o.verbose, d)
+}
+
+// parses a profile for the target os, the filename is only used for diagnostics
+func readProfile(r io.Reader, filename string, targetos string, verbose bool, d *diagnostics) profile {
+	p := profile{
+		layouts:  map[string]typeLayout{},
+		targetos: targetos,
+		diags:    d,
+	}
+	reader := bufio.NewReader(r)
 
 	dupe := make(map[uint32]instruction)
 	instructions := []instruction{}
@@ -71,36 +99,46 @@ func loadProfile(o options, filename string) profile {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			shenanigans("Error reading source %v", err)
+			d.errorf(codeIO, span{}, "Error reading profile %s %v", filename, err)
+			break
 		}
 
 		lnum++
+		at := span{start: position{filename: filename, line: lnum}}
 		line := strings.Split(strings.TrimSpace(string(bytes)), "#")[0] // remove comments
 		if len(line) == 0 {
 			continue
 		}
 
+		if strings.HasPrefix(line, "@") { // type layout
+			name, l := parseLayout(line, at, targetos, d)
+			if name != "" {
+				p.layouts[name] = l
+			}
+			continue
+		}
+
 		if strings.HasPrefix(line, "!") { // register
-			r := parseRegister(line, lnum, o.targetos)
+			r := parseRegister(line, at, targetos, d)
 			if r.name == "" {
 				continue
 			}
 			registers = append(registers, r)
-			if o.verbose {
+			if verbose {
 				fmt.Printf("%+v\n", r)
 			}
 			continue
 		}
 
-		ins, template := parseInstruction(line, lnum)
-		if !ins.isSupported() {
+		ins, template := parseInstruction(line, at, d)
+		if ins.name == "" || !ins.isSupported() {
 			continue
 		}
 
-		d, exists := dupe[ins.bits]
+		existing, exists := dupe[ins.bits]
 		if exists {
-			if o.verbose {
-				fmt.Printf("Instruction with duplicate bits.\nIgnoring: %+v\nEquals:   %+v\n", ins, d)
+			if verbose {
+				fmt.Printf("Instruction with duplicate bits.\nIgnoring: %+v\nEquals:   %+v\n", ins, existing)
 			}
 			continue
 		}
@@ -108,22 +146,24 @@ func loadProfile(o options, filename string) profile {
 		instructions = append(instructions, ins)
 		dupe[ins.bits] = ins
 
-		if o.verbose {
+		if verbose {
 			fmt.Printf("%s %+v mask bits: %08x : %08x\n", template, ins, ins.mask, ins.bits)
 		}
 	}
 
-	return profile{
-		instructions: instructions,
-		registers:    registers,
-		targetos:     o.targetos,
-	}
+	p.instructions = instructions
+	p.registers = registers
+	return p
 }
 
-func parseRegister(line string, lnum int, targetOs string) register {
+func parseRegister(line string, at span, targetOs string, d *diagnostics) register {
 	split := strings.Split(line, "!")
 	reg := strings.TrimSpace(split[1])
-	segments := strings.Split(reg, " ")
+	segments := strings.Fields(reg)
+	if len(segments) < 2 {
+		d.errorf(codeProfile, at, "Register requires an index and a name")
+		return register{}
+	}
 	tags := segments[2:]
 
 	if contains(tags, "no"+targetOs) {
@@ -132,7 +172,8 @@ func parseRegister(line string, lnum int, targetOs string) register {
 
 	num, err := strconv.Atoi(segments[0])
 	if err != nil {
-		shenanigans("Unable to parse register index on line %d\n", lnum)
+		d.errorf(codeProfile, at, "Unable to parse register index")
+		return register{}
 	}
 	r := register{
 		index:   num,
@@ -141,18 +182,49 @@ func parseRegister(line string, lnum int, targetOs string) register {
 		param:   contains(tags, "param"),
 		result:  contains(tags, "result"),
 		link:    contains(tags, "link"),
+		frame:   contains(tags, "frame"),
+		stack:   contains(tags, "stack"),
+		spill:   contains(tags, "spill"),
+		float:   contains(tags, "float"),
 	}
 	return r
 }
 
-func parseInstruction(line string, lnum int) (instruction, string) {
+func parseLayout(line string, at span, targetOs string, d *diagnostics) (string, typeLayout) {
+	segments := strings.Fields(strings.TrimPrefix(line, "@"))
+	if len(segments) < 3 {
+		d.errorf(codeProfile, at, "Type layout requires a name, size and alignment")
+		return "", typeLayout{}
+	}
+	if contains(segments[3:], "no"+targetOs) {
+		return "", typeLayout{}
+	}
+
+	size, err := strconv.Atoi(segments[1])
+	align, aerr := strconv.Atoi(segments[2])
+	if err != nil || aerr != nil || size < 0 || align <= 0 || align&(align-1) != 0 {
+		d.errorf(codeProfile, at, "Type layout requires a size and a power of two alignment")
+		return "", typeLayout{}
+	}
+	return segments[0], typeLayout{
+		size:  size,
+		align: align,
+	}
+}
+
+func parseInstruction(line string, at span, d *diagnostics) (instruction, string) {
 	split := strings.Split(line, "-")
 	template := strings.Replace(split[0], " ", "", -1)
+	if len(split) < 2 {
+		d.errorf(codeProfile, at, "Instruction template requires a name")
+		return instruction{}, template
+	}
 	asm := strings.TrimSpace(split[1])
 	segments := strings.Split(asm, " ")
 
 	if len(template) != 32 {
-		shenanigans("Instruction template length not 32 on line %d\n", lnum)
+		d.errorf(codeProfile, at, "Instruction template length not 32")
+		return instruction{}, template
 	}
 
 	paramMap := make(map[rune]param)
@@ -219,32 +291,79 @@ func (p *profile) match(bin uint32) {
 	}
 }
 
+// describes an instruction binary using the most specific matching profile instruction
+func (p *profile) describe(bin uint32) string {
+	var best *instruction
+	for i, ins := range p.instructions {
+		if bin&ins.mask == ins.bits && (best == nil || bits.OnesCount32(ins.mask) > bits.OnesCount32(best.mask)) {
+			best = &p.instructions[i]
+		}
+	}
+	if best == nil {
+		return "?"
+	}
+	var sb strings.Builder
+	sb.WriteString(best.name)
+	for _, ps := range best.params {
+		fmt.Fprintf(&sb, " %c=%d", ps.code, (bin>>ps.offset)&(1<<ps.len-1))
+	}
+	return sb.String()
+}
+
 func (p *profile) findNoargs(name string) uint32 {
 	for _, ins := range p.instructions {
 		if ins.name == name && len(ins.params) == 0 {
 			return ins.bits
 		}
 	}
-	shenanigans("Couldn't find instruction %s\n", name)
+	p.errorf(codeInstruction, "Couldn't find instruction %s", name)
 	return 0
 }
 
+// reports a failed lookup at the statement being emitted, or without a position outside of a function
+func (p *profile) errorf(code string, format string, a ...interface{}) {
+	if p.frame != nil {
+		p.frame.errorf(code, format, a...)
+		return
+	}
+	p.diags.errorf(code, span{}, format, a...)
+}
+
+// finds a general purpose register form of an instruction
 func (p *profile) find(name string, paramSet string) instruction {
+	return p.findForm(name, paramSet, false)
+}
+
+// finds a form of an instruction with floating point register operands
+func (p *profile) findFloat(name string, paramSet string) instruction {
+	return p.findForm(name, paramSet, true)
+}
+
+func (p *profile) findForm(name string, paramSet string, float bool) instruction {
 	for _, ins := range p.instructions {
-		if ins.name == name && ins.hasParams(paramSet) {
+		if ins.name == name && ins.hasParams(paramSet) && ins.usesFloat() == float {
 			return ins
 		}
 	}
-	shenanigans("Couldn't find instruction %s with %s\n", name, paramSet)
+	p.errorf(codeInstruction, "Couldn't find instruction %s with %s", name, paramSet)
 	return instruction{}
 }
 
+func (i *instruction) usesFloat() bool {
+	for _, o := range i.order {
+		if strings.HasPrefix(o, "F") && len(o) <= 3 { // eg. Fd Ft Ft2
+			return true
+		}
+	}
+	return false
+}
+
 func (i instruction) set(paramSet string, params ...int) uint32 {
 	b := i.bits
 	for _, ps := range i.params {
 		for i, p := range paramSet {
 			if ps.code == p {
-				b |= uint32(params[i] << ps.offset)
+				b |= uint32(params[i]&(1<<ps.len-1)) << ps.offset // masked, so negative offsets encode as two's complement
 			}
 		}
 	}
@@ -278,20 +397,79 @@ func (p *profile) findReg(name string, n int) uint32 {
 			}
 		}
 	}
-	shenanigans("Couldn't find instruction %s\n", name)
+	p.errorf(codeInstruction, "Couldn't find instruction %s", name)
 	return 0
 }
 
+// returns the primative for a type name, sized and aligned for the target abi
+func (p *profile) primative(name string) (primative, bool) {
+	pr, ok := primatives[name]
+	if ok {
+		pr = p.layout(pr)
+	}
+	return pr, ok
+}
+
+func (p *profile) layout(pr primative) primative {
+	if l, ok := p.layouts[pr.name]; ok {
+		pr.size = l.size
+		pr.align = l.align
+	}
+	return pr
+}
+
 func (p *profile) findLinkRegister() register {
 	for _, r := range p.registers {
 		if r.link {
 			return r
 		}
 	}
-	shenanigans("Couldn't find link register\n")
+	p.errorf(codeProfile, "Couldn't find link register")
+	return register{}
+}
+
+func (p *profile) findFrameRegister() register {
+	for _, r := range p.registers {
+		if r.frame {
+			return r
+		}
+	}
+	p.errorf(codeProfile, "Couldn't find frame register")
 	return register{}
 }
 
+func (p *profile) findStackRegister() register {
+	for _, r := range p.registers {
+		if r.stack {
+			return r
+		}
+	}
+	p.errorf(codeProfile, "Couldn't find stack register")
+	return register{}
+}
+
+// returns the registers reserved for reloading spilled values
+func (p *profile) spillRegisters() []register {
+	var rs []register
+	for _, r := range p.registers {
+		if r.spill {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// returns the general purpose registers which pass parameters, in order
+func (p *profile) paramRegisters() []register {
+	var rs []register
+	for _, r := range p.registers {
+		if r.param && !r.float {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
 func contains(sa []string, s string) bool {
 	for _, v := range sa {
 		if v == s {
@@ -0,0 +1,165 @@
+package atomic
+
+// declares an alternate exit of a function eg. exit: notFound. the return address of each exit arrives in the
+// parameter register following the inputs, in declaration order, and is held as a value until its last slip
+type exitNode struct {
+	name string
+}
+
+func (n *exitNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		if contains(f.declaredInputs(), exitValue(n.name)) {
+			f.errorf(codeDuplicate, "Exit %s is already declared", n.name)
+			return nil
+		}
+		f.declareInput(exitValue(n.name))
+		return nil
+	}
+}
+
+// the name of the value holding the return address of an exit, which can't collide with an input
+func exitValue(name string) string {
+	return "exit " + name
+}
+
+// takes an alternate exit eg. slip: notFound. the function's frame is freed as it would be for a return,
+// then it branches to the exit's return address rather than the link register
+type slipNode struct {
+	exit string
+}
+
+func (n *slipNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		f.emitSlip(p, as, n.exit)
+		return nil
+	}
+}
+
+// moves the return address of an exit to the first spill register and branches to the tail taking it
+func (f *frame) emitSlip(p *profile, as *asm, exit string) {
+	spills := p.spillRegisters()
+	r, ok := f.loadValue(p, as, exitValue(exit), 0)
+	if !ok || len(spills) == 0 {
+		f.errorf(codeUnresolved, "Unable to resolve exit %s, it is not declared", exit)
+		return
+	}
+	// the frame size isn't known until the function is complete, so exits share a tail emitted at the end
+	if r.index != spills[0].index {
+		as.emit(p.find("add", "dni").set("dni", spills[0].index, r.index, 0))
+	}
+	f.stack.slips = append(f.stack.slips, len(as.instructions))
+	as.emit(0)
+}
+
+// names the exit taken by the accesses which follow when they're out of bounds eg. bounds: exhausted.
+// indexes of buffers beyond their length, and reads and writes without an else finding a stream exhausted or full
+type boundsNode struct {
+	exit string
+}
+
+func (n *boundsNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		if !contains(f.declaredInputs(), exitValue(n.exit)) {
+			f.errorf(codeUnresolved, "Unable to resolve exit %s, it is not declared", n.exit)
+			return nil
+		}
+		f.stack.bounds = n.exit
+		return nil
+	}
+}
+
+// takes the bounds exit when the condition holds, otherwise branching over it. the access is described by what
+func (f *frame) emitBoundsCheck(p *profile, as *asm, cond int, what string) {
+	if f.stack.bounds == "" {
+		f.errorf(codeBounds, "%s is bounds checked, declare the exit taken when it's out of bounds with bounds: <exit>", what)
+		return
+	}
+	skip := len(as.instructions)
+	as.emit(0)
+	f.emitSlip(p, as, f.stack.bounds)
+	as.instructions[skip] = p.find("b.c", "ci").set("ci", cond^1, len(as.instructions)-skip)
+}
+
+// emits the tail taken by slips, which frees the frame and branches to the return address of the exit
+func (f *frame) emitSlipTail(p *profile, as *asm, name string) {
+	if len(f.stack.slips) == 0 {
+		return
+	}
+	as.addSymbol("slip_"+name, false)
+	for _, b := range f.stack.slips {
+		as.instructions[b] = p.find("b", "i").set("i", len(as.instructions)-b)
+	}
+	f.emitEpilogue(p, as)
+	as.emit(p.findReg("br", p.spillRegisters()[0].index))
+}
+
+// handles an exit of the function called by the enclosing call eg. notFound: { ... }
+type handlerNode struct {
+	exit string
+}
+
+func (n *handlerNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		site := f.call
+		if site == nil {
+			return nil // the call is in error
+		}
+		// the previous handler, or the return from the call, continues after the handlers
+		site.branches = append(site.branches, len(as.instructions))
+		as.emit(0)
+		site.handlers[n.exit] = len(as.instructions)
+		site.restore(f, p, as)
+		return nil
+	}
+}
+
+// a call being emitted, whose exits return to handlers emitted after it
+type callSite struct {
+	saved    []register // registers saved across the call
+	slots    []int
+	live     []bool         // the saved registers restored after the call, holding values used later
+	handlers map[string]int // exits to the index of their handler
+	branches []int          // indexes of branches to the end of the handlers
+	exits    []exitAddress
+	returned int // the index the call returns to
+}
+
+// the address of a handler passed for an exit, encoded once the handlers have been emitted
+type exitAddress struct {
+	exit     string
+	index    int
+	register register
+}
+
+// encodes the exit addresses and the branches to the end of the handlers. exits without a handler return as
+// the call does
+func (c *callSite) patch(f *frame, p *profile, as *asm) {
+	end := len(as.instructions)
+	for _, b := range c.branches {
+		as.instructions[b] = p.find("b", "i").set("i", end-b)
+	}
+	for _, e := range c.exits {
+		target, ok := c.handlers[e.exit]
+		if !ok {
+			target = c.returned
+		}
+		as.instructions[e.index] = adr(p, e.register, e.index, target)
+	}
+}
+
+// restores the saved registers still live, as each path from the call must
+func (c *callSite) restore(f *frame, p *profile, as *asm) {
+	sp := p.findStackRegister()
+	pr := p.layout(pointerPrimative)
+	for i, r := range c.saved {
+		if c.live[i] {
+			f.emitLoad(p, as, savedPrimative(p, r), sp.index, f.stack.offset(c.slots[i], pr.size), r)
+		}
+	}
+}
+
+// address of an instruction, relative to the adr at index
+func adr(p *profile, rd register, index int, target int) uint32 {
+	offset := (target - index) * 4
+	return p.find("adr", "dil").set("dil", rd.index, offset>>2, offset&3)
+}
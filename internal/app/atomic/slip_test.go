@@ -0,0 +1,115 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// exits arrive in the registers after the inputs. slipping to one branches through it from the function's tail,
+// and callers pass the addresses of their handlers, resuming after the call for exits without one
+func TestSlip(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: ops { find *find check *check }
+type: key { k int }
+type: o { r int }
+function: find {
+    > key
+    > o
+    exit: notFound
+    exit: found
+    + o { r <- key.k }
+    slip: found
+}
+function: check {
+    > key
+    exit: invalid
+    slip: invalid
+}
+function: f {
+    > ops
+    > key
+    > o
+    call: ops.find(key, o) {
+        notFound: { + o { r <- 0 } }
+        found: { + o { r <- 1 } }
+    }
+}
+function: g {
+    > ops
+    > key
+    call: ops.check(key)
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"find", []string{
+			"find:",
+			"ldrsw i=0 n=0 t=8", "str.w i=0 n=1 t=8",
+			"add d=16 i=0 n=3", "b i=2", // found, the second exit, is in x3
+			"exit_find:", "ret n=30",
+			"slip_find:", "br n=16", "padding", "padding",
+		}},
+		{"f", []string{
+			"f:",
+			"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=16 n=31",
+			"str i=0 n=31 t=2",
+			"ldr i=0 n=0 t=17", "add d=0 i=0 n=1", "add d=1 i=0 n=2",
+			"adr d=2 i=5 l=0", "adr d=3 i=8 l=0", // the handlers of notFound and found
+			"blr n=17",
+			"ldr i=0 n=31 t=2", "b i=8",
+			"ldr i=0 n=31 t=2", "movz d=9 h=0 i=0", "str.w i=0 n=2 t=9", "b i=4",
+			"ldr i=0 n=31 t=2", "movz d=9 h=0 i=1", "str.w i=0 n=2 t=9",
+			"exit_f:",
+			"add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31",
+			"ldr i=1 n=0 t=17", "add d=0 i=0 n=1", // ops.check at 8
+			"adr d=1 i=2 l=0", // invalid resumes after the call
+			"blr n=17",
+			"exit_g:",
+			"add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30",
+			"padding", "padding", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlipErrors(t *testing.T) {
+	got := compileDiagnostics(t, `package: t
+type: ops { find *find }
+type: key { k int }
+function: find {
+    > key
+    exit: notFound
+    exit: notFound
+    slip: lost
+}
+function: f {
+    > ops
+    > key
+    call: ops.find(key) {
+        lost: { }
+    }
+    slip: notFound
+}
+`)
+	want := []string{
+		"A201 7:5 Exit notFound is already declared",
+		"A202 8:5 Unable to resolve exit lost, it is not declared",
+		"A202 13:5 Function find has no exit lost",
+		"A202 16:5 Unable to resolve exit notFound, it is not declared",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+package atomic
+
+// the stack frame of a function, holding spilled values and the callee saved registers it uses.
+// the arguments of calls passed on the stack are at the bottom of the frame, followed by the spill slots,
+// then the saved registers
+type stackFrame struct {
+	outgoing  int                 // slots for the arguments and exits of calls passed on the stack
+	slots     int                 // spill slots allocated
+	spilled   map[string]int      // values to their spill slot
+	entry     map[int]register    // registers stored to spill slots on entry
+	calls     bool                // the function calls others, so its return address must be saved
+	callSlots []int               // slots holding registers saved across calls, reused by each call
+	late      []string            // inputs spilled after they may have been used from their registers
+	counted   []string            // loops whose bodies were too large to unroll, which hold a counter
+	saved     []register          // callee saved registers used by the function
+	reserved  map[string]register // parameter registers of inputs
+	arguments map[string]int      // inputs passed on the stack, to their index in the caller's argument area
+	patches   []argumentLoad
+	slips     []int  // indexes of branches to the tail taking an exit
+	bounds    string // the exit taken by accesses out of bounds
+}
+
+// a load of an input from the caller's argument area, which is above this function's frame
+type argumentLoad struct {
+	index    int
+	register register
+	argument int
+}
+
+func newStackFrame() *stackFrame {
+	return &stackFrame{
+		spilled:   map[string]int{},
+		entry:     map[int]register{},
+		reserved:  map[string]register{},
+		arguments: map[string]int{},
+	}
+}
+
+func (s *stackFrame) save(r register) {
+	for _, sr := range s.saved {
+		if sr.name == r.name {
+			return
+		}
+	}
+	s.saved = append(s.saved, r)
+}
+
+func (s *stackFrame) spill(name string, r register) {
+	s.spilled[name] = s.slots
+	s.entry[s.slots] = r
+	s.slots++
+}
+
+// the offset of a slot from the stack pointer, above the arguments passed to calls
+func (s *stackFrame) offset(slot int, size int) int {
+	return (s.outgoing + slot) * size
+}
+
+// returns slots for saving registers across a call, allocating more when a call saves more than any before it
+func (s *stackFrame) saveSlots(n int) []int {
+	s.calls = true
+	for len(s.callSlots) < n {
+		s.callSlots = append(s.callSlots, s.slots)
+		s.slots++
+	}
+	return s.callSlots[:n]
+}
+
+// records the slips and argument loads of the instructions from start copied to the end at index, as the body
+// of a loop is unrolled, so the copies are encoded with them
+func (s *stackFrame) copied(start int, n int, index int) {
+	for _, b := range s.slips {
+		if b >= start && b < start+n {
+			s.slips = append(s.slips, index+b-start)
+		}
+	}
+	for _, patch := range s.patches {
+		if patch.index >= start && patch.index < start+n {
+			patch.index += index - start
+			s.patches = append(s.patches, patch)
+		}
+	}
+}
+
+// moves the slips and argument loads from index on, as instructions are inserted before them
+func (s *stackFrame) moved(index int, n int) {
+	for i, b := range s.slips {
+		if b >= index {
+			s.slips[i] += n
+		}
+	}
+	for i := range s.patches {
+		if s.patches[i].index >= index {
+			s.patches[i].index += n
+		}
+	}
+}
+
+// frame records are a pair of the caller's frame pointer and the return address
+const frameRecordSize = 16
+
+// true if the function needs a frame, to save registers, hold spilled values or preserve its return address
+func (s *stackFrame) needed() bool {
+	return s.slots > 0 || len(s.saved) > 0 || s.calls
+}
+
+// the size of the frame below the frame record, keeping the stack pointer 16 byte aligned as the abi requires
+func (s *stackFrame) size(p *profile) int {
+	return alignUp((s.outgoing+s.slots+len(s.saved))*p.layout(pointerPrimative).size, 16)
+}
+
+// inserts the prologue at the start of the function, once it is complete and the frame size is known.
+// the frame record is pushed and the frame pointer set to it, chaining frames so debuggers and profilers can
+// unwind, then the frame is allocated below it for spilled values and callee saved registers
+func (f *frame) emitPrologue(p *profile, as *asm, start int) {
+	s := f.stack
+	size := s.size(p)
+	sp := p.findStackRegister()
+	pr := p.layout(pointerPrimative)
+	above := 0 // from the stack pointer to the caller's argument area
+	if s.needed() {
+		above = size + frameRecordSize
+	}
+	for _, patch := range s.patches {
+		as.instructions[patch.index] = f.load(p, pr, sp.index, above+patch.argument*pr.size, patch.register)
+	}
+	if !s.needed() {
+		return
+	}
+
+	fp := p.findFrameRegister()
+	prologue := []uint32{
+		p.find("stp.pre", "intu").set("intu", -frameRecordSize/pr.size, sp.index, fp.index, p.findLinkRegister().index),
+		p.find("add", "dni").set("dni", fp.index, sp.index, 0),
+	}
+	if size > 0 {
+		prologue = append(prologue, p.find("sub", "dni").set("dni", sp.index, sp.index, f.frameImmediate(size)))
+	}
+	prologue = append(prologue, f.savedRegisters(p, "stp", "str")...)
+	for slot := 0; slot < s.slots; slot++ {
+		if r, ok := s.entry[slot]; ok {
+			prologue = append(prologue, f.store(p, pr, sp.index, s.offset(slot, pr.size), r))
+		}
+	}
+	as.insert(start, prologue...)
+}
+
+// restores callee saved registers, frees the frame and pops the frame record
+func (f *frame) emitEpilogue(p *profile, as *asm) {
+	s := f.stack
+	if !s.needed() {
+		return
+	}
+	sp := p.findStackRegister()
+	fp := p.findFrameRegister()
+	pr := p.layout(pointerPrimative)
+	for _, ins := range f.savedRegisters(p, "ldp", "ldr") {
+		as.emit(ins)
+	}
+	as.emit(p.find("add", "dni").set("dni", sp.index, fp.index, 0))
+	as.emit(p.find("ldp.post", "intu").set("intu", frameRecordSize/pr.size, sp.index, fp.index, p.findLinkRegister().index))
+}
+
+// stores or loads the callee saved registers above the spill slots, in pairs where they can be
+func (f *frame) savedRegisters(p *profile, pair string, single string) []uint32 {
+	s := f.stack
+	sp := p.findStackRegister()
+	size := p.layout(pointerPrimative).size
+	var ins []uint32
+	for i := 0; i < len(s.saved); i++ {
+		r := s.saved[i]
+		offset := s.offset(s.slots+i, size)
+		if i+1 < len(s.saved) && s.saved[i+1].float == r.float && offset/size <= 63 {
+			pi := p.find(pair, "intu")
+			if r.float {
+				pi = p.findFloat(pair, "intu")
+			}
+			ins = append(ins, pi.set("intu", offset/size, sp.index, r.index, s.saved[i+1].index))
+			i++
+			continue
+		}
+		pr := savedPrimative(p, r)
+		if single == "str" {
+			ins = append(ins, f.store(p, pr, sp.index, offset, r))
+		} else {
+			ins = append(ins, f.load(p, pr, sp.index, offset, r))
+		}
+	}
+	return ins
+}
+
+// the lower 64 bits of callee saved floating point registers are preserved
+func savedPrimative(p *profile, r register) primative {
+	if r.float {
+		pr, _ := p.primative("double")
+		return pr
+	}
+	return p.layout(pointerPrimative)
+}
+
+func (f *frame) frameImmediate(size int) int {
+	if size > 0xfff {
+		f.errorf(codeOffset, "Stack frame of %d bytes is too large", size)
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,111 @@
+package atomic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// leaf functions have no frame. functions making calls save the frame and link registers, chaining the frame
+// pointer, and keep the stack pointer 16 byte aligned below the slots of registers saved across the call
+func TestCallFrames(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: ops { g *g }
+type: o { r int }
+function: g {
+    > o
+    + o { r <- 1 }
+}
+function: f {
+    > ops
+    > o
+    call: ops.g(o)
+    + o { r <- 2 }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"g", []string{
+			"g:",
+			"movz d=9 h=0 i=1", "str.w i=0 n=0 t=9",
+			"exit_g:", "ret n=30", "padding",
+		}},
+		{"f", []string{
+			"f:",
+			"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=16 n=31",
+			"str i=0 n=31 t=1", // o is saved across the call
+			"ldr i=0 n=0 t=17", "add d=0 i=0 n=1", "blr n=17",
+			"ldr i=0 n=31 t=1",
+			"movz d=9 h=0 i=2", "str.w i=0 n=1 t=9",
+			"exit_f:",
+			"add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30",
+			"padding", "padding", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// callee saved registers are saved below the frame record and restored on exit, leaving x18 on darwin
+func TestDarwinFrame(t *testing.T) {
+	v := func(i int) int64 { return int64(i*i*7 + 3) }
+	leaf := 0
+	expr, want := balancedExpression(11, &leaf, v)
+	r := Compile([]Source{{Filename: "test.atomic", Data: []byte(expressionSource(expr))}},
+		Options{Profile: testProfileFor(t, "darwin"), Concurrency: 1})
+	if errors := compileErrors(r); len(errors) > 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+	instructions := functionInstructions(r.Files[0].Listing, "f")
+
+	prologue := []string{
+		"_f:",
+		"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=48 n=31",
+		"stp i=0 n=31 t=19 u=20", "stp i=2 n=31 t=21 u=22", "str i=4 n=31 t=23",
+	}
+	epilogue := []string{
+		"exit_f:",
+		"ldp i=0 n=31 t=19 u=20", "ldp i=2 n=31 t=21 u=22", "ldr i=4 n=31 t=23",
+		"add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30",
+	}
+	if got := instructions[:len(prologue)]; !reflect.DeepEqual(got, prologue) {
+		t.Errorf("got prologue %q, want %q", got, prologue)
+	}
+	exit := len(instructions) - len(epilogue) - 3 // padding
+	if got := instructions[exit : exit+len(epilogue)]; !reflect.DeepEqual(got, epilogue) {
+		t.Errorf("got epilogue %q, want %q", got, epilogue)
+	}
+	for _, ins := range instructions {
+		for _, operand := range []string{"a", "d", "m", "n", "t", "u"} {
+			if strings.Contains(ins+" ", " "+operand+"=18 ") {
+				t.Errorf("x18 used by %s", ins)
+			}
+		}
+	}
+
+	var inputs []int64
+	memory := map[int64]int64{}
+	for i := 1; i <= 9; i++ {
+		inputs = append(inputs, int64(i)*0x100)
+		memory[int64(i)*0x100] = v(i)
+	}
+	x := runInstructions(t, instructions, inputs, memory)
+	if got := memory[0x900]; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+	for r := 19; r <= 30; r++ {
+		if x[r] != int64(0x7700+r) {
+			t.Errorf("x%d is %#x on return", r, x[r])
+		}
+	}
+	if x[31] != entrySP {
+		t.Errorf("sp is %#x on return", x[31])
+	}
+}
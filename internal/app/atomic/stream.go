@@ -0,0 +1,583 @@
+package atomic
+
+import (
+	"math/bits"
+	"strings"
+)
+
+// reads the next element of a stream into an input or a field of one, or writes the next element from one eg.
+// read: booking.legs -> leg else: { ... } or write: pass.code -> out.codes
+// the statements of the else run when a read finds the stream exhausted, or a write finds it full
+type streamNode struct {
+	write bool
+	input string // the input holding the stream
+	path  string // the stream field of the input
+	value string // an input of the element's struct, or input.field converting to or from the element
+}
+
+// the descriptor of a stream backed by a callback, struct atomic_stream in headers. reads take elements from the
+// base while its length lasts, writes put them there while its capacity lasts. once they run out the refill is
+// called with the descriptor, to read or flush elements and set the base, length and capacity again
+const (
+	streamBase     = 0
+	streamLength   = 8
+	streamCapacity = 16
+	streamRefill   = 24
+	streamSize     = 32
+)
+
+// a fixed buffer stream holds the number of elements written and the position of the next read, then the elements
+const (
+	bufferLength   = 0
+	bufferPosition = 8
+	bufferHeader   = 16
+)
+
+// returns the size and alignment of a stream of elements of the given size and alignment. a descriptor if it has
+// no capacity, otherwise a fixed buffer
+func streamLayout(size int, align int, capacity int) (int, int) {
+	if capacity == 0 {
+		return streamSize, 8
+	}
+	elements := alignUp(bufferHeader, align)
+	if align < 8 {
+		align = 8
+	}
+	return alignUp(elements+capacity*size, align), align
+}
+
+// the elements of a stream, a struct or a primative possibly of an enum
+type streamElement struct {
+	typ   string
+	prim  primative
+	enum  string
+	size  int
+	align int
+}
+
+// resolves the element type of a stream field
+func (f *frame) streamElement(p *profile, fp fieldPath) streamElement {
+	if s, ok := f.ref.structs[fp.element]; ok {
+		return streamElement{typ: s.name, size: s.size, align: s.alignment}
+	}
+	if e, ok := f.ref.enums[fp.element]; ok {
+		return streamElement{prim: e.prim, enum: e.name, size: e.prim.size, align: e.prim.align}
+	}
+	pr, _ := p.primative(fp.element)
+	return streamElement{prim: pr, size: pr.size, align: pr.align}
+}
+
+// the input or field an element is read into or written from
+type streamValue struct {
+	input string
+	field fieldPath
+	whole bool // the input itself, rather than a field of it
+	conv  conversion
+}
+
+// the else of a read or write is run as that of a when, an empty one is dropped
+func (n *streamNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	for _, s := range a.sub {
+		if _, ok := s.node.(*elseNode); ok && len(s.sub) == 0 {
+			a.sub = nil
+		}
+	}
+	otherwise := len(a.sub) > 0
+	return func(f *frame, p *profile, as *asm) func() {
+		parent := f.when
+		site := &whenSite{
+			skip:      -1,
+			exit:      -1,
+			otherwise: -1,
+		}
+		f.emitStream(p, as, n, site, otherwise)
+		if !otherwise {
+			site.patch(p, as)
+			return nil
+		}
+		f.when = site
+		return func() {
+			site.patch(p, as)
+			f.when = parent
+		}
+	}
+}
+
+// resolves the stream field of the input
+func (f *frame) streamField(n *streamNode, d *diagnostics) (fieldPath, bool) {
+	s, ok := f.ref.structs[n.input]
+	if !ok {
+		d.errorf(codeUnresolved, f.span, "Unable to resolve %s, it is not an input", n.input)
+		return fieldPath{}, false
+	}
+	fp, ok := f.ref.lookup(s, n.path, d, f.span)
+	if ok && !fp.stream {
+		d.errorf(codeType, f.span, "Field %s.%s %s is not a stream", n.input, n.path, typeName(fp))
+		return fieldPath{}, false
+	}
+	if ok && fp.buffer && fp.counter.size == 0 {
+		return fieldPath{}, false // the length of the buffer failed to resolve, which was reported
+	}
+	return fp, ok
+}
+
+// resolves the value an element is read into or written from, checking it holds the element
+func (f *frame) streamValue(n *streamNode, fp fieldPath, e streamElement) (streamValue, bool) {
+	split := strings.SplitN(n.value, ".", 2)
+	v := streamValue{
+		input: split[0],
+		whole: len(split) == 1,
+	}
+	s, ok := f.ref.structs[v.input]
+	if !ok {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", v.input)
+		return v, false
+	}
+	if !v.whole {
+		if v.field, ok = f.ref.lookup(s, split[1], f.diags, f.span); !ok {
+			return v, false
+		}
+	}
+	switch {
+	case e.typ != "" && v.whole && s.name == e.typ:
+		return v, true
+	case e.typ != "" && !v.whole && v.field.nested && v.field.typ == e.typ && v.field.length == 0 && !v.field.stream:
+		return v, true
+	case e.typ != "":
+		f.errorf(codeType, "Elements of %s.%s %s can not be held by %s, which is not a %s",
+			n.input, n.path, typeName(fp), n.value, e.typ)
+		return v, false
+	case v.whole:
+		f.errorf(codeType, "Elements of %s.%s %s are held by a field, not the input %s",
+			n.input, n.path, typeName(fp), n.value)
+		return v, false
+	}
+	element := v.elementField(fp, e)
+	if n.write {
+		v.conv, ok = f.checkConversion(f.span, populateSource{name: v.input, field: v.field}, n.input, element, false)
+	} else {
+		v.conv, ok = f.checkConversion(f.span, populateSource{name: n.input, field: element}, v.input, v.field, false)
+	}
+	return v, ok
+}
+
+// a primative element, as a field at the offset of the elements from the element's address
+func (v streamValue) elementField(fp fieldPath, e streamElement) fieldPath {
+	return fieldPath{
+		path:   fp.path,
+		name:   fp.name,
+		prim:   e.prim,
+		enum:   e.enum,
+		offset: elementsOffset(fp, e),
+	}
+}
+
+// the offset of the elements from the address of the next one, which for a fixed buffer is computed from its address
+func elementsOffset(fp fieldPath, e streamElement) int {
+	if fp.capacity == 0 {
+		return 0
+	}
+	return alignUp(bufferHeader, e.align)
+}
+
+// the name of the values holding the address of a stream and its cursor
+func streamKey(input string, path string) string {
+	return "stream " + input + "." + path
+}
+
+// emits a read or write of the next element. the address of the stream and its cursor are loaded and stored back,
+// unless a loop holds them in registers. a read which finds the stream exhausted, or a write which finds it full,
+// branches to the else, takes the bounds exit if there's no else and one is named, otherwise skips the element.
+// without an else the check is omitted when compiling unchecked, or once a loop has checked the stream for its reads
+func (f *frame) emitStream(p *profile, as *asm, n *streamNode, site *whenSite, otherwise bool) {
+	fp, ok := f.streamField(n, f.diags)
+	if !ok {
+		return
+	}
+	e := f.streamElement(p, fp)
+	v, ok := f.streamValue(n, fp, e)
+	if !ok {
+		return
+	}
+
+	key := streamKey(n.input, n.path)
+	held := false
+	if _, ok := f.valueRegister(key); ok {
+		held = true
+	} else if !f.loadStream(p, as, n.input, fp, n.write) {
+		return
+	}
+	stream, _ := f.valueRegister(key)
+	cursor, _ := f.valueRegister(key + " cursor")
+	check := streamCheck{
+		checked: otherwise || !(f.ref.unchecked || f.checkedStreams[key]),
+		exit:    !otherwise && f.stack.bounds != "",
+		what:    "Read of " + n.input + "." + n.path,
+	}
+	if n.write {
+		check.what = "Write to " + n.input + "." + n.path
+	}
+	zr := p.findStackRegister().index
+
+	if fp.capacity == 0 {
+		// the cursor of a descriptor or buffer is the address of the next element, its count decrements as it advances
+		count, _ := f.valueRegister(key + " count")
+		if fp.buffer && check.checked {
+			as.emit(p.find("subs", "dni").set("dni", zr, count.index, 0))
+			f.emitExhausted(p, as, site, condLE, check)
+		} else if !fp.buffer {
+			f.emitRefill(p, as, n.input, fp, n.write, site, check)
+		}
+		f.emitElement(p, as, n, fp, e, v, cursor.index)
+		as.emit(p.find("add", "dni").set("dni", cursor.index, cursor.index, e.size))
+		as.emit(p.find("sub", "dni").set("dni", count.index, count.index, 1))
+	} else {
+		element, _ := f.registerForValue(p, "stream element")
+		switch {
+		case !check.checked:
+		case n.write && fp.capacity <= 0xfff:
+			as.emit(p.find("subs", "dni").set("dni", zr, cursor.index, fp.capacity))
+		case n.write:
+			for _, ins := range moveImmediate(p, element, uint64(fp.capacity)) {
+				as.emit(ins)
+			}
+			as.emit(p.find("subs", "dmns").set("dmns", zr, element.index, cursor.index, 0))
+		default:
+			f.emitLoad(p, as, p.layout(pointerPrimative), stream.index, bufferLength, element)
+			as.emit(p.find("subs", "dmns").set("dmns", zr, element.index, cursor.index, 0))
+		}
+		if check.checked {
+			f.emitExhausted(p, as, site, condHS, check)
+		}
+		// the element is at the elements offset from the stream plus the cursor scaled by the size of the elements
+		if e.size&(e.size-1) == 0 {
+			as.emit(p.find("add", "dmns").set("dmns", element.index, cursor.index, stream.index,
+				bits.TrailingZeros(uint(e.size))))
+		} else {
+			size, _ := f.registerForValue(p, "element size")
+			for _, ins := range moveImmediate(p, size, uint64(e.size)) {
+				as.emit(ins)
+			}
+			as.emit(p.find("madd", "dmna").set("dmna", element.index, size.index, cursor.index, stream.index))
+			f.releaseValue("element size")
+		}
+		f.emitElement(p, as, n, fp, e, v, element.index)
+		as.emit(p.find("add", "dni").set("dni", cursor.index, cursor.index, 1))
+		f.releaseValue("stream element")
+	}
+	if !held {
+		f.storeStream(p, as, n.input, fp, n.write)
+	}
+}
+
+// how a read or write handles a stream which is exhausted or full
+type streamCheck struct {
+	checked bool   // the check is made
+	exit    bool   // the bounds exit is taken, rather than the else or skipping the element
+	what    string // the access, for diagnostics
+}
+
+// branches when the condition finds a stream exhausted or full, to the else or past the element, or to the bounds exit
+func (f *frame) emitExhausted(p *profile, as *asm, site *whenSite, cond int, check streamCheck) {
+	if check.exit {
+		f.emitBoundsCheck(p, as, cond, check.what)
+		return
+	}
+	site.cond = cond
+	site.skip = len(as.instructions)
+	as.emit(0)
+}
+
+// loads the address of a stream and its cursor into registers, returning false if the input can't be resolved.
+// the cursor of a descriptor or buffer is its base with the count of elements, that of a fixed buffer the position
+// of a read or length of a write. the address of a buffer is that of the struct holding its pointer and length
+func (f *frame) loadStream(p *profile, as *asm, input string, fp fieldPath, write bool) bool {
+	key := streamKey(input, fp.path)
+	base, ok := f.loadValue(p, as, input, 1)
+	if !ok {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", input)
+		return false
+	}
+	stream, _ := f.registerForValue(p, key)
+	b := f.emitDerefs(p, as, fp, base.index, stream)
+	f.emitOffsetAddress(p, as, b, streamOrigin(fp), stream)
+	cursor, _ := f.registerForValue(p, key+" cursor")
+	pr := p.layout(pointerPrimative)
+	if fp.capacity > 0 {
+		f.emitLoad(p, as, pr, stream.index, cursorOffset(fp, write), cursor)
+		return true
+	}
+	count, _ := f.registerForValue(p, key+" count")
+	f.emitLoad(p, as, countPrimative(p, fp), stream.index, cursorOffset(fp, write), count)
+	f.emitLoad(p, as, pr, stream.index, baseOffset(fp), cursor)
+	return true
+}
+
+// stores the cursor of a stream back to it, releasing the registers holding it
+func (f *frame) storeStream(p *profile, as *asm, input string, fp fieldPath, write bool) {
+	key := streamKey(input, fp.path)
+	stream, _ := f.valueRegister(key)
+	cursor, _ := f.valueRegister(key + " cursor")
+	pr := p.layout(pointerPrimative)
+	if fp.capacity > 0 {
+		f.emitStore(p, as, pr, stream.index, cursorOffset(fp, write), cursor)
+	} else {
+		count, _ := f.valueRegister(key + " count")
+		f.emitStore(p, as, pr, stream.index, baseOffset(fp), cursor)
+		f.emitStore(p, as, countPrimative(p, fp), stream.index, cursorOffset(fp, write), count)
+		f.releaseValue(key + " count")
+	}
+	f.releaseValue(key + " cursor")
+	f.releaseValue(key)
+}
+
+// the offset of a stream from the base of its field, a buffer is reached from the struct holding it
+func streamOrigin(fp fieldPath) int {
+	if fp.buffer {
+		return 0
+	}
+	return fp.offset
+}
+
+// the offset of the pointer to the next element of a descriptor or buffer
+func baseOffset(fp fieldPath) int {
+	if fp.buffer {
+		return fp.offset
+	}
+	return streamBase
+}
+
+// the offset of the count a read or write of a stream decrements, or of the cursor of a fixed buffer it increments
+func cursorOffset(fp fieldPath, write bool) int {
+	switch {
+	case fp.buffer:
+		return fp.count
+	case fp.capacity > 0 && write:
+		return bufferLength
+	case fp.capacity > 0:
+		return bufferPosition
+	case write:
+		return streamCapacity
+	}
+	return streamLength
+}
+
+// the primative of the count of a descriptor or buffer
+func countPrimative(p *profile, fp fieldPath) primative {
+	if fp.buffer {
+		return fp.counter
+	}
+	return p.layout(pointerPrimative)
+}
+
+// once the count of a descriptor reaches zero its refill is called, if it has one, then the count is checked again.
+// the scratch registers are saved across the call, the cursor is stored for it and reloaded
+func (f *frame) emitRefill(p *profile, as *asm, input string, fp fieldPath, write bool, site *whenSite, check streamCheck) {
+	key := streamKey(input, fp.path)
+	stream, _ := f.valueRegister(key)
+	cursor, _ := f.valueRegister(key + " cursor")
+	count, _ := f.valueRegister(key + " count")
+	pr := p.layout(pointerPrimative)
+	refill := p.spillRegisters()[1]
+
+	ready := len(as.instructions)
+	as.emit(0)
+	f.emitLoad(p, as, pr, stream.index, streamRefill, refill)
+	none := len(as.instructions)
+	as.emit(0)
+	call := f.saveScratch(p, as, nil, true)
+	f.emitStore(p, as, pr, stream.index, streamBase, cursor)
+	f.emitStore(p, as, pr, stream.index, cursorOffset(fp, write), count)
+	if arg := p.paramRegisters()[0]; arg.index != stream.index {
+		as.emit(p.find("add", "dni").set("dni", arg.index, stream.index, 0))
+	}
+	as.emit(p.findReg("blr", refill.index))
+	call.restore(f, p, as)
+	f.emitLoad(p, as, pr, stream.index, cursorOffset(fp, write), count)
+	f.emitLoad(p, as, pr, stream.index, streamBase, cursor)
+	as.instructions[none] = p.find("cbz", "ti").set("ti", refill.index, len(as.instructions)-none)
+
+	if check.checked {
+		zr := p.findStackRegister().index
+		as.emit(p.find("subs", "dni").set("dni", zr, count.index, 0))
+		f.emitExhausted(p, as, site, condEQ, check)
+	}
+	as.instructions[ready] = p.find("cbnz", "ti").set("ti", count.index, len(as.instructions)-ready)
+}
+
+// copies an element at the address in the register elem to or from the value
+func (f *frame) emitElement(p *profile, as *asm, n *streamNode, fp fieldPath, e streamElement, v streamValue, elem int) {
+	base, ok := f.loadValue(p, as, v.input, 0)
+	if !ok {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", v.input)
+		return
+	}
+	tmp, _ := f.registerForValue(p, "tmp")
+	defer f.releaseValue("tmp")
+	b, offset := base.index, 0
+	if !v.whole && v.field.computed() {
+		value, _ := f.registerForValue(p, "stream value")
+		defer f.releaseValue("stream value")
+		b = f.emitDerefs(p, as, v.field, base.index, value)
+	}
+	if !v.whole {
+		offset = v.field.offset
+	}
+
+	if e.typ != "" {
+		if n.write {
+			f.emitCopy(p, as, e.size, b, offset, elem, elementsOffset(fp, e), tmp)
+		} else {
+			f.emitCopy(p, as, e.size, elem, elementsOffset(fp, e), b, offset, tmp)
+		}
+		return
+	}
+	ftmp, _ := f.floatRegisterForValue(p, "ftmp")
+	defer f.releaseValue("ftmp")
+	element := v.elementField(fp, e)
+	if n.write {
+		f.emitConversion(p, as, v.conv, v.field, b, element, elem, tmp, ftmp)
+	} else {
+		f.emitConversion(p, as, v.conv, element, elem, v.field, b, tmp, ftmp)
+	}
+}
+
+// the integer primatives copying a struct, largest first
+var copyPrimatives = []string{"long", "int", "short", "byte"}
+
+// copies bytes from one base register + offset to another through rt, in the largest accesses which the offsets
+// of both are aligned to
+func (f *frame) emitCopy(p *profile, as *asm, size int, from int, fromOffset int, to int, toOffset int, rt register) {
+	for off := 0; off < size; {
+		for _, name := range copyPrimatives {
+			pr, _ := p.primative(name)
+			if pr.size > size-off || (fromOffset+off)%pr.size != 0 || (toOffset+off)%pr.size != 0 {
+				continue
+			}
+			f.emitLoad(p, as, pr, from, fromOffset+off, rt)
+			f.emitStore(p, as, pr, to, toOffset+off, rt)
+			off += pr.size
+			break
+		}
+	}
+}
+
+// returns the inputs a read or write uses, for computing their live ranges before emission
+func (n *streamNode) uses() []string {
+	value := strings.SplitN(n.value, ".", 2)
+	uses := append([]string{n.input, value[0]}, indexInputs(n.path)...)
+	if len(value) > 1 {
+		uses = append(uses, indexInputs(value[1])...)
+	}
+	return uses
+}
+
+// a stream a loop may hold, with the elements each iteration reads or writes if they all do so unconditionally
+type heldStream struct {
+	node     streamNode
+	elements int
+}
+
+// returns the streams a loop may hold the address and cursor of in registers across its iterations. those it only
+// reads or only writes, not through an index, when its body makes no call or slip which could reach them, nor
+// exits with the cursor in a register
+func heldStreams(a *ast) []heldStream {
+	var streams []heldStream
+	ways := map[string]map[bool]bool{}
+	elements := map[string]int{}
+	reached := false
+	var walk func(a *ast, factor int, conditional bool)
+	walk = func(a *ast, factor int, conditional bool) {
+		for i := range a.sub {
+			s := &a.sub[i]
+			switch n := s.node.(type) {
+			case *callNode, *slipNode, *exitNode:
+				reached = true
+			case *streamNode:
+				key := streamKey(n.input, n.path)
+				if ways[key] == nil {
+					ways[key] = map[bool]bool{}
+					streams = append(streams, heldStream{node: *n})
+				}
+				ways[key][n.write] = true
+				if conditional || len(s.sub) > 0 || elements[key] < 0 {
+					elements[key] = -1 // a read with an else, or one which may not be made, can't be counted
+				} else {
+					elements[key] += factor
+				}
+			case *loopNode:
+				walk(s, factor*n.count, conditional)
+				continue
+			case *scopeNode:
+				walk(s, factor, conditional)
+				continue
+			}
+			walk(s, factor, true)
+		}
+	}
+	walk(a, 1, false)
+	if reached {
+		return nil
+	}
+	var held []heldStream
+	for _, s := range streams {
+		key := streamKey(s.node.input, s.node.path)
+		if len(ways[key]) == 1 && !strings.Contains(s.node.path, "[") {
+			if elements[key] > 0 {
+				s.elements = elements[key]
+			}
+			held = append(held, s)
+		}
+	}
+	return held
+}
+
+// loads the streams a loop holds before its first iteration, returning those it holds. streams already held
+// by an enclosing loop, or whose input isn't declared yet, are left to each read or write. a buffer whose reads
+// or writes are all made on every iteration is checked once for the elements of every iteration, rather than
+// by each, taking the bounds exit before the first iteration if it's short
+func (f *frame) holdStreams(p *profile, as *asm, streams []heldStream, iterations int) []heldStream {
+	var held []heldStream
+	for _, s := range streams {
+		n := s.node
+		key := streamKey(n.input, n.path)
+		if _, ok := f.valueRegister(key); ok || !f.hasValue(n.input) {
+			continue
+		}
+		fp, ok := f.streamField(&n, &diagnostics{}) // errors are reported by the read or write
+		if !ok || !f.loadStream(p, as, n.input, fp, n.write) {
+			continue
+		}
+		held = append(held, s)
+		if !fp.buffer || s.elements == 0 || f.ref.unchecked || f.stack.bounds == "" {
+			continue
+		}
+		count, _ := f.valueRegister(key + " count")
+		zr := p.findStackRegister().index
+		if need := s.elements * iterations; need <= 0xfff {
+			as.emit(p.find("subs", "dni").set("dni", zr, count.index, need))
+		} else {
+			r, _ := f.registerForValue(p, "stream elements")
+			for _, ins := range moveImmediate(p, r, uint64(need)) {
+				as.emit(ins)
+			}
+			as.emit(p.find("subs", "dmns").set("dmns", zr, r.index, count.index, 0))
+			f.releaseValue("stream elements")
+		}
+		f.emitBoundsCheck(p, as, condLT, "Reads and writes of "+n.input+"."+n.path)
+		if f.checkedStreams == nil {
+			f.checkedStreams = map[string]bool{}
+		}
+		f.checkedStreams[key] = true
+	}
+	return held
+}
+
+// stores the cursors of the streams a loop held once it's complete
+func (f *frame) releaseStreams(p *profile, as *asm, held []heldStream) {
+	for _, s := range held {
+		fp, _ := f.streamField(&s.node, &diagnostics{})
+		f.storeStream(p, as, s.node.input, fp, s.node.write)
+		delete(f.checkedStreams, streamKey(s.node.input, s.node.path))
+	}
+}
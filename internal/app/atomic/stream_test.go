@@ -0,0 +1,123 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+const streamSource = `package: t
+type: leg { from short to short }
+type: booking { legs stream leg codes stream [4]byte }
+type: pass { code byte }
+`
+
+// reads and writes of descriptors and fixed buffers, checked against their length or capacity
+func TestStreams(t *testing.T) {
+	source := streamSource + `function: f {
+    > booking
+    > leg
+    read: booking.legs -> leg
+}
+function: g {
+    > pass
+    > booking
+    write: pass.code -> booking.codes
+}
+function: h {
+    > booking
+    > pass
+    read: booking.codes -> pass.code else: {
+        + pass { code <- 9 }
+    }
+}
+function: k {
+    > booking
+    > pass
+    loop: 3 {
+        write: pass.code -> booking.codes
+    }
+}
+`
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"stp.pre i=126 n=31 t=29 u=30", "add d=29 i=0 n=31", "sub d=31 i=48 n=31",
+			"add d=8 i=0 n=0", "ldr i=1 n=8 t=10", "ldr i=0 n=8 t=9", // the length, then the base
+			"cbnz i=21 t=10", "ldr i=3 n=8 t=17", "cbz i=17 t=17", // refilled once exhausted, if it has a refill
+			"str i=0 n=31 t=0", "str i=1 n=31 t=1", "str i=2 n=31 t=8", "str i=3 n=31 t=9", "str i=4 n=31 t=10",
+			"str i=0 n=8 t=9", "str i=1 n=8 t=10", "add d=0 i=0 n=8", "blr n=17",
+			"ldr i=0 n=31 t=0", "ldr i=1 n=31 t=1", "ldr i=2 n=31 t=8", "ldr i=3 n=31 t=9", "ldr i=4 n=31 t=10",
+			"ldr i=1 n=8 t=10", "ldr i=0 n=8 t=9",
+			"subs d=31 i=0 n=10", "b.c c=0 i=7", // still exhausted, the element is skipped
+			"ldrsw i=0 n=9 t=11", "str.w i=0 n=1 t=11",
+			"add d=9 i=4 n=9", "sub d=10 i=1 n=10",
+			"str i=0 n=8 t=9", "str i=1 n=8 t=10",
+			"exit_f:", "add d=31 i=0 n=29", "ldp.post i=2 n=31 t=29 u=30", "ret n=30",
+		}},
+		{"g", []string{
+			"g:",
+			"add d=8 i=32 n=1", "ldr i=0 n=8 t=9",
+			"subs d=31 i=4 n=9", "b.c c=2 i=6", // full at the capacity
+			"add d=10 m=9 n=8 s=0", "ldrb i=0 n=0 t=11", "strb i=16 n=10 t=11",
+			"add d=9 i=1 n=9", "str i=0 n=8 t=9",
+			"exit_g:", "ret n=30", "padding", "padding",
+		}},
+		{"h", []string{
+			"h:",
+			"add d=8 i=32 n=0", "ldr i=1 n=8 t=9", "ldr i=0 n=8 t=10",
+			"subs d=31 m=10 n=9 s=0", "b.c c=2 i=7", // exhausted at the length written
+			"add d=10 m=9 n=8 s=0", "ldrb i=16 n=10 t=11", "strb i=0 n=1 t=11",
+			"add d=9 i=1 n=9", "str i=1 n=8 t=9",
+			"b i=3", "movz d=9 h=0 i=9", "strb i=0 n=1 t=9",
+			"exit_h:", "ret n=30", "padding", "padding",
+		}},
+		{"k", []string{
+			"k:",
+			"add d=8 i=32 n=0", "ldr i=0 n=8 t=9", // held across the iterations
+			"subs d=31 i=4 n=9", "b.c c=2 i=5", "add d=10 m=9 n=8 s=0",
+			"ldrb i=0 n=1 t=11", "strb i=16 n=10 t=11", "add d=9 i=1 n=9",
+			"subs d=31 i=4 n=9", "b.c c=2 i=5", "add d=10 m=9 n=8 s=0",
+			"ldrb i=0 n=1 t=11", "strb i=16 n=10 t=11", "add d=9 i=1 n=9",
+			"subs d=31 i=4 n=9", "b.c c=2 i=5", "add d=10 m=9 n=8 s=0",
+			"ldrb i=0 n=1 t=11", "strb i=16 n=10 t=11", "add d=9 i=1 n=9",
+			"str i=0 n=8 t=9",
+			"exit_k:", "ret n=30", "padding", "padding",
+		}},
+	}
+	listing := compileListing(t, source)
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	source := streamSource + `function: f {
+    > booking
+    > pass
+    read: booking.legs -> pass
+    read: booking.legs -> pass.code
+    write: booking.legs -> booking.codes
+    read: booking.missing -> pass.code
+    read: pass.code -> pass.code
+    read: other.legs -> pass.code
+}
+`
+	want := []string{
+		"A204 8:5 Elements of booking.legs stream leg can not be held by pass, which is not a leg",
+		"A204 9:5 Elements of booking.legs stream leg can not be held by pass.code, which is not a leg",
+		"A204 10:5 Can not populate booking.codes byte from booking.legs stream leg",
+		"A202 11:5 Type booking has no field missing",
+		"A204 12:5 Field pass.code byte is not a stream",
+		"A202 13:5 Unable to resolve other, it is not an input",
+	}
+	if got := diagnosticStrings(compileErrors(compileSource(t, source))); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,286 @@
+package atomic
+
+import (
+	"sort"
+	"strings"
+)
+
+// the most arms a switch compares the tag with in turn, more branch through a table
+const maxSwitchChain = 3
+
+// a variant is declared as a struct holding one of its member structs after a tag naming which
+// eg. variant: payment { card cash voucher }. members are named by their types, and tagged in declaration order
+
+// lays out the tag, then every member at the same offset, aligned to the most aligned member. the variant is the
+// size of its largest member plus the tag, padded to its alignment as C pads a struct holding a tag and a union
+func (r reference) layoutVariant(p *profile, name string, state map[string]int, d *diagnostics) {
+	s := r.structs[name]
+	tag, _ := p.primative("int")
+	s.fields = append(s.fields[:0], field{name: "tag", prim: tag, size: tag.size})
+	size, alignment := 0, tag.align
+	for _, fa := range r.declarations[name].sub {
+		fn, ok := fa.node.(*fieldNode)
+		if !ok {
+			continue
+		}
+		if _, dupe := s.member(fn.typ); dupe || fn.typ == "tag" {
+			d.errorf(codeDuplicate, fa.span, "Variant %s already has a member %s", name, fn.typ)
+			continue
+		}
+		if _, ok := r.structs[fn.typ]; !ok {
+			d.errorf(codeUnknownType, fa.span, "Member %s of variant %s is not a struct type", fn.typ, name)
+			continue
+		}
+		if !r.layoutStruct(p, fn.typ, state, d) {
+			d.errorf(codeRecursive, fa.span, "Variant %s contains itself through member %s", name, fn.typ)
+			continue
+		}
+		m := r.structs[fn.typ]
+		s.fields = append(s.fields, field{name: fn.typ, typ: fn.typ, size: m.size})
+		if m.size > size {
+			size = m.size
+		}
+		if m.alignment > alignment {
+			alignment = m.alignment
+		}
+	}
+	off := alignUp(tag.size, alignment)
+	for i := range s.fields[1:] {
+		s.fields[i+1].offset = off
+	}
+	s.alignment = alignment
+	s.size = alignUp(off+size, alignment)
+}
+
+// returns a member of a variant, and its tag
+func (s *structNode) member(name string) (field, bool) {
+	for _, f := range s.fields[1:] {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// returns the tag of a member, its index after the tag field
+func (s *structNode) memberTag(name string) int {
+	for i, f := range s.fields[1:] {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// returns a field of a struct held at an offset within another field, reached through the same pointers and indexes
+func (fp fieldPath) within(outer fieldPath, offset int) fieldPath {
+	if len(fp.derefs) > 0 {
+		fp.derefs = append([]int{}, fp.derefs...)
+		fp.derefs[0] += outer.offset + offset
+	} else {
+		fp.offset += outer.offset + offset
+	}
+	fp.derefs = append(append([]int{}, outer.derefs...), fp.derefs...)
+	indexes := append([]arrayIndex{}, outer.indexes...)
+	for _, ix := range fp.indexes {
+		ix.derefs += len(outer.derefs)
+		indexes = append(indexes, ix)
+	}
+	fp.indexes = indexes
+	return fp
+}
+
+// resolves the variant at a path within an input, or the input itself if the path is empty, as a field
+// holding it from the base of the input
+func (f *frame) variantField(input string, path string) (fieldPath, *structNode, bool) {
+	s, ok := f.ref.structs[input]
+	if !ok || !f.hasValue(input) {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", input)
+		return fieldPath{}, nil, false
+	}
+	fp := fieldPath{typ: input, nested: true}
+	if path != "" {
+		if fp, ok = f.ref.lookup(s, path, f.diags, f.span); !ok {
+			return fp, nil, false
+		}
+	}
+	v := f.ref.structs[fp.typ]
+	if !fp.nested || fp.length > 0 || fp.stream || v == nil || !v.variant {
+		f.errorf(codeType, "%s is not a variant", strings.TrimSuffix(input+"."+path, "."))
+		return fp, nil, false
+	}
+	return fp, v, true
+}
+
+// populates the member of a variant eg. + booking.pay.card { number <- pass.card }, as a struct held within the
+// variant, then tags the variant with the member
+func (f *frame) variantTarget(n *populateNode) (*structNode, fieldPath, int, bool) {
+	if s, ok := f.ref.structs[n.name]; ok {
+		if fp, ok := f.ref.lookup(s, n.path, &diagnostics{}, f.span); ok && f.ref.structs[fp.typ] != nil &&
+			f.ref.structs[fp.typ].variant {
+			f.errorf(codeType, "Variant %s.%s is populated by one of its members eg. + %s.%s.member",
+				n.name, n.path, n.name, n.path)
+			return nil, fieldPath{}, 0, false
+		}
+	}
+	path, member := "", n.path
+	if i := strings.LastIndex(n.path, "."); i >= 0 {
+		path, member = n.path[:i], n.path[i+1:]
+	}
+	outer, v, ok := f.variantField(n.name, path)
+	if !ok {
+		return nil, fieldPath{}, 0, false
+	}
+	m, ok := v.member(member)
+	if !ok {
+		f.errorf(codeUnresolved, "Variant %s has no member %s", v.name, member)
+		return nil, fieldPath{}, 0, false
+	}
+	return f.ref.structs[m.typ], outer, m.offset, true
+}
+
+// stores the tag of a member populated, once its fields are
+func (f *frame) emitTag(p *profile, as *asm, n *populateNode, outer fieldPath, base register, tmp register) {
+	v := f.ref.structs[outer.typ]
+	tag := fieldPath{path: "tag", name: "tag", prim: v.fields[0].prim}.within(outer, 0)
+	for _, ins := range moveImmediate(p, tmp, uint64(v.memberTag(n.path[strings.LastIndex(n.path, ".")+1:]))) {
+		as.emit(ins)
+	}
+	f.emitFieldStore(p, as, tag, f.targetBase(p, as, tag, base), tmp)
+	f.releaseValue("target")
+}
+
+// dispatches on the member a variant holds eg. switch: booking.pay { card: { ... } cash: { ... } default: { ... } }.
+// each arm reaches its member by the member's name, as an input holding its address. the tag is compared with
+// those of a few arms in turn, or indexes a table of branches to them as a case does
+type switchNode struct {
+	input string
+	path  string // of the variant within the input, or empty if the input is the variant
+}
+
+// an arm of a switch, taken when the variant holds its member
+type switchArmNode struct {
+	member    string
+	otherwise bool // the default arm
+}
+
+func (n *switchNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	seen := map[string]bool{}
+	for _, s := range a.sub {
+		arm := s.node.(*switchArmNode)
+		name := arm.member
+		if arm.otherwise {
+			name = "default"
+		}
+		if seen[name] {
+			d.errorf(codeDuplicate, s.span, "Switch already has an arm for %s", name)
+		}
+		seen[name] = true
+	}
+	return func(f *frame, p *profile, as *asm) func() {
+		parent := f.dispatch
+		site, ok := f.emitSwitch(p, as, n, a)
+		f.dispatch = site
+		if !ok {
+			f.dispatch = nil // the arms are still emitted, there is nothing to branch to them
+		}
+		return func() {
+			if ok {
+				site.patch(p, as)
+			}
+			f.dispatch = parent
+		}
+	}
+}
+
+func (n *switchArmNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		site := f.dispatch
+		if site == nil || site.variant == nil {
+			return nil
+		}
+		if site.started {
+			// the previous arm continues after the switch
+			site.branches = append(site.branches, len(as.instructions))
+			as.emit(0)
+		}
+		site.started = true
+		if n.otherwise {
+			site.otherwise = len(as.instructions)
+			return nil
+		}
+		tag := site.variant.memberTag(n.member)
+		site.arms[tag] = len(as.instructions)
+		return f.bindMember(p, as, site, n.member)
+	}
+}
+
+// holds the address of the member an arm is taken for in a register named by the member, declared as an input
+// until the arm is complete
+func (f *frame) bindMember(p *profile, as *asm, site *caseSite, member string) func() {
+	m, _ := site.variant.member(member)
+	r, _ := f.registerForValue(p, member)
+	base, ok := f.loadValue(p, as, site.input, 0)
+	if r.name == "" || !ok {
+		return nil
+	}
+	b := f.emitDerefs(p, as, site.field, base.index, r)
+	f.emitOffsetAddress(p, as, b, site.field.offset+m.offset, r)
+	inputs := f.inputs
+	f.inputs = append(f.inputs, member)
+	return func() {
+		f.inputs = inputs
+		f.releaseValue(member)
+	}
+}
+
+// loads the tag of the variant and branches to the arm of its member, or to the default
+func (f *frame) emitSwitch(p *profile, as *asm, n *switchNode, a *ast) (*caseSite, bool) {
+	fp, v, ok := f.variantField(n.input, n.path)
+	if !ok {
+		return nil, false
+	}
+	var tags []int
+	for _, s := range a.sub {
+		arm := s.node.(*switchArmNode)
+		if arm.otherwise {
+			continue
+		}
+		if _, ok := v.member(arm.member); !ok {
+			f.diags.errorf(codeUnresolved, s.span, "Variant %s has no member %s", v.name, arm.member)
+			return nil, false
+		}
+		if contains(f.declaredInputs(), arm.member) || contains(f.live.inputs, arm.member) {
+			f.diags.errorf(codeDuplicate, s.span, "Arm %s of the switch on %s hides the input %s", arm.member,
+				strings.TrimSuffix(n.input+"."+n.path, "."), arm.member)
+			return nil, false
+		}
+		tags = append(tags, v.memberTag(arm.member))
+	}
+	sort.Ints(tags)
+	tag := "tag"
+	if n.path != "" {
+		tag = n.path + ".tag"
+	}
+
+	var site *caseSite
+	if len(tags) > maxSwitchChain {
+		site, ok = f.emitDispatch(p, as, &caseNode{input: n.input, path: tag, min: tags[0], max: tags[len(tags)-1]})
+		if !ok {
+			return nil, false
+		}
+	} else {
+		site = &caseSite{
+			arms:      map[int]int{},
+			otherwise: -1,
+		}
+		spills := p.spillRegisters()
+		base, _ := f.loadValue(p, as, n.input, 0)
+		tf, _ := f.ref.lookup(f.ref.structs[n.input], tag, f.diags, f.span)
+		b := f.emitDerefs(p, as, tf, base.index, spills[0])
+		f.emitFieldLoad(p, as, tf, b, spills[0])
+		f.emitChain(p, as, site, spills[0], spills[1], tags)
+	}
+	site.variant, site.input, site.field = v, n.input, fp
+	return site, true
+}
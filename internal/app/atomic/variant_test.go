@@ -0,0 +1,159 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// members are populated in place then tagged, and switches compare the tag in turn or branch through a table
+func TestVariants(t *testing.T) {
+	source := `package: t
+type: card { number long cvv short }
+type: cash { amount int }
+type: voucher { code byte }
+variant: payment { card cash voucher }
+type: booking { id int pay payment }
+type: pass { number long amount int }
+type: a { x int }
+type: b { y int }
+type: c { z int }
+type: d { w int }
+variant: v { a b c d }
+type: out { n int }
+function: f {
+    > pass
+    > booking
+    + booking.pay.card { number <- pass.number cvv <- 7 }
+}
+function: g {
+    > booking
+    > pass
+    switch: booking.pay {
+        card: {
+            + pass { number <- card.number amount <- 1 }
+        }
+        cash: {
+            + pass { number <- 0 amount <- cash.amount }
+        }
+        default: {
+            + pass { number <- 0 amount <- 0 }
+        }
+    }
+}
+function: h {
+    > v
+    > out
+    switch: v {
+        a: {
+            + out { n <- a.x }
+        }
+        b: {
+            + out { n <- b.y }
+        }
+        c: {
+            + out { n <- c.z }
+        }
+        d: {
+            + out { n <- d.w }
+        }
+    }
+}
+`
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldr i=0 n=0 t=8", "str i=2 n=1 t=8", // the member follows the tag, at 8 within the variant at 8
+			"movz d=9 h=0 i=7", "strh i=12 n=1 t=9",
+			"movz d=8 h=0 i=0", "str.w i=2 n=1 t=8", // tagged as card
+			"exit_f:", "ret n=30", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrsw i=2 n=0 t=16",
+			"subs d=31 i=0 n=16", "b.c c=0 i=4", "subs d=31 i=1 n=16", "b.c c=0 i=8", "b i=13",
+			"add d=8 i=16 n=0", "ldr i=0 n=8 t=9", "str i=0 n=1 t=9", "movz d=10 h=0 i=1", "str.w i=2 n=1 t=10", "b i=11",
+			"add d=8 i=16 n=0", "movz d=10 h=0 i=0", "str i=0 n=1 t=10", "ldrsw i=0 n=8 t=9", "str.w i=2 n=1 t=9", "b i=5",
+			"movz d=9 h=0 i=0", "str i=0 n=1 t=9", "movz d=9 h=0 i=0", "str.w i=2 n=1 t=9",
+			"exit_g:", "ret n=30", "padding",
+		}},
+		{"h", []string{
+			"h:",
+			"ldrsw i=0 n=0 t=16", "subs d=31 i=3 n=16", "b.c c=8 i=23",
+			"adr d=17 i=3 l=0", "add d=17 m=16 n=17 s=2", "br n=17",
+			"b i=4", "b i=7", "b i=10", "b i=13",
+			"add d=8 i=4 n=0", "ldrsw i=0 n=8 t=9", "str.w i=0 n=1 t=9", "b i=12",
+			"add d=8 i=4 n=0", "ldrsw i=0 n=8 t=9", "str.w i=0 n=1 t=9", "b i=8",
+			"add d=8 i=4 n=0", "ldrsw i=0 n=8 t=9", "str.w i=0 n=1 t=9", "b i=4",
+			"add d=8 i=4 n=0", "ldrsw i=0 n=8 t=9", "str.w i=0 n=1 t=9",
+			"exit_h:", "ret n=30", "padding", "padding",
+		}},
+	}
+	listing := compileListing(t, source)
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariantErrors(t *testing.T) {
+	source := `package: t
+type: card { number long }
+type: cash { amount int }
+type: pass { number long }
+variant: payment { card cash card tag int }
+variant: self { self }
+variant: held { pass cash }
+type: booking { id int pay payment held held }
+function: f {
+    > pass
+    > booking
+    + booking.pay { number <- pass.number }
+    + booking.pay.coin { number <- pass.number }
+    + booking.id.card { number <- pass.number }
+}
+function: g {
+    > booking
+    > pass
+    switch: booking.pay {
+        card: {
+        }
+        card: {
+        }
+    }
+    switch: booking.pay {
+        coin: {
+        }
+    }
+    switch: booking.held {
+        pass: {
+        }
+    }
+    switch: booking.id {
+        card: {
+        }
+    }
+}
+`
+	want := []string{
+		"A201 5:30 Variant payment already has a member card",
+		"A201 5:35 Variant payment already has a member tag",
+		"A200 5:39 Member int of variant payment is not a struct type",
+		"A203 6:17 Variant self contains itself through member self",
+		"A204 12:5 Variant booking.pay is populated by one of its members eg. + booking.pay.member",
+		"A202 13:5 Variant payment has no member coin",
+		"A204 14:5 booking.id is not a variant",
+		"A201 22:9 Switch already has an arm for card",
+		"A202 26:9 Variant payment has no member coin",
+		"A201 30:9 Arm pass of the switch on booking.held hides the input pass",
+		"A204 33:5 booking.id is not a variant",
+	}
+	if got := diagnosticStrings(compileErrors(compileSource(t, source))); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,486 @@
+package atomic
+
+import (
+	"math"
+	"strconv"
+)
+
+// runs its statements when a condition holds, otherwise those of its else eg.
+// when: booking.seatClass >= 2 && pass.gate != 0 { ... } else: { ... }
+// conditions which are constant are folded as the ast is resolved
+type whenNode struct {
+	terms []comparison
+	join  string // && or ||, joining the terms
+}
+
+// the statements run when the condition holds
+type thenNode struct {
+}
+
+// the statements run when the condition does not hold
+type elseNode struct {
+}
+
+// compares a field with another field or a literal
+type comparison struct {
+	left  operand
+	op    string // == != < <= > >=
+	right operand
+}
+
+// a field of an input, or a literal number, true or false
+type operand struct {
+	input   string
+	path    string
+	literal string
+}
+
+// operators with their operands swapped, so a literal may be compared with a field
+var mirrored = map[string]string{"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// condition codes of the comparison operators for integers, and floats where unordered operands compare false
+// other than for !=
+var signedConditions = map[string]int{"==": condEQ, "!=": condNE, "<": condLT, "<=": condLE, ">": condGT, ">=": condGE}
+var unsignedConditions = map[string]int{"==": condEQ, "!=": condNE, "<": condLO, "<=": condLS, ">": condHI, ">=": condHS}
+var floatConditions = map[string]int{"==": condEQ, "!=": condNE, "<": condMI, "<=": condLS, ">": condGT, ">=": condGE}
+
+func (n *whenNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	var then, otherwise []ast
+	for _, s := range a.sub {
+		switch s.node.(type) {
+		case *thenNode:
+			then = s.sub
+		case *elseNode:
+			otherwise = s.sub
+		}
+	}
+	if holds, known := n.fold(d, a.span); known {
+		// constant conditions are replaced by the statements they would run
+		a.sub = otherwise
+		if holds {
+			a.sub = then
+		}
+		if len(a.sub) == 0 {
+			a.node = nil
+			return nil
+		}
+		scope := &scopeNode{}
+		a.node = scope
+		scope.resolve(a, d)
+		return nil
+	}
+	if len(then) == 0 && len(otherwise) == 0 {
+		a.node = nil
+		return nil
+	}
+	return func(f *frame, p *profile, as *asm) func() {
+		parent := f.when
+		site := &whenSite{
+			skip:      -1,
+			exit:      -1,
+			otherwise: -1,
+		}
+		if cond, ok := f.emitCondition(p, as, n); ok {
+			site.cond = cond ^ 1 // conditions pair with their inverse by the low bit
+			site.skip = len(as.instructions)
+			as.emit(0)
+		}
+		f.when = site
+		return func() {
+			site.patch(p, as)
+			f.when = parent
+		}
+	}
+}
+
+func (n *thenNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return nil
+}
+
+func (n *elseNode) resolve(a *ast, d *diagnostics) func(f *frame, p *profile, as *asm) func() {
+	return func(f *frame, p *profile, as *asm) func() {
+		site := f.when
+		// the statements run when the condition holds continue after the else
+		site.exit = len(as.instructions)
+		as.emit(0)
+		site.otherwise = len(as.instructions)
+		return nil
+	}
+}
+
+// a when being emitted, whose branches are encoded once its statements have been
+type whenSite struct {
+	cond      int // the condition skipping the statements run when the condition holds
+	skip      int // index of the branch to the else, or the end, -1 if the condition is in error
+	exit      int // index of the branch from the end of the statements to the end of the else
+	otherwise int // index of the else
+}
+
+func (w *whenSite) patch(p *profile, as *asm) {
+	end := len(as.instructions)
+	if w.exit >= 0 {
+		as.instructions[w.exit] = p.find("b", "i").set("i", end-w.exit)
+	}
+	if w.skip >= 0 {
+		target := end
+		if w.otherwise >= 0 {
+			target = w.otherwise
+		}
+		as.instructions[w.skip] = p.find("b.c", "ci").set("ci", w.cond, target-w.skip)
+	}
+}
+
+// folds terms comparing literals, returning whether the condition holds if all the terms were folded or one
+// decides the condition
+func (n *whenNode) fold(d *diagnostics, at span) (bool, bool) {
+	deciding := n.join == "||" // a term which holds decides an or, one which doesn't decides an and
+	var terms []comparison
+	for _, t := range n.terms {
+		if t.left.literal == "" || t.right.literal == "" {
+			terms = append(terms, t)
+			continue
+		}
+		holds, ok := compareLiterals(t)
+		if !ok {
+			d.errorf(codeType, at, "Can not compare %s %s %s", t.left.literal, t.op, t.right.literal)
+			terms = append(terms, t)
+			continue
+		}
+		if holds == deciding {
+			return holds, true
+		}
+	}
+	n.terms = terms
+	if len(terms) == 0 {
+		return !deciding, true
+	}
+	return false, false
+}
+
+func compareLiterals(t comparison) (bool, bool) {
+	l, r := t.left.literal, t.right.literal
+	if l == "true" || l == "false" || r == "true" || r == "false" {
+		if (l != "true" && l != "false") || (r != "true" && r != "false") || (t.op != "==" && t.op != "!=") {
+			return false, false
+		}
+		return (l == r) == (t.op == "=="), true
+	}
+	c := 0
+	li, lerr := parseInteger(l)
+	ri, rerr := parseInteger(r)
+	if lerr == nil && rerr == nil {
+		c = compareInts(li, ri)
+	} else {
+		lf, lerr := strconv.ParseFloat(l, 64)
+		rf, rerr := strconv.ParseFloat(r, 64)
+		if lerr != nil || rerr != nil {
+			return false, false
+		}
+		c = compareFloats(lf, rf)
+	}
+	switch t.op {
+	case "==":
+		return c == 0, true
+	case "!=":
+		return c != 0, true
+	case "<":
+		return c < 0, true
+	case "<=":
+		return c <= 0, true
+	case ">":
+		return c > 0, true
+	}
+	return c >= 0, true
+}
+
+func compareInts(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// a comparison resolved against the fields it compares
+type resolvedComparison struct {
+	left    operand
+	field   fieldPath
+	right   operand
+	other   fieldPath // the right field, unless it is a literal
+	literal uint64    // the right literal, as an integer or the bits of a double
+	float   bool
+	cond    int // the condition which holds when the comparison does
+}
+
+// resolves both operands of a comparison, putting a field on the left
+func (f *frame) resolveComparison(t comparison) (resolvedComparison, bool) {
+	// members of enums compare as their values, with the enum of the field
+	var enums [2]string
+	for i, o := range []*operand{&t.left, &t.right} {
+		e, v, ok := f.enumMember(o.input, o.path, f.span)
+		if e == nil {
+			continue
+		}
+		if !ok {
+			return resolvedComparison{}, false
+		}
+		enums[i] = e.name
+		*o = operand{literal: strconv.FormatInt(v, 10)}
+	}
+	if t.left.literal != "" && t.right.literal != "" {
+		f.errorf(codeType, "Comparison of %s with %s is constant", t.left.literal, t.right.literal)
+		return resolvedComparison{}, false
+	}
+	if t.left.literal != "" {
+		t.left, t.right = t.right, t.left
+		t.op = mirrored[t.op]
+		enums[0], enums[1] = enums[1], enums[0]
+	}
+	rc := resolvedComparison{
+		left:  t.left,
+		right: t.right,
+	}
+	var ok bool
+	if rc.field, ok = f.operandField(t.left); !ok {
+		return rc, false
+	}
+	fp := rc.field
+	rc.float = fp.prim.float
+	if t.right.literal == "" {
+		if rc.other, ok = f.operandField(t.right); !ok {
+			return rc, false
+		}
+		if typeKind(fp) != typeKind(rc.other) || (fp.typ != "" && fp.typ != rc.other.typ) || fp.enum != rc.other.enum {
+			f.errorf(codeType, "Can not compare %s.%s %s with %s.%s %s",
+				t.left.input, t.left.path, typeName(fp), t.right.input, t.right.path, typeName(rc.other))
+			return rc, false
+		}
+	} else if rc.literal, ok = literalBits(fp, t.right.literal); !ok {
+		f.errorf(codeType, "Can not compare %s.%s %s with %s", t.left.input, t.left.path, typeName(fp), t.right.literal)
+		return rc, false
+	} else if enums[1] != "" && enums[1] != fp.enum {
+		f.errorf(codeType, "Can not compare %s.%s %s with a member of %s", t.left.input, t.left.path, typeName(fp), enums[1])
+		return rc, false
+	} else if e, ok := f.ref.enums[fp.enum]; ok && !e.isMember(t.right.literal) {
+		f.errorf(codeType, "Can not compare %s.%s %s with %s, which is not a member", t.left.input, t.left.path,
+			typeName(fp), t.right.literal)
+		return rc, false
+	}
+
+	conditions := signedConditions
+	switch {
+	case rc.float:
+		conditions = floatConditions
+	case !fp.prim.integer && (t.op != "==" && t.op != "!="):
+		f.errorf(codeType, "%s.%s %s can only be compared for equality", t.left.input, t.left.path, typeName(fp))
+		return rc, false
+	case !fp.prim.signed && (rc.right.literal != "" || !rc.other.prim.signed):
+		conditions = unsignedConditions // loads extend to 64 bits, so a signed operand compares both as signed
+	}
+	rc.cond = conditions[t.op]
+	return rc, true
+}
+
+func (f *frame) operandField(o operand) (fieldPath, bool) {
+	s, ok := f.ref.structs[o.input]
+	if !ok || !f.hasValue(o.input) {
+		f.errorf(codeUnresolved, "Unable to resolve %s, it is not an input", o.input)
+		return fieldPath{}, false
+	}
+	fp, ok := f.ref.lookup(s, o.path, f.diags, f.span)
+	if !ok {
+		return fieldPath{}, false
+	}
+	if kind := typeKind(fp); kind != "pointer" && kind != "float" && kind != "integer" && kind != "bool" {
+		f.errorf(codeType, "Can not compare %s.%s %s", o.input, o.path, typeName(fp))
+		return fieldPath{}, false
+	}
+	return fp, true
+}
+
+// the kinds of types which compare with each other
+func typeKind(fp fieldPath) string {
+	switch {
+	case fp.typ != "":
+		return "pointer"
+	case fp.prim.float:
+		return "float"
+	case fp.prim.integer:
+		return "integer"
+	}
+	return fp.prim.name
+}
+
+// converts a literal to the representation of a field
+func literalBits(fp fieldPath, literal string) (uint64, bool) {
+	switch typeKind(fp) {
+	case "float":
+		v, err := strconv.ParseFloat(literal, 64)
+		return math.Float64bits(v), err == nil
+	case "integer":
+		v, err := parseInteger(literal)
+		return uint64(v), err == nil
+	case "bool":
+		if literal == "true" {
+			return 1, true
+		}
+		return 0, literal == "false"
+	case "pointer":
+		return 0, literal == "0" // only the null pointer
+	}
+	return 0, false
+}
+
+// emits the comparisons of a condition, chaining them with conditional compares, returning the condition which
+// holds when the whole condition does
+func (f *frame) emitCondition(p *profile, as *asm, n *whenNode) (int, bool) {
+	terms := make([]resolvedComparison, 0, len(n.terms))
+	ok := true
+	for _, t := range n.terms {
+		rc, valid := f.resolveComparison(t)
+		terms = append(terms, rc)
+		ok = ok && valid
+	}
+	spills := p.spillRegisters()
+	if len(spills) < 2 {
+		f.errorf(codeRegister, "No spill registers for when")
+		ok = false
+	}
+	if !ok {
+		return 0, false
+	}
+
+	var fl, fr register
+	for _, t := range terms {
+		if t.float && fl.name == "" {
+			fl, _ = f.floatRegisterForValue(p, "when left")
+			fr, _ = f.floatRegisterForValue(p, "when right")
+			defer f.releaseValue("when left")
+			defer f.releaseValue("when right")
+		}
+	}
+	left, right := spills[0], spills[1]
+	zr := p.findStackRegister().index // the zero register, discarding the result of a compare, shares its encoding
+
+	cond := -1
+	for _, t := range terms {
+		f.emitOperand(p, as, t.left, t.field, left, fl, 0)
+		immediate := !t.float && t.right.literal != "" && t.literal <= 0xfff
+		if cond >= 0 {
+			immediate = immediate && t.literal <= 0x1f
+		}
+		if t.right.literal == "" {
+			f.emitOperand(p, as, t.right, t.other, right, fr, 1)
+		} else if t.float {
+			for _, ins := range moveDouble(p, right, fr, t.literal) {
+				as.emit(ins)
+			}
+		} else if !immediate {
+			for _, ins := range moveImmediate(p, right, t.literal) {
+				as.emit(ins)
+			}
+		}
+
+		if cond < 0 {
+			switch {
+			case t.float:
+				as.emit(p.findFloat("fcmp", "mn").set("mn", fr.index, fl.index))
+			case immediate:
+				as.emit(p.find("subs", "dni").set("dni", zr, left.index, int(t.literal)))
+			default:
+				as.emit(p.find("subs", "dmns").set("dmns", zr, right.index, left.index, 0))
+			}
+			cond = t.cond
+			continue
+		}
+
+		// an and only compares when the previous terms held, otherwise setting flags which fail this term.
+		// an or only compares when they failed, otherwise setting flags which hold
+		when := cond
+		if n.join == "||" {
+			when = cond ^ 1
+		}
+		nzcv := flagsFor(t.cond, n.join == "||")
+		switch {
+		case t.float:
+			as.emit(p.findFloat("fccmp", "cfmn").set("cfmn", when, nzcv, fr.index, fl.index))
+		case immediate:
+			as.emit(p.find("ccmp", "cfin").set("cfin", when, nzcv, int(t.literal), left.index))
+		default:
+			as.emit(p.find("ccmp", "cfmn").set("cfmn", when, nzcv, right.index, left.index))
+		}
+		cond = t.cond
+	}
+	return cond, true
+}
+
+// loads an operand into a spill register, or the float register for doubles
+func (f *frame) emitOperand(p *profile, as *asm, o operand, fp fieldPath, rt register, ft register, spill int) {
+	base, _ := f.loadValue(p, as, o.input, spill)
+	b := f.emitDerefs(p, as, fp, base.index, rt)
+	if fp.prim.float {
+		rt = ft
+	}
+	f.emitFieldLoad(p, as, fp, b, rt)
+}
+
+// returns flags for which the condition holds, or fails
+func flagsFor(cond int, holds bool) int {
+	for nzcv := 0; nzcv < 16; nzcv++ {
+		if conditionHolds(cond, nzcv) == holds {
+			return nzcv
+		}
+	}
+	return 0
+}
+
+// evaluates a condition code against the n, z, c and v flags
+func conditionHolds(cond int, nzcv int) bool {
+	n, z, c, v := nzcv&8 != 0, nzcv&4 != 0, nzcv&2 != 0, nzcv&1 != 0
+	var holds bool
+	switch cond &^ 1 {
+	case condEQ:
+		holds = z
+	case condHS:
+		holds = c
+	case condMI:
+		holds = n
+	case condVS:
+		holds = v
+	case condHI:
+		holds = c && !z
+	case condGE:
+		holds = n == v
+	case condGT:
+		holds = !z && n == v
+	}
+	if cond&1 != 0 {
+		return !holds
+	}
+	return holds
+}
+
+// returns the inputs a when reads, for computing their live ranges before emission
+func (n *whenNode) uses() []string {
+	var uses []string
+	for _, t := range n.terms {
+		for _, o := range []operand{t.left, t.right} {
+			if o.literal == "" {
+				uses = append(append(uses, o.input), indexInputs(o.path)...)
+			}
+		}
+	}
+	return uses
+}
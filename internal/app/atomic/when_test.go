@@ -0,0 +1,90 @@
+package atomic
+
+import (
+	"reflect"
+	"testing"
+)
+
+// conditions branch over the block when false, chaining further comparisons with ccmp, and constant
+// conditions fold away
+func TestWhen(t *testing.T) {
+	listing := compileListing(t, `package: t
+type: o { a int b byte d double r int }
+function: f {
+    > o
+    when: o.a < 3 { + o { r <- 1 } } else: { + o { r <- 2 } }
+}
+function: g {
+    > o
+    when: o.b >= o.a && o.d != 1.5 { + o { r <- 1 } }
+}
+function: h {
+    > o
+    when: 1 < 2 { + o { r <- 1 } } else: { + o { r <- 2 } }
+    when: o.b < 200 || o.a == -1 { + o { r <- 3 } }
+}
+`)
+	tests := []struct {
+		function string
+		want     []string
+	}{
+		{"f", []string{
+			"f:",
+			"ldrsw i=0 n=0 t=16", "subs d=31 i=3 n=16", "b.c c=10 i=4", // ge to the else
+			"movz d=9 h=0 i=1", "str.w i=4 n=0 t=9", "b i=3",
+			"movz d=9 h=0 i=2", "str.w i=4 n=0 t=9",
+			"exit_f:", "ret n=30", "padding", "padding", "padding",
+		}},
+		{"g", []string{
+			"g:",
+			"ldrb i=4 n=0 t=16", "ldrsw i=0 n=0 t=17", "subs d=31 m=17 n=16 s=0",
+			"ldr i=1 n=0 t=16", "fmov d=17 i=120", // 1.5
+			"fccmp c=10 f=4 m=17 n=16", // when ge compare the doubles, otherwise set equal
+			"b.c c=0 i=3",
+			"movz d=9 h=0 i=1", "str.w i=4 n=0 t=9",
+			"exit_g:", "ret n=30", "padding", "padding",
+		}},
+		{"h", []string{
+			"h:",
+			"movz d=9 h=0 i=1", "str.w i=4 n=0 t=9", // 1 < 2 keeps only its block
+			"ldrb i=4 n=0 t=16", "subs d=31 i=200 n=16",
+			"ldrsw i=0 n=0 t=16", "movn d=17 h=0 i=0",
+			"ccmp c=2 f=4 m=17 n=16", // when hs, bytes being unsigned, compare o.a with -1, otherwise set equal
+			"b.c c=1 i=3",
+			"movz d=9 h=0 i=3", "str.w i=4 n=0 t=9",
+			"exit_h:", "ret n=30", "padding",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			if got := functionInstructions(listing, tt.function); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhenErrors(t *testing.T) {
+	got := diagnosticStrings(compileErrors(compileSource(t, `package: t
+type: q { x int }
+type: o { r int a int p *o s q }
+function: f {
+    > o
+    when: o.a < o.p { + o { r <- 1 } }
+    when: o.a < 1.5 { + o { r <- 1 } }
+    when: o.p < o.p { + o { r <- 1 } }
+    when: z.a == 1 { + o { r <- 1 } }
+    when: o.s == 1 { + o { r <- 1 } }
+}
+`)))
+	want := []string{
+		"A204 6:5 Can not compare o.a int with o.p *o",
+		"A204 7:5 Can not compare o.a int with 1.5",
+		"A204 8:5 o.p *o can only be compared for equality",
+		"A202 9:5 Unable to resolve z, it is not an input",
+		"A204 10:5 Can not compare o.s q with 1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+// Package atomic compiles atomic sources to linkable objects in memory, for embedding the compiler in other tools.
+//
+//	profile, diags := atomic.LoadProfile(reader, "arm64.profile", "linux")
+//	result := atomic.Compile([]atomic.Source{{Filename: "airline.atomic", Data: data}}, atomic.Options{Profile: profile})
+//	if result.HasErrors() { ... }
+//	object := result.Files[0].Object
+package atomic
+
+import (
+	"io"
+
+	"catchpole.net/atomic/internal/app/atomic"
+)
+
+// Profile is a processor profile loaded for a target os, it may be shared by concurrent compilations.
+type Profile = atomic.Profile
+
+// Options configures a compilation.
+type Options = atomic.Options
+
+// Source is a named atomic source file.
+type Source = atomic.Source
+
+// Result holds the compiled files and every diagnostic reported while compiling them.
+type Result = atomic.Result
+
+// File is the object, AST and listing for a single source file.
+type File = atomic.File
+
+// Diagnostic is an error or warning with its source position.
+type Diagnostic = atomic.Diagnostic
+
+// Node is a resolved AST node.
+type Node = atomic.Node
+
+// LoadProfile parses a processor profile for the target os ("darwin" or "linux").
+func LoadProfile(r io.Reader, name string, targetOS string) (*Profile, []Diagnostic) {
+	return atomic.LoadProfile(r, name, targetOS)
+}
+
+// Compile parses, resolves and compiles the sources. It does not read or write files or exit the process.
+func Compile(sources []Source, o Options) Result {
+	return atomic.Compile(sources, o)
+}
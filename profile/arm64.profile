@@ -17,8 +17,8 @@
 ! 13 x13 scratch
 ! 14 x14 scratch
 ! 15 x15 scratch
-! 16 x16 scratch
-! 17 x17 scratch
+! 16 x16 scratch spill   # reserved for reloading spilled values
+! 17 x17 scratch spill
 ! 18 x18 nodarwin        # reserved on MacOS
 ! 19 x19
 ! 20 x20
@@ -34,6 +34,51 @@
 ! 30 x30 link
 ! 31 sp stack
 
+! 0 d0 float scratch param result
+! 1 d1 float scratch param result
+! 2 d2 float scratch param result
+! 3 d3 float scratch param result
+! 4 d4 float scratch param result
+! 5 d5 float scratch param result
+! 6 d6 float scratch param result
+! 7 d7 float scratch param result
+! 8 d8 float              # callee saved, lower 64 bits
+! 9 d9 float
+! 10 d10 float
+! 11 d11 float
+! 12 d12 float
+! 13 d13 float
+! 14 d14 float
+! 15 d15 float
+! 16 d16 float scratch
+! 17 d17 float scratch
+! 18 d18 float scratch
+! 19 d19 float scratch
+! 20 d20 float scratch
+! 21 d21 float scratch
+! 22 d22 float scratch
+! 23 d23 float scratch
+! 24 d24 float scratch
+! 25 d25 float scratch
+! 26 d26 float scratch
+! 27 d27 float scratch
+! 28 d28 float scratch
+! 29 d29 float scratch
+! 30 d30 float scratch
+! 31 d31 float scratch
+
+# primative sizes and alignments for the AAPCS64 abi, used by both darwin and linux.
+# @ <type> <size> <alignment>
+
+@ bool 1 1
+@ byte 1 1
+@ short 2 2
+@ int 4 4
+@ long 8 8
+@ double 8 8
+@ string 8 8       # pointer to characters
+@ pointer 8 8
+
 # based on http://kitoslab-eng.blogspot.com/2012/10/armv8-aarch64-instruction-encoding.html
 
 xx01 1110 xx1x xxx0 1011 10nn nnnd dddd  -  abs Sd Sn
@@ -44,9 +89,15 @@ x100 1110 xx1m mmmm 0100 00nn nnnd dddd  -  addhn2 Vd Vn Vm
 x000 1110 xx1m mmmm 0100 00nn nnnd dddd  -  addhn Vd Vn Vm
 xxx1 1110 xx11 xxx1 1011 10nn nnnd dddd  -  addp Sd Vn
 xxx0 1110 xx1m mmmm 1011 11nn nnnd dddd  -  addp Vd Vn Vm
-1000 1011 000m mmmm 0000 00nn nnnd dddd  -  add Rd Rn Rm    # custom
-x000 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  add Rd Rn Rm_SFT
-x00x 0001 SSii iiii iiii iinn nnnd dddd  -  add Rd_SP Rn_SP AIMM
+#1000 1011 000m mmmm 0000 00nn nnnd dddd  -  add Rd Rn Rm    # custom
+#x000 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  add Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1000 1011 000m mmmm ssss ssnn nnnd dddd  -  add Rd Rn Rm_SFT
+#x00x 0001 SSii iiii iiii iinn nnnd dddd  -  add Rd_SP Rn_SP AIMM
+# custom - 64 bit, unshifted
+1001 0001 00ii iiii iiii iinn nnnd dddd  -  add Rd_SP Rn_SP AIMM
+# custom - 64 bit, shifted left 12 bits
+1001 0001 01ii iiii iiii iinn nnnd dddd  -  add.lsl Rd_SP Rn_SP AIMM
 x000 1011 0x1x xxxx xxxx xxnn nnnd dddd  -  add Rd_SP Rn_SP Rm_EXT
 x101 1110 xx1m mmmm x000 01nn nnnd dddd  -  add Sd Sn Sm
 x010 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  adds Rd Rn Rm_SFT
@@ -55,20 +106,32 @@ x010 1011 0x1x xxxx xxxx xxnn nnnd dddd  -  adds Rd Rn_SP Rm_EXT
 xx00 1110 xx1m mmmm 1000 01nn nnnd dddd  -  add Vd Vn Vm
 xxx0 1110 xx11 xxx1 1011 10nn nnnd dddd  -  addv Fd Vn
 1iix 0000 iiii iiii iiii iiii iiid dddd  -  adrp Rd ADDR_ADRP
-0iix 0000 iiii iiii iiii iiii iiid dddd  -  adr Rd ADDR_PCREL21
+#0iix 0000 iiii iiii iiii iiii iiid dddd  -  adr Rd ADDR_PCREL21
+# custom - immlo l, immhi i
+0ll1 0000 iiii iiii iiii iiii iiid dddd  -  adr Rd ADDR_PCREL21
 xxx0 1110 xx1x 1xxx 0101 10nn nnnd dddd  -  aesd Vd Vn
 xxx0 1110 xx1x 1xx0 0100 10nn nnnd dddd  -  aese Vd Vn
 xxx0 1110 xx1x 1xx0 0111 10nn nnnd dddd  -  aesimc Vd Vn
 xxx0 1110 xx1x 1xx0 0110 10nn nnnd dddd  -  aesmc Vd Vn
-x000 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  and Rd Rn Rm_SFT
+#x000 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  and Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1000 1010 000m mmmm ssss ssnn nnnd dddd  -  and Rd Rn Rm_SFT
 x00x 0010 0Nii iiii iiii iinn nnnd dddd  -  and Rd_SP Rn LIMM
 x11x 0010 0Nii iiii iiii iinn nnnd dddd  -  ands Rd Rn LIMM
 x110 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  ands Rd Rn Rm_SFT
 xx00 1110 001m mmmm 0001 11nn nnnd dddd  -  and Vd Vn Vm
-xxx1 1010 1x0m mmmm xx1x 10nn nnnd dddd  -  asrv Rd Rn Rm
-000x 01ii iiii iiii iiii iiii iiii iiii  -  b ADDR_PCREL26
-010x 0100 iiii iiii iiii iiii iiix xxxx  -  b.c ADDR_PCREL19
-xx1x 0011 0xii iiii iiii iinn nnnd dddd  -  bfm Rd Rn IMMR IMMS
+#xxx1 1010 1x0m mmmm xx1x 10nn nnnd dddd  -  asrv Rd Rn Rm
+# custom - 64 bit
+1001 1010 110m mmmm 0010 10nn nnnd dddd  -  asrv Rd Rn Rm
+#000x 01ii iiii iiii iiii iiii iiii iiii  -  b ADDR_PCREL26
+# custom
+0001 01ii iiii iiii iiii iiii iiii iiii  -  b ADDR_PCREL26
+#010x 0100 iiii iiii iiii iiii iiix xxxx  -  b.c ADDR_PCREL19
+# custom - condition c
+0101 0100 iiii iiii iiii iiii iii0 cccc  -  b.c ADDR_PCREL19
+#xx1x 0011 0xii iiii iiii iinn nnnd dddd  -  bfm Rd Rn IMMR IMMS
+# custom - 64 bit, rotate r and width s
+1011 0011 01rr rrrr ssss ssnn nnnd dddd  -  bfm Rd Rn IMMR IMMS
 x00x 1010 xx1x xxxx xxxx xxnn nnnd dddd  -  bic Rd Rn Rm_SFT
 x11x 1010 xx1x xxxx xxxx xxnn nnnd dddd  -  bics Rd Rn Rm_SFT
 xx10 1111 xxxx xxxx 0xx1 x1xx xxxd dddd  -  bic Vd SIMD_IMM_SFT
@@ -77,16 +140,24 @@ xx00 1110 011m mmmm 0001 11nn nnnd dddd  -  bic Vd Vn Vm
 xx10 1110 111m mmmm 0001 11nn nnnd dddd  -  bif Vd Vn Vm
 xx10 1110 101m mmmm 0001 11nn nnnd dddd  -  bit Vd Vn Vm
 100x 01ii iiii iiii iiii iiii iiii iiii  -  bl ADDR_PCREL26
-x10x 0110 0x1x xxxx xxxx xxnn nnnx xxxx  -  blr Rn
+1101 0110 0011 1111 0000 00nn nnnx xxxx  -  blr Rn       # hints added. original: x10x 0110 0x1x xxxx xxxx xxnn nnnx xxxx
 110x 0100 xx1i iiii iiii iiii iiix xx00  -  brk EXCEPTION
-x10x 0110 000x xxxx xxxx xxnn nnnx xxxx  -  br Rn
+1101 0110 0001 1111 0000 00nn nnnx xxxx  -  br Rn       # hints added. original: x10x 0110 000x xxxx xxxx xxnn nnnx xxxx
 xx10 1110 011m mmmm 0001 11nn nnnd dddd  -  bsl Vd Vn Vm
-xx1x 0101 iiii iiii iiii iiii iiit tttt  -  cbnz Rt ADDR_PCREL19
-xx1x 0100 iiii iiii iiii iiii iiit tttt  -  cbz Rt ADDR_PCREL19
+#xx1x 0101 iiii iiii iiii iiii iiit tttt  -  cbnz Rt ADDR_PCREL19
+# custom - 64 bit
+1011 0101 iiii iiii iiii iiii iiit tttt  -  cbnz Rt ADDR_PCREL19
+#xx1x 0100 iiii iiii iiii iiii iiit tttt  -  cbz Rt ADDR_PCREL19
+# custom - 64 bit
+1011 0100 iiii iiii iiii iiii iiit tttt  -  cbz Rt ADDR_PCREL19
 x0x1 1010 0x0i iiii xxxx 10nn nnnx cccc  -  ccmn Rn CCMP_IMM NZCV COND
 x0x1 1010 010m mmmm xxxx 00nn nnnx cccc  -  ccmn Rn Rm NZCV COND
-x1x1 1010 0x0i iiii xxxx 10nn nnnx cccc  -  ccmp Rn CCMP_IMM NZCV COND
-x1x1 1010 010m mmmm xxxx 00nn nnnx cccc  -  ccmp Rn Rm NZCV COND
+#x1x1 1010 0x0i iiii xxxx 10nn nnnx cccc  -  ccmp Rn CCMP_IMM NZCV COND
+# custom - 64 bit, flags f, condition c
+1111 1010 010i iiii cccc 10nn nnn0 ffff  -  ccmp Rn CCMP_IMM NZCV COND
+#x1x1 1010 010m mmmm xxxx 00nn nnnx cccc  -  ccmp Rn Rm NZCV COND
+# custom - 64 bit, flags f, condition c
+1111 1010 010m mmmm cccc 00nn nnn0 ffff  -  ccmp Rn Rm NZCV COND
 x10x 01x1 xxx0 0xxx xxx1 mmmm 010x xxxx  -  clrex UIMM4
 xxx1 1010 x10x xxxx xxx1 01nn nnnd dddd  -  cls Rd Rn
 xx00 1110 xx1x 0xx0 0100 10nn nnnd dddd  -  cls Vd Vn
@@ -129,7 +200,9 @@ x1x1 1110 xx0x xxxx xxxx x1nn nnnd dddd  -  dup Sd En
 xx00 1110 xx0x xxxx xxxx 01nn nnnd dddd  -  dup Vd En
 xx00 1110 xx0x xxxx xx00 11nn nnnd dddd  -  dup Vd Rn
 x10x 1010 xx1x xxxx xxxx xxnn nnnd dddd  -  eon Rd Rn Rm_SFT
-x100 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  eor Rd Rn Rm_SFT
+#x100 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  eor Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1100 1010 000m mmmm ssss ssnn nnnd dddd  -  eor Rd Rn Rm_SFT
 x10x 0010 0Nii iiii iiii iinn nnnd dddd  -  eor Rd_SP Rn LIMM
 xx10 1110 001m mmmm 0001 11nn nnnd dddd  -  eor Vd Vn Vm
 x10x 0110 100x xxxx xxxx xxxx xxxx xxxx  -  eret
@@ -143,12 +216,16 @@ xx11 1110 0x1m mmmm x110 11nn nnnd dddd  -  facge Sd Sn Sm
 xxx0 1110 0x1m mmmm 1110 11nn nnnd dddd  -  facge Vd Vn Vm
 xx11 1110 1x1m mmmm x110 11nn nnnd dddd  -  facgt Sd Sn Sm
 xxx0 1110 1x1m mmmm 1110 11nn nnnd dddd  -  facgt Vd Vn Vm
-x001 1110 xx1m mmmm 0010 10nn nnnd dddd  -  fadd Fd Fn Fm
+#x001 1110 xx1m mmmm 0010 10nn nnnd dddd  -  fadd Fd Fn Fm
+# custom - double
+0001 1110 011m mmmm 0010 10nn nnnd dddd  -  fadd Fd Fn Fm
 xxxx 1110 xx11 xxx0 1101 10nn nnnd dddd  -  faddp Sd Vn
 xx10 1110 0x1m mmmm 1101 01nn nnnd dddd  -  faddp Vd Vn Vm
 xx00 1110 0x1m mmmm 1101 01nn nnnd dddd  -  fadd Vd Vn Vm
 x001 1110 xx1m mmmm xxxx 01nn nnn1 cccc  -  fccmpe Fn Fm NZCV COND
-x001 1110 xx1m mmmm xxxx 01nn nnn0 cccc  -  fccmp Fn Fm NZCV COND
+#x001 1110 xx1m mmmm xxxx 01nn nnn0 cccc  -  fccmp Fn Fm NZCV COND
+# custom - double, flags f, condition c
+0001 1110 011m mmmm cccc 01nn nnn0 ffff  -  fccmp Fn Fm NZCV COND
 xx01 1110 xx10 xxx0 1101 10nn nnnd dddd  -  fcmeq Sd Sn IMM0
 x101 1110 xx1m mmmm xx10 01nn nnnd dddd  -  fcmeq Sd Sn Sm
 xx00 1110 xx10 xxx0 1101 10nn nnnd dddd  -  fcmeq Vd Vn IMM0
@@ -167,7 +244,9 @@ xxx1 1110 xx1x xxxx 1110 10nn nnnd dddd  -  fcmlt Sd Sn IMM0
 xxx0 1110 xx1x xxxx 1110 10nn nnnd dddd  -  fcmlt Vd Vn IMM0
 xxx1 1110 xx1m mmmm 0010 00nn nnn1 0xxx  -  fcmpe Fn Fm
 xxx1 1110 xx1x xxxx 0010 00nn nnn1 1xxx  -  fcmpe Fn FPIMM0
-xxx1 1110 xx1m mmmm 0010 00nn nnn0 0xxx  -  fcmp Fn Fm
+#xxx1 1110 xx1m mmmm 0010 00nn nnn0 0xxx  -  fcmp Fn Fm
+# custom - double
+0001 1110 011m mmmm 0010 00nn nnn0 0000  -  fcmp Fn Fm
 xxx1 1110 xx1x xxxx 0010 00nn nnn0 1xxx  -  fcmp Fn FPIMM0
 x001 1110 xx1m mmmm xxxx 11nn nnnd dddd  -  fcsel Fd Fn Fm COND
 xxx1 1110 xx1x x100 0000 00nn nnnd dddd  -  fcvtas Rd Fn
@@ -202,7 +281,9 @@ xx10 1110 1x10 xxx1 1010 10nn nnnd dddd  -  fcvtpu Vd Vn
 x110 1110 xx1x xxx1 0110 10nn nnnd dddd  -  fcvtxn2 Vd Vn
 xx11 1110 xx1x xxxx 0110 10nn nnnd dddd  -  fcvtxn Sd Sn
 x010 1110 xx1x xxx1 0110 10nn nnnd dddd  -  fcvtxn Vd Vn
-xxx1 1110 xx11 1000 0000 00nn nnnd dddd  -  fcvtzs Rd Fn
+#xxx1 1110 xx11 1000 0000 00nn nnnd dddd  -  fcvtzs Rd Fn
+# custom - double to 64 bit integer, rounding toward zero
+1001 1110 0111 1000 0000 00nn nnnd dddd  -  fcvtzs Rd Fn
 x0x1 1110 xx0x xx00 SSSS SSnn nnnd dddd  -  fcvtzs Rd Fn FBITS
 xx01 1110 1x10 xxx1 1011 10nn nnnd dddd  -  fcvtzs Sd Sn
 x101 1111 xxxx xxxx 1x1x 11nn nnnd dddd  -  fcvtzs Sd Sn IMM_VLSR
@@ -214,7 +295,9 @@ xx11 1110 1x10 xxx1 1011 10nn nnnd dddd  -  fcvtzu Sd Sn
 xx11 1111 xxxx xxxx 1x11 11nn nnnd dddd  -  fcvtzu Sd Sn IMM_VLSR
 xx10 1110 1x10 xxx1 1011 10nn nnnd dddd  -  fcvtzu Vd Vn
 xx10 1111 xxxx xxxx 1x11 11nn nnnd dddd  -  fcvtzu Vd Vn IMM_VLSR
-x0x1 1110 xx1m mmmm 0001 10nn nnnd dddd  -  fdiv Fd Fn Fm
+#x0x1 1110 xx1m mmmm 0001 10nn nnnd dddd  -  fdiv Fd Fn Fm
+# custom - double
+0001 1110 011m mmmm 0001 10nn nnnd dddd  -  fdiv Fd Fn Fm
 xx10 1110 0x1m mmmm 1111 11nn nnnd dddd  -  fdiv Vd Vn Vm
 x001 1111 xx0m mmmm 0aaa aann nnnd dddd  -  fmadd Fd Fn Fm Fa
 x001 1110 xx1m mmmm 0100 10nn nnnd dddd  -  fmax Fd Fn Fm
@@ -243,8 +326,12 @@ xxx0 1110 0x1m mmmm 1100 11nn nnnd dddd  -  fmla Vd Vn Vm
 x101 1111 xxxm mmmm 010x x0nn nnnd dddd  -  fmls Sd Sn Em
 xxx0 1111 xxxm mmmm 0101 x0nn nnnd dddd  -  fmls Vd Vn Em
 xxx0 1110 1x1m mmmm 1100 11nn nnnd dddd  -  fmls Vd Vn Vm
+# custom - 64 bit integer register to double
+1001 1110 0110 0111 0000 00nn nnnd dddd  -  fmov Fd Rn
 xxx1 1110 xx1x x000 0100 00nn nnnd dddd  -  fmov Fd Fn
-x0x1 1110 xx1i iiii iii1 00xx xxxd dddd  -  fmov Fd FPIMM
+#x0x1 1110 xx1i iiii iii1 00xx xxxd dddd  -  fmov Fd FPIMM
+# custom - double
+0001 1110 011i iiii iii1 0000 000d dddd  -  fmov Fd FPIMM
 xxx1 1110 xx1x 0111 0000 00nn nnnd dddd  -  fmov Fd Rn
 xxx1 1110 xx1x 0110 0000 00nn nnnd dddd  -  fmov Rd Fn
 xxx1 1110 xx1x 1110 0000 00nn nnnd dddd  -  fmov Rd VnD1
@@ -252,7 +339,9 @@ xxx1 1110 xx1x 1111 0000 00nn nnnd dddd  -  fmov VdD1 Rn
 xx00 1111 xxxx xxxx 1111 01xx xxxd dddd  -  fmov Vd SIMD_FPIMM
 xx10 1111 xxxx xxxx 1111 01xx xxxd dddd  -  fmov Vd SIMD_FPIMM
 x001 1111 xx0m mmmm 1aaa aann nnnd dddd  -  fmsub Fd Fn Fm Fa
-x0x1 1110 xx1m mmmm 0000 10nn nnnd dddd  -  fmul Fd Fn Fm
+#x0x1 1110 xx1m mmmm 0000 10nn nnnd dddd  -  fmul Fd Fn Fm
+# custom - double
+0001 1110 011m mmmm 0000 10nn nnnd dddd  -  fmul Fd Fn Fm
 x101 1111 xxxm mmmm 1001 x0nn nnnd dddd  -  fmul Sd Sn Em
 xx00 1111 xxxm mmmm 1001 x0nn nnnd dddd  -  fmul Vd Vn Em
 xx10 1110 xx1m mmmm 1101 11nn nnnd dddd  -  fmul Vd Vn Vm
@@ -260,7 +349,9 @@ xx11 1111 xxxm mmmm 1xxx x0nn nnnd dddd  -  fmulx Sd Sn Em
 x101 1110 xx1m mmmm 1x01 11nn nnnd dddd  -  fmulx Sd Sn Sm
 xx10 1111 xxxm mmmm 1001 x0nn nnnd dddd  -  fmulx Vd Vn Em
 xx00 1110 xx1m mmmm 1101 11nn nnnd dddd  -  fmulx Vd Vn Vm
-xxx1 1110 xx1x x001 0100 00nn nnnd dddd  -  fneg Fd Fn
+#xxx1 1110 xx1x x001 0100 00nn nnnd dddd  -  fneg Fd Fn
+# custom - double
+0001 1110 0110 0001 0100 00nn nnnd dddd  -  fneg Fd Fn
 xx1x 1110 xx10 xxx0 1111 10nn nnnd dddd  -  fneg Vd Vn
 x001 1111 xx1m mmmm 0aaa aann nnnd dddd  -  fnmadd Fd Fn Fm Fa
 x001 1111 xx1m mmmm 1aaa aann nnnd dddd  -  fnmsub Fd Fn Fm Fa
@@ -290,7 +381,9 @@ x101 1110 1x1m mmmm x111 11nn nnnd dddd  -  frsqrts Sd Sn Sm
 xxx0 1110 1x1m mmmm 1111 11nn nnnd dddd  -  frsqrts Vd Vn Vm
 xxx1 1110 xx1x x001 1100 00nn nnnd dddd  -  fsqrt Fd Fn
 xxx0 1110 xx1x xxx1 1111 10nn nnnd dddd  -  fsqrt Vd Vn
-x001 1110 xx1m mmmm 0011 10nn nnnd dddd  -  fsub Fd Fn Fm
+#x001 1110 xx1m mmmm 0011 10nn nnnd dddd  -  fsub Fd Fn Fm
+# custom - double
+0001 1110 011m mmmm 0011 10nn nnnd dddd  -  fsub Fd Fn Fm
 xx00 1110 1x1m mmmm 1101 01nn nnnd dddd  -  fsub Vd Vn Vm
 x10x 01x1 xxx0 0xxx xx10 mmmm ooox xxxx  -  hint UIMM7
 110x 0100 xx0i iiii iiii iiii iiix xx00  -  hlt EXCEPTION
@@ -317,59 +410,114 @@ xx00 100x 011x xxxx 1ttt ttxx xxxt tttt  -  ldaxp Rt Rt2 ADDR_SIMPLE
 1x00 100x 010x xxxx 1xxx xxxx xxxt tttt  -  ldaxr Rt ADDR_SIMPLE
 xx10 110I 01ii iiii ittt ttxx xxxt tttt  -  ldnp Ft Ft2 ADDR_SIMM7
 x010 100I 01ii iiii ittt ttxx xxxt tttt  -  ldnp Rt Rt2 ADDR_SIMM7
-xx10 110I 01ii iiii ittt ttxx xxxt tttt  -  ldp Ft Ft2 ADDR_SIMM7
-xx10 110I 11ii iiii ittt ttxx xxxt tttt  -  ldp Ft Ft2 ADDR_SIMM7
-x010 100I 11ii iiii ittt ttxx xxxt tttt  -  ldp Rt Rt2 ADDR_SIMM7
+#xx10 110I 01ii iiii ittt ttxx xxxt tttt  -  ldp Ft Ft2 ADDR_SIMM7
+#xx10 110I 11ii iiii ittt ttxx xxxt tttt  -  ldp Ft Ft2 ADDR_SIMM7
+#x010 100I 11ii iiii ittt ttxx xxxt tttt  -  ldp Rt Rt2 ADDR_SIMM7
+# custom - 64 bit, signed offset
+1010 1001 01ii iiii iuuu uunn nnnt tttt  -  ldp Rt Rt2 ADDR_SIMM7
+# custom - 64 bit, post-indexed
+1010 1000 11ii iiii iuuu uunn nnnt tttt  -  ldp.post Rt Rt2 ADDR_SIMM7
+# custom - 64 bit double, signed offset
+0110 1101 01ii iiii iuuu uunn nnnt tttt  -  ldp Ft Ft2 ADDR_SIMM7
 x110 100I 01ii iiii ittt ttxx xxxt tttt  -  ldpsw Rt Rt2 ADDR_SIMM7
 x110 100I 11ii iiii ittt ttxx xxxt tttt  -  ldpsw Rt Rt2 ADDR_SIMM7
-0011 1000 011x xxxx xxxx 10xx xxxt tttt  -  ldrb Rt ADDR_REGOFF
+#0011 1000 011x xxxx xxxx 10xx xxxt tttt  -  ldrb Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s
+0011 1000 011m mmmm 011s 10nn nnnt tttt  -  ldrb Rt ADDR_REGOFF
 0011 1000 01xi iiii iiii I1xx xxxt tttt  -  ldrb Rt ADDR_SIMM9
-00x1 1001 01ii iiii iiii iinn nnnt tttt  -  ldrb Rt ADDR_UIMM12
+#00x1 1001 01ii iiii iiii iinn nnnt tttt  -  ldrb Rt ADDR_UIMM12
+# custom
+0011 1001 01ii iiii iiii iinn nnnt tttt  -  ldrb Rt ADDR_UIMM12
 xx01 1100 iiii iiii iiii iiii iiit tttt  -  ldr Ft ADDR_PCREL19
-xx11 1100 x1xx xxxx xxxx 10xx xxxt tttt  -  ldr Ft ADDR_REGOFF
+#xx11 1100 x1xx xxxx xxxx 10xx xxxt tttt  -  ldr Ft ADDR_REGOFF
+# custom - double, lsl index m, shifted by the access size if s
+1111 1100 011m mmmm 011s 10nn nnnt tttt  -  ldr Ft ADDR_REGOFF
 xx11 1100 x1xi iiii iiii I1xx xxxt tttt  -  ldr Ft ADDR_SIMM9
-xxx1 1101 x1ii iiii iiii iinn nnnt tttt  -  ldr Ft ADDR_UIMM12
-0111 1000 011x xxxx xxxx 10xx xxxt tttt  -  ldrh Rt ADDR_REGOFF
+#xxx1 1101 x1ii iiii iiii iinn nnnt tttt  -  ldr Ft ADDR_UIMM12
+# custom - 64 bit double
+1111 1101 01ii iiii iiii iinn nnnt tttt  -  ldr Ft ADDR_UIMM12
+#0111 1000 011x xxxx xxxx 10xx xxxt tttt  -  ldrh Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s
+0111 1000 011m mmmm 011s 10nn nnnt tttt  -  ldrh Rt ADDR_REGOFF
 0111 1000 01xi iiii iiii I1xx xxxt tttt  -  ldrh Rt ADDR_SIMM9
-01x1 1001 01ii iiii iiii iinn nnnt tttt  -  ldrh Rt ADDR_UIMM12
+#01x1 1001 01ii iiii iiii iinn nnnt tttt  -  ldrh Rt ADDR_UIMM12
+# custom
+0111 1001 01ii iiii iiii iinn nnnt tttt  -  ldrh Rt ADDR_UIMM12
 0x01 1000 iiii iiii iiii iiii iiit tttt  -  ldr Rt ADDR_PCREL19
-1x11 1000 011x xxxx xxxx 10xx xxxt tttt  -  ldr Rt ADDR_REGOFF
+#1x11 1000 011x xxxx xxxx 10xx xxxt tttt  -  ldr Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s
+1111 1000 011m mmmm 011s 10nn nnnt tttt  -  ldr Rt ADDR_REGOFF
+1011 1000 011m mmmm 011s 10nn nnnt tttt  -  ldr.w Rt ADDR_REGOFF
 1x11 1000 01xi iiii iiii I1xx xxxt tttt  -  ldr Rt ADDR_SIMM9
 #1xx1 1001 01ii iiii iiii iinn nnnt tttt  -  ldr Rt ADDR_UIMM12
 
 1111 1001 01ii iiii iiii iinn nnnt tttt  -  ldr Rt ADDR_UIMM12
 1011 1001 01ii iiii iiii iinn nnnt tttt  -  ldr.w Rt ADDR_UIMM12
 
-0011 1000 1x1x xxxx xxxx 10xx xxxt tttt  -  ldrsb Rt ADDR_REGOFF
+#0011 1000 1x1x xxxx xxxx 10xx xxxt tttt  -  ldrsb Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s, sign extends to 64 bits
+0011 1000 101m mmmm 011s 10nn nnnt tttt  -  ldrsb Rt ADDR_REGOFF
 0011 1000 1xxi iiii iiii I1xx xxxt tttt  -  ldrsb Rt ADDR_SIMM9
-00x1 1001 1xii iiii iiii iinn nnnt tttt  -  ldrsb Rt ADDR_UIMM12
-0111 1000 1x1x xxxx xxxx 10xx xxxt tttt  -  ldrsh Rt ADDR_REGOFF
+#00x1 1001 1xii iiii iiii iinn nnnt tttt  -  ldrsb Rt ADDR_UIMM12
+# custom - sign extends to 64 bits
+0011 1001 10ii iiii iiii iinn nnnt tttt  -  ldrsb Rt ADDR_UIMM12
+#0111 1000 1x1x xxxx xxxx 10xx xxxt tttt  -  ldrsh Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s, sign extends to 64 bits
+0111 1000 101m mmmm 011s 10nn nnnt tttt  -  ldrsh Rt ADDR_REGOFF
 x111 1000 1xxi iiii iiii I1xx xxxt tttt  -  ldrsh Rt ADDR_SIMM9
-01x1 1001 1xii iiii iiii iinn nnnt tttt  -  ldrsh Rt ADDR_UIMM12
+#01x1 1001 1xii iiii iiii iinn nnnt tttt  -  ldrsh Rt ADDR_UIMM12
+# custom - sign extends to 64 bits
+0111 1001 10ii iiii iiii iinn nnnt tttt  -  ldrsh Rt ADDR_UIMM12
 1001 1000 iiii iiii iiii iiii iiit tttt  -  ldrsw Rt ADDR_PCREL19
-1011 1000 1x1x xxxx xxxx 10xx xxxt tttt  -  ldrsw Rt ADDR_REGOFF
+#1011 1000 1x1x xxxx xxxx 10xx xxxt tttt  -  ldrsw Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s, sign extends to 64 bits
+1011 1000 101m mmmm 011s 10nn nnnt tttt  -  ldrsw Rt ADDR_REGOFF
 1011 1000 1xxi iiii iiii I1xx xxxt tttt  -  ldrsw Rt ADDR_SIMM9
-10x1 1001 1xii iiii iiii iinn nnnt tttt  -  ldrsw Rt ADDR_UIMM12
-0011 1000 010i iiii iiii I0xx xxxt tttt  -  ldtrb Rt ADDR_SIMM9
-0111 1000 010i iiii iiii I0xx xxxt tttt  -  ldtrh Rt ADDR_SIMM9
-1x11 1000 010i iiii iiii I0xx xxxt tttt  -  ldtr Rt ADDR_SIMM9
-0011 1000 1x0i iiii iiii I0xx xxxt tttt  -  ldtrsb Rt ADDR_SIMM9
-x111 1000 1x0i iiii iiii I0xx xxxt tttt  -  ldtrsh Rt ADDR_SIMM9
-1011 1000 1x0i iiii iiii I0xx xxxt tttt  -  ldtrsw Rt ADDR_SIMM9
-0011 1000 01xi iiii iiii I0xx xxxt tttt  -  ldurb Rt ADDR_SIMM9
-xx11 1100 x1xi iiii iiii I0xx xxxt tttt  -  ldur Ft ADDR_SIMM9
-0111 1000 01xi iiii iiii I0xx xxxt tttt  -  ldurh Rt ADDR_SIMM9
-1x11 1000 01xi iiii iiii I0xx xxxt tttt  -  ldur Rt ADDR_SIMM9
-0011 1000 1xxi iiii iiii I0xx xxxt tttt  -  ldursb Rt ADDR_SIMM9
-0111 1000 1xxi iiii iiii I0xx xxxt tttt  -  ldursh Rt ADDR_SIMM9
-1011 1000 1xxi iiii iiii I0xx xxxt tttt  -  ldursw Rt ADDR_SIMM9
+#10x1 1001 1xii iiii iiii iinn nnnt tttt  -  ldrsw Rt ADDR_UIMM12
+# custom - sign extends to 64 bits
+1011 1001 10ii iiii iiii iinn nnnt tttt  -  ldrsw Rt ADDR_UIMM12
+# unprivileged loads share their bits with the custom unscaled loads
+#0011 1000 010i iiii iiii I0xx xxxt tttt  -  ldtrb Rt ADDR_SIMM9
+#0111 1000 010i iiii iiii I0xx xxxt tttt  -  ldtrh Rt ADDR_SIMM9
+#1x11 1000 010i iiii iiii I0xx xxxt tttt  -  ldtr Rt ADDR_SIMM9
+#0011 1000 1x0i iiii iiii I0xx xxxt tttt  -  ldtrsb Rt ADDR_SIMM9
+#x111 1000 1x0i iiii iiii I0xx xxxt tttt  -  ldtrsh Rt ADDR_SIMM9
+#1011 1000 1x0i iiii iiii I0xx xxxt tttt  -  ldtrsw Rt ADDR_SIMM9
+#0011 1000 01xi iiii iiii I0xx xxxt tttt  -  ldurb Rt ADDR_SIMM9
+# custom
+0011 1000 010i iiii iiii 00nn nnnt tttt  -  ldurb Rt ADDR_SIMM9
+#xx11 1100 x1xi iiii iiii I0xx xxxt tttt  -  ldur Ft ADDR_SIMM9
+# custom - double
+1111 1100 010i iiii iiii 00nn nnnt tttt  -  ldur Ft ADDR_SIMM9
+#0111 1000 01xi iiii iiii I0xx xxxt tttt  -  ldurh Rt ADDR_SIMM9
+# custom
+0111 1000 010i iiii iiii 00nn nnnt tttt  -  ldurh Rt ADDR_SIMM9
+#1x11 1000 01xi iiii iiii I0xx xxxt tttt  -  ldur Rt ADDR_SIMM9
+# custom - 64 bit
+1111 1000 010i iiii iiii 00nn nnnt tttt  -  ldur Rt ADDR_SIMM9
+1011 1000 010i iiii iiii 00nn nnnt tttt  -  ldur.w Rt ADDR_SIMM9
+#0011 1000 1xxi iiii iiii I0xx xxxt tttt  -  ldursb Rt ADDR_SIMM9
+# custom - sign extends to 64 bits
+0011 1000 100i iiii iiii 00nn nnnt tttt  -  ldursb Rt ADDR_SIMM9
+#0111 1000 1xxi iiii iiii I0xx xxxt tttt  -  ldursh Rt ADDR_SIMM9
+# custom - sign extends to 64 bits
+0111 1000 100i iiii iiii 00nn nnnt tttt  -  ldursh Rt ADDR_SIMM9
+#1011 1000 1xxi iiii iiii I0xx xxxt tttt  -  ldursw Rt ADDR_SIMM9
+# custom - sign extends to 64 bits
+1011 1000 100i iiii iiii 00nn nnnt tttt  -  ldursw Rt ADDR_SIMM9
 xx00 100x 011x xxxx 0ttt ttxx xxxt tttt  -  ldxp Rt Rt2 ADDR_SIMPLE
 0000 100x 010x xxxx 0xxx xxxx xxxt tttt  -  ldxrb Rt ADDR_SIMPLE
 0100 100x 010x xxxx 0xxx xxxx xxxt tttt  -  ldxrh Rt ADDR_SIMPLE
 1x00 100x 010x xxxx 0xxx xxxx xxxt tttt  -  ldxr Rt ADDR_SIMPLE
-xxx1 1010 110m mmmm xx10 00nn nnnd dddd  -  lslv Rd Rn Rm
-xxx1 1010 x10m mmmm xx10 01nn nnnd dddd  -  lsrv Rd Rn Rm
-xxx1 1011 x00m mmmm 0aaa aann nnnd dddd  -  madd Rd Rn Rm Ra
+#xxx1 1010 110m mmmm xx10 00nn nnnd dddd  -  lslv Rd Rn Rm
+# custom - 64 bit
+1001 1010 110m mmmm 0010 00nn nnnd dddd  -  lslv Rd Rn Rm
+#xxx1 1010 x10m mmmm xx10 01nn nnnd dddd  -  lsrv Rd Rn Rm
+# custom - 64 bit
+1001 1010 110m mmmm 0010 01nn nnnd dddd  -  lsrv Rd Rn Rm
+#xxx1 1011 x00m mmmm 0aaa aann nnnd dddd  -  madd Rd Rn Rm Ra
+# custom - 64 bit
+1001 1011 000m mmmm 0aaa aann nnnd dddd  -  madd Rd Rn Rm Ra
 xxx0 1111 xxxm mmmm 0000 x0nn nnnd dddd  -  mla Vd Vn Em
 xx00 1110 xx1m mmmm 1001 01nn nnnd dddd  -  mla Vd Vn Vm
 xxx0 1111 xxxm mmmm 0100 x0nn nnnd dddd  -  mls Vd Vn Em
@@ -379,13 +527,21 @@ xx00 1111 xxxx xxxx 1110 01xx xxxd dddd  -  movi Vd SIMD_IMM
 xx00 1111 xxxx xxxx 0xx0 x1xx xxxd dddd  -  movi Vd SIMD_IMM_SFT
 xx00 1111 xxxx xxxx 10x0 01xx xxxd dddd  -  movi Vd SIMD_IMM_SFT
 xx00 1111 xxxx xxxx 110x 01xx xxxd dddd  -  movi Vd SIMD_IMM_SFT
-xx1x 0010 1xxi iiii iiii iiii iiid dddd  -  movk Rd HALF
-x00x 0010 1xxi iiii iiii iiii iiid dddd  -  movn Rd HALF
-x10x 0010 1xxi iiii iiii iiii iiid dddd  -  movz Rd HALF
+#xx1x 0010 1xxi iiii iiii iiii iiid dddd  -  movk Rd HALF
+# custom - 64 bit, halfword h
+1111 0010 1hhi iiii iiii iiii iiid dddd  -  movk Rd HALF
+#x00x 0010 1xxi iiii iiii iiii iiid dddd  -  movn Rd HALF
+# custom - 64 bit, halfword h
+1001 0010 1hhi iiii iiii iiii iiid dddd  -  movn Rd HALF
+#x10x 0010 1xxi iiii iiii iiii iiid dddd  -  movz Rd HALF
+# custom - 64 bit, halfword h
+1101 0010 1hhi iiii iiii iiii iiid dddd  -  movz Rd HALF
 x10x 01x1 xx11 xxxx xxxx xxxx xxxt tttt  -  mrs Rt SYSREG
 x10x 01x1 xxx0 0xxx xx00 mmmm xxxx xxxx  -  msr PSTATEFIELD UIMM4
 x10x 01x1 xx01 xxxx xxxx xxxx xxxt tttt  -  msr SYSREG Rt
-xxx1 1011 xx0m mmmm 1aaa aann nnnd dddd  -  msub Rd Rn Rm Ra
+#xxx1 1011 xx0m mmmm 1aaa aann nnnd dddd  -  msub Rd Rn Rm Ra
+# custom - 64 bit
+1001 1011 000m mmmm 1aaa aann nnnd dddd  -  msub Rd Rn Rm Ra
 xxx0 1111 xxxm mmmm 1000 x0nn nnnd dddd  -  mul Vd Vn Em
 xx00 1110 xx1m mmmm 1001 11nn nnnd dddd  -  mul Vd Vn Vm
 xx10 1111 xxxx xxxx 0xx0 x1xx xxxd dddd  -  mvni Vd SIMD_IMM_SFT
@@ -395,12 +551,18 @@ xx11 1110 xx1x xxx0 1011 10nn nnnd dddd  -  neg Sd Sn
 xx10 1110 xx1x xxx0 1011 10nn nnnd dddd  -  neg Vd Vn
 1101 0101 0000 0011 0010 0000 0001 1111  -  nop
 xx10 1110 x01x 0xxx 0101 10nn nnnd dddd  -  not Vd Vn
-x01x 1010 xx1x xxxx xxxx xxnn nnnd dddd  -  orn Rd Rn Rm_SFT
+#x01x 1010 xx1x xxxx xxxx xxnn nnnd dddd  -  orn Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1010 1010 001m mmmm ssss ssnn nnnd dddd  -  orn Rd Rn Rm_SFT
 xx00 1110 111m mmmm 0001 11nn nnnd dddd  -  orn Vd Vn Vm
 #1010 1010 000m mmmm 0000 0011 111d dddd -   mov Rd Rm
 1010 1010 000n nnnn 0000 0011 111d dddd -   mov Rd Rn   # custom
-x010 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  orr Rd Rn Rm_SFT
-x01x 0010 0Nii iiii iiii iinn nnnd dddd  -  orr Rd_SP Rn LIMM
+#x010 1010 xx0x xxxx xxxx xxnn nnnd dddd  -  orr Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1010 1010 000m mmmm ssss ssnn nnnd dddd  -  orr Rd Rn Rm_SFT
+#x01x 0010 0Nii iiii iiii iinn nnnd dddd  -  orr Rd_SP Rn LIMM
+# custom - 64 bit, i is N:immr:imms
+1011 0010 0iii iiii iiii iinn nnnd dddd  -  orr Rd_SP Rn LIMM
 xx00 1111 xxxx xxxx 0xx1 x1xx xxxd dddd  -  orr Vd SIMD_IMM_SFT
 xx00 1111 xxxx xxxx 10x1 01xx xxxd dddd  -  orr Vd SIMD_IMM_SFT
 xx00 1110 101m mmmm 0001 11nn nnnd dddd  -  orr Vd Vn Vm
@@ -418,13 +580,19 @@ x010 1110 xx1m mmmm 0100 00nn nnnd dddd  -  raddhn Vd Vn Vm
 xxx1 1010 110x xxxx xx00 00nn nnnd dddd  -  rbit Rd Rn
 xx10 1110 x11x 0xxx 0101 10nn nnnd dddd  -  rbit Vd Vn
 1101 0110 0101 1111 0000 00nn nnnx xxxx  -  ret Rn       # hints added. original: x10x 0110 x10x xxxx xxxx xxnn nnnx xxxx
-xxx1 1010 x10x xxxx xx00 01nn nnnd dddd  -  rev16 Rd Rn
+#xxx1 1010 x10x xxxx xx00 01nn nnnd dddd  -  rev16 Rd Rn
+# custom - 64 bit, reversing the bytes of each halfword
+1101 1010 1100 0000 0000 01nn nnnd dddd  -  rev16 Rd Rn
 xxx0 1110 xx1x xxxx 0001 10nn nnnd dddd  -  rev16 Vd Vn
-11x1 1010 1x0x xxxx xx0x 10nn nnnd dddd  -  rev32 Rd Rn
+#11x1 1010 1x0x xxxx xx0x 10nn nnnd dddd  -  rev32 Rd Rn
+# custom - 64 bit, reversing the bytes of each word
+1101 1010 1100 0000 0000 10nn nnnd dddd  -  rev32 Rd Rn
 xx10 1110 xx1x xxxx 0000 10nn nnnd dddd  -  rev32 Vd Vn
 xx00 1110 xx1x xxxx 0000 10nn nnnd dddd  -  rev64 Vd Vn
-01x1 1010 1x0x xxxx xx0x 10nn nnnd dddd  -  rev Rd Rn
-x1x1 1010 xx0x xxxx xx0x 11nn nnnd dddd  -  rev Rd Rn
+#01x1 1010 1x0x xxxx xx0x 10nn nnnd dddd  -  rev Rd Rn
+#x1x1 1010 xx0x xxxx xx0x 11nn nnnd dddd  -  rev Rd Rn
+# custom - 64 bit
+1101 1010 1100 0000 0000 11nn nnnd dddd  -  rev Rd Rn
 xxx1 1010 xx0m mmmm xx1x 11nn nnnd dddd  -  rorv Rd Rn Rm
 x100 1111 xxxx xxxx 1xx0 11nn nnnd dddd  -  rshrn2 Vd Vn IMM_VLSR
 x000 1111 xxxx xxxx 1xx0 11nn nnnd dddd  -  rshrn Vd Vn IMM_VLSR
@@ -445,13 +613,19 @@ x100 1110 xx1m mmmm 0001 00nn nnnd dddd  -  saddw2 Vd Vn Vm
 x000 1110 xx1m mmmm 0001 00nn nnnd dddd  -  saddw Vd Vn Vm
 x101 1010 000m mmmm xxxx 00nn nnnd dddd  -  sbc Rd Rn Rm
 x111 1010 000m mmmm xxxx 00nn nnnd dddd  -  sbcs Rd Rn Rm
-x00x 0011 0xii iiii iiii iinn nnnd dddd  -  sbfm Rd Rn IMMR IMMS
-xxx1 1110 xx1x x010 0000 00nn nnnd dddd  -  scvtf Fd Rn
+#x00x 0011 0xii iiii iiii iinn nnnd dddd  -  sbfm Rd Rn IMMR IMMS
+# custom - 64 bit, rotate r and width s
+1001 0011 01rr rrrr ssss ssnn nnnd dddd  -  sbfm Rd Rn IMMR IMMS
+#xxx1 1110 xx1x x010 0000 00nn nnnd dddd  -  scvtf Fd Rn
+# custom - 64 bit integer to double
+1001 1110 0110 0010 0000 00nn nnnd dddd  -  scvtf Fd Rn
 x0x1 1110 xx0x xx10 SSSS SSnn nnnd dddd  -  scvtf Fd Rn FBITS
 xx01 1110 0x1x xxx1 1101 10nn nnnd dddd  -  scvtf Sd Sn
 x101 1111 xxxx xxxx 1xx0 01nn nnnd dddd  -  scvtf Sd Sn IMM_VLSR
 xx00 1110 0x1x xxx1 1101 10nn nnnd dddd  -  scvtf Vd Vn
-x0x1 1010 xx0m mmmm xx0x 11nn nnnd dddd  -  sdiv Rd Rn Rm
+#x0x1 1010 xx0m mmmm xx0x 11nn nnnd dddd  -  sdiv Rd Rn Rm
+# custom - 64 bit
+1001 1010 110m mmmm 0000 11nn nnnd dddd  -  sdiv Rd Rn Rm
 x1x1 1110 xx0m mmmm x000 x0nn nnnd dddd  -  sha1c Fd Fn Vm
 x1x1 1110 xx1x xxxx 0000 10nn nnnd dddd  -  sha1h Fd Fn
 x1x1 1110 xx0m mmmm x010 x0nn nnnd dddd  -  sha1m Fd Fn Vm
@@ -578,44 +752,83 @@ xx00 100x 001s ssss 1ttt ttxx xxxt tttt  -  stlxp Rs Rt Rt2 ADDR_SIMPLE
 1x00 100x 000s ssss 1xxx xxxx xxxt tttt  -  stlxr Rs Rt ADDR_SIMPLE
 xx10 110I 00ii iiii ittt ttxx xxxt tttt  -  stnp Ft Ft2 ADDR_SIMM7
 xx10 100I 00ii iiii ittt ttxx xxxt tttt  -  stnp Rt Rt2 ADDR_SIMM7
-xx10 110I 00ii iiii ittt ttxx xxxt tttt  -  stp Ft Ft2 ADDR_SIMM7
-xx10 110I 10ii iiii ittt ttxx xxxt tttt  -  stp Ft Ft2 ADDR_SIMM7
-xx10 100I 10ii iiii ittt ttxx xxxt tttt  -  stp Rt Rt2 ADDR_SIMM7
-0011 1000 001x xxxx xxxx 10xx xxxt tttt  -  strb Rt ADDR_REGOFF
+#xx10 110I 00ii iiii ittt ttxx xxxt tttt  -  stp Ft Ft2 ADDR_SIMM7
+#xx10 110I 10ii iiii ittt ttxx xxxt tttt  -  stp Ft Ft2 ADDR_SIMM7
+#xx10 100I 10ii iiii ittt ttxx xxxt tttt  -  stp Rt Rt2 ADDR_SIMM7
+# custom - 64 bit, signed offset
+1010 1001 00ii iiii iuuu uunn nnnt tttt  -  stp Rt Rt2 ADDR_SIMM7
+# custom - 64 bit, pre-indexed
+1010 1001 10ii iiii iuuu uunn nnnt tttt  -  stp.pre Rt Rt2 ADDR_SIMM7
+# custom - 64 bit double, signed offset
+0110 1101 00ii iiii iuuu uunn nnnt tttt  -  stp Ft Ft2 ADDR_SIMM7
+#0011 1000 001x xxxx xxxx 10xx xxxt tttt  -  strb Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s
+0011 1000 001m mmmm 011s 10nn nnnt tttt  -  strb Rt ADDR_REGOFF
 0011 1000 00xi iiii iiii I1xx xxxt tttt  -  strb Rt ADDR_SIMM9
-00x1 1001 00ii iiii iiii iinn nnnt tttt  -  strb Rt ADDR_UIMM12
-xx11 1100 x0xx xxxx xxxx 10xx xxxt tttt  -  str Ft ADDR_REGOFF
+#00x1 1001 00ii iiii iiii iinn nnnt tttt  -  strb Rt ADDR_UIMM12
+# custom
+0011 1001 00ii iiii iiii iinn nnnt tttt  -  strb Rt ADDR_UIMM12
+#xx11 1100 x0xx xxxx xxxx 10xx xxxt tttt  -  str Ft ADDR_REGOFF
+# custom - double, lsl index m, shifted by the access size if s
+1111 1100 001m mmmm 011s 10nn nnnt tttt  -  str Ft ADDR_REGOFF
 xx11 1100 x0xi iiii iiii I1xx xxxt tttt  -  str Ft ADDR_SIMM9
-xxx1 1101 x0ii iiii iiii iinn nnnt tttt  -  str Ft ADDR_UIMM12
-0111 1000 001x xxxx xxxx 10xx xxxt tttt  -  strh Rt ADDR_REGOFF
+#xxx1 1101 x0ii iiii iiii iinn nnnt tttt  -  str Ft ADDR_UIMM12
+# custom - 64 bit double
+1111 1101 00ii iiii iiii iinn nnnt tttt  -  str Ft ADDR_UIMM12
+#0111 1000 001x xxxx xxxx 10xx xxxt tttt  -  strh Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s
+0111 1000 001m mmmm 011s 10nn nnnt tttt  -  strh Rt ADDR_REGOFF
 0111 1000 00xi iiii iiii I1xx xxxt tttt  -  strh Rt ADDR_SIMM9
-01x1 1001 00ii iiii iiii iinn nnnt tttt  -  strh Rt ADDR_UIMM12
-1x11 1000 001x xxxx xxxx 10xx xxxt tttt  -  str Rt ADDR_REGOFF
+#01x1 1001 00ii iiii iiii iinn nnnt tttt  -  strh Rt ADDR_UIMM12
+# custom
+0111 1001 00ii iiii iiii iinn nnnt tttt  -  strh Rt ADDR_UIMM12
+#1x11 1000 001x xxxx xxxx 10xx xxxt tttt  -  str Rt ADDR_REGOFF
+# custom - lsl index m, shifted by the access size if s
+1111 1000 001m mmmm 011s 10nn nnnt tttt  -  str Rt ADDR_REGOFF
+1011 1000 001m mmmm 011s 10nn nnnt tttt  -  str.w Rt ADDR_REGOFF
 1x11 1000 00xi iiii iiii I1xx xxxt tttt  -  str Rt ADDR_SIMM9
 #1xx1 1001 00ii iiii iiii iinn nnnt tttt  -  str Rt ADDR_UIMM12
 
 1111 1001 00ii iiii iiii iinn nnnt tttt  -  str Rt ADDR_UIMM12
 1011 1001 00ii iiii iiii iinn nnnt tttt  -  str.w Rt ADDR_UIMM12
 
-0011 1000 000i iiii iiii I0xx xxxt tttt  -  sttrb Rt ADDR_SIMM9
-0111 1000 000i iiii iiii I0xx xxxt tttt  -  sttrh Rt ADDR_SIMM9
-1x11 1000 000i iiii iiii I0xx xxxt tttt  -  sttr Rt ADDR_SIMM9
-0011 1000 00xi iiii iiii I0xx xxxt tttt  -  sturb Rt ADDR_SIMM9
-xx11 1100 x0xi iiii iiii I0xx xxxt tttt  -  stur Ft ADDR_SIMM9
-0111 1000 00xi iiii iiii I0xx xxxt tttt  -  sturh Rt ADDR_SIMM9
-1x11 1000 00xi iiii iiii I0xx xxxt tttt  -  stur Rt ADDR_SIMM9
+# unprivileged stores share their bits with the custom unscaled stores
+#0011 1000 000i iiii iiii I0xx xxxt tttt  -  sttrb Rt ADDR_SIMM9
+#0111 1000 000i iiii iiii I0xx xxxt tttt  -  sttrh Rt ADDR_SIMM9
+#1x11 1000 000i iiii iiii I0xx xxxt tttt  -  sttr Rt ADDR_SIMM9
+#0011 1000 00xi iiii iiii I0xx xxxt tttt  -  sturb Rt ADDR_SIMM9
+# custom
+0011 1000 000i iiii iiii 00nn nnnt tttt  -  sturb Rt ADDR_SIMM9
+#xx11 1100 x0xi iiii iiii I0xx xxxt tttt  -  stur Ft ADDR_SIMM9
+# custom - double
+1111 1100 000i iiii iiii 00nn nnnt tttt  -  stur Ft ADDR_SIMM9
+#0111 1000 00xi iiii iiii I0xx xxxt tttt  -  sturh Rt ADDR_SIMM9
+# custom
+0111 1000 000i iiii iiii 00nn nnnt tttt  -  sturh Rt ADDR_SIMM9
+#1x11 1000 00xi iiii iiii I0xx xxxt tttt  -  stur Rt ADDR_SIMM9
+# custom - 64 bit
+1111 1000 000i iiii iiii 00nn nnnt tttt  -  stur Rt ADDR_SIMM9
+1011 1000 000i iiii iiii 00nn nnnt tttt  -  stur.w Rt ADDR_SIMM9
 xx00 100x 001s ssss 0ttt ttxx xxxt tttt  -  stxp Rs Rt Rt2 ADDR_SIMPLE
 0000 100x 000s ssss 0xxx xxxx xxxt tttt  -  stxrb Rs Rt ADDR_SIMPLE
 0100 100x 000s ssss 0xxx xxxx xxxt tttt  -  stxrh Rs Rt ADDR_SIMPLE
 1x00 100x 000s ssss 0xxx xxxx xxxt tttt  -  stxr Rs Rt ADDR_SIMPLE
 x10x 1110 xx1m mmmm 0110 00nn nnnd dddd  -  subhn2 Vd Vn Vm
 x00x 1110 xx1m mmmm 0110 00nn nnnd dddd  -  subhn Vd Vn Vm
-x100 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  sub Rd Rn Rm_SFT
-x10x 0001 SSii iiii iiii iinn nnnd dddd  -  sub Rd_SP Rn_SP AIMM
+#x100 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  sub Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1100 1011 000m mmmm ssss ssnn nnnd dddd  -  sub Rd Rn Rm_SFT
+#x10x 0001 SSii iiii iiii iinn nnnd dddd  -  sub Rd_SP Rn_SP AIMM
+# custom - 64 bit, unshifted
+1101 0001 00ii iiii iiii iinn nnnd dddd  -  sub Rd_SP Rn_SP AIMM
 x100 1011 0x1x xxxx xxxx xxnn nnnd dddd  -  sub Rd_SP Rn_SP Rm_EXT
 xx11 1110 xx1m mmmm x000 01nn nnnd dddd  -  sub Sd Sn Sm
-x110 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  subs Rd Rn Rm_SFT
-x11x 0001 SSii iiii iiii iinn nnnd dddd  -  subs Rd Rn_SP AIMM
+#x110 1011 xx0x xxxx xxxx xxnn nnnd dddd  -  subs Rd Rn Rm_SFT
+# custom - 64 bit, logical shift left s
+1110 1011 000m mmmm ssss ssnn nnnd dddd  -  subs Rd Rn Rm_SFT
+#x11x 0001 SSii iiii iiii iinn nnnd dddd  -  subs Rd Rn_SP AIMM
+# custom - 64 bit, unshifted
+1111 0001 00ii iiii iiii iinn nnnd dddd  -  subs Rd Rn_SP AIMM
 x110 1011 0x1x xxxx xxxx xxnn nnnd dddd  -  subs Rd Rn_SP Rm_EXT
 xx10 1110 xx1m mmmm 1000 01nn nnnd dddd  -  sub Vd Vn Vm
 x101 1110 xx1x xxxx 0011 10nn nnnd dddd  -  suqadd Sd Sn
@@ -642,7 +855,9 @@ x010 1110 xx1m mmmm 0000 00nn nnnd dddd  -  uaddl Vd Vn Vm
 xx10 1110 xx11 xxx0 0011 10nn nnnd dddd  -  uaddlv Fd Vn
 x110 1110 xx1m mmmm 0001 00nn nnnd dddd  -  uaddw2 Vd Vn Vm
 x010 1110 xx1m mmmm 0001 00nn nnnd dddd  -  uaddw Vd Vn Vm
-x10x 0011 0xii iiii iiii iinn nnnd dddd  -  ubfm Rd Rn IMMR IMMS
+#x10x 0011 0xii iiii iiii iinn nnnd dddd  -  ubfm Rd Rn IMMR IMMS
+# custom - 64 bit, rotate r and width s
+1101 0011 01rr rrrr ssss ssnn nnnd dddd  -  ubfm Rd Rn IMMR IMMS
 xxx1 1110 xx1x x011 0000 00nn nnnd dddd  -  ucvtf Fd Rn
 x0x1 1110 xx0x xx11 SSSS SSnn nnnd dddd  -  ucvtf Fd Rn FBITS
 xx11 1110 0x1x xxx1 1101 10nn nnnd dddd  -  ucvtf Sd Sn